@@ -1,6 +1,10 @@
 package config
 
-import "github.com/pitabwire/frame"
+import (
+	"time"
+
+	"github.com/pitabwire/frame"
+)
 
 type PartitionConfig struct {
 	frame.ConfigurationDefault
@@ -9,4 +13,45 @@ type PartitionConfig struct {
 	QueuePartitionSyncURL        string `envDefault:"mem://partition_sync_hydra" env:"QUEUE_PARTITION_SYNC"`
 	PartitionSyncName            string `envDefault:"partition_sync_hydra"       env:"QUEUE_PARTITION_SYNC_NAME"`
 	SynchronizePrimaryPartitions bool   `envDefault:"False"                      env:"SYNCHRONIZE_PRIMARY_PARTITIONS"`
+
+	KetoReadURI                string `envDefault:"http://127.0.0.1:4466"  env:"KETO_READ_URI"`
+	KetoWriteURI               string `envDefault:"http://127.0.0.1:4467"  env:"KETO_WRITE_URI"`
+	QueueAccessSyncURL         string `envDefault:"mem://access_sync_keto" env:"QUEUE_ACCESS_SYNC"`
+	AccessSyncName             string `envDefault:"access_sync_keto"       env:"QUEUE_ACCESS_SYNC_NAME"`
+	SynchronizeAccessRelations bool   `envDefault:"False"                  env:"SYNCHRONIZE_ACCESS_RELATIONS"`
+
+	NotificationSendPath    string        `envDefault:"/v1/notification/send" env:"NOTIFICATION_SEND_PATH"`
+	InvitationSigningSecret string        `envDefault:""                      env:"INVITATION_SIGNING_SECRET"`
+	InvitationValidity      time.Duration `envDefault:"72h"                   env:"INVITATION_VALIDITY"`
+
+	QueueAccessEventsURL string        `envDefault:"mem://partition_access_events" env:"QUEUE_ACCESS_EVENTS"`
+	AccessEventsName     string        `envDefault:"partition_access_events"       env:"QUEUE_ACCESS_EVENTS_NAME"`
+	AccessExpiryInterval time.Duration `envDefault:"5m"                            env:"ACCESS_EXPIRY_INTERVAL"`
+	GuestAccessValidity  time.Duration `envDefault:"720h"                          env:"GUEST_ACCESS_VALIDITY"`
+	// AccessConditionMaxCost bounds the CEL cost of a role assignment condition, both estimated and evaluated.
+	AccessConditionMaxCost uint64 `envDefault:"10000" env:"ACCESS_CONDITION_MAX_COST"`
+
+	QueueProfileEventsURL string `envDefault:"mem://profile_events" env:"QUEUE_PROFILE_EVENTS"`
+	ProfileEventsName     string `envDefault:"profile_events"       env:"QUEUE_PROFILE_EVENTS_NAME"`
+
+	PageRenderTimeout  time.Duration `envDefault:"2s"      env:"PAGE_RENDER_TIMEOUT"`
+	PageRenderMaxBytes int           `envDefault:"1048576" env:"PAGE_RENDER_MAX_BYTES"`
+	PageRenderMaxSteps int           `envDefault:"100000"  env:"PAGE_RENDER_MAX_STEPS"`
+	DefaultPageLocale  string        `envDefault:"en"      env:"DEFAULT_PAGE_LOCALE"`
+	// PageRenderProperties are the partition and tenant properties pages can read, the rest may hold secrets.
+	PageRenderProperties []string `envDefault:"logo_uri" env:"PAGE_RENDER_PROPERTIES" envSeparator:","`
+
+	// The page sanitisation policy, an empty list keeps the built in defaults.
+	PageAllowedTags       []string `env:"PAGE_ALLOWED_TAGS"        envSeparator:","`
+	PageAllowedAttributes []string `env:"PAGE_ALLOWED_ATTRIBUTES"  envSeparator:","`
+	PageAllowedURLSchemes []string `env:"PAGE_ALLOWED_URL_SCHEMES" envSeparator:","`
+	// TrustedPageTenantIDs are tenants whose pages are not sanitised, only operators can trust a tenant.
+	TrustedPageTenantIDs []string `env:"TRUSTED_PAGE_TENANT_IDS" envSeparator:","`
+
+	// PolicyBundleTokens are the bearer tokens OPA sidecars fetch policy bundles with, as tenant_id:token pairs.
+	// A token only reads the bundles of its tenant.
+	PolicyBundleTokens map[string]string `env:"POLICY_BUNDLE_TOKENS" envSeparator:"," envKeyValSeparator:":"`
+	// PolicyBundleToken reads the bundle of every tenant, it is for operators and never for a tenant's sidecar.
+	// Bundles are not served while neither kind of token is configured.
+	PolicyBundleToken string `envDefault:"" env:"POLICY_BUNDLE_TOKEN"`
 }
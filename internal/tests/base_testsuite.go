@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/antinvestor/service-partition/config"
+	"github.com/antinvestor/service-partition/service/models"
 	"github.com/antinvestor/service-partition/service/repository"
 	"github.com/pitabwire/util"
 	"github.com/stretchr/testify/require"
@@ -64,7 +65,10 @@ func (bs *BaseTestSuite) CreateService(
 	ctx, svc := frame.NewServiceWithContext(t.Context(), "partition tests",
 		frame.WithConfig(&cfg),
 		frame.WithDatastore(),
-		frame.WithNoopDriver())
+		frame.WithNoopDriver(),
+		frame.WithRegisterPublisher(cfg.PartitionSyncName, cfg.QueuePartitionSyncURL),
+		frame.WithRegisterPublisher(cfg.AccessSyncName, cfg.QueueAccessSyncURL),
+		frame.WithRegisterPublisher(cfg.AccessEventsName, cfg.QueueAccessEventsURL))
 
 	svc.Init(ctx)
 
@@ -77,6 +81,60 @@ func (bs *BaseTestSuite) CreateService(
 	return svc, ctx
 }
 
+// CreatePartition stores a partition with the properties and roles in a tenant of its own.
+func (bs *BaseTestSuite) CreatePartition(
+	t *testing.T,
+	svc *frame.Service,
+	properties frame.JSONMap,
+	roles ...*models.PartitionRole,
+) *models.Partition {
+	ctx := t.Context()
+	partitionRepo := repository.NewPartitionRepository(svc)
+
+	tenant := &models.Tenant{Name: "test tenant", Description: "Test"}
+	require.NoError(t, repository.NewTenantRepository(svc).Save(ctx, tenant))
+
+	partition := &models.Partition{
+		Name:       "test partition",
+		Properties: properties,
+		BaseModel:  frame.BaseModel{TenantID: tenant.GetID()},
+	}
+	require.NoError(t, partitionRepo.Save(ctx, partition))
+
+	for _, role := range roles {
+		role.TenantID = partition.TenantID
+		role.PartitionID = partition.GetID()
+		require.NoError(t, partitionRepo.SaveRole(ctx, role))
+	}
+
+	return partition
+}
+
+// WithFakeHydra starts an in-process fake hydra admin server and points the service configuration at it.
+func (bs *BaseTestSuite) WithFakeHydra(t *testing.T, svc *frame.Service) *FakeHydra {
+	fakeHydra := NewFakeHydra()
+	t.Cleanup(fakeHydra.Close)
+
+	cfg, ok := svc.Config().(*config.PartitionConfig)
+	require.True(t, ok, "service configuration should be a partition config")
+
+	cfg.Oauth2ServiceAdminURI = fakeHydra.URL()
+	return fakeHydra
+}
+
+// WithFakeKeto starts an in-process fake keto server and points the service configuration at it.
+func (bs *BaseTestSuite) WithFakeKeto(t *testing.T, svc *frame.Service) *FakeKeto {
+	fakeKeto := NewFakeKeto()
+	t.Cleanup(fakeKeto.Close)
+
+	cfg, ok := svc.Config().(*config.PartitionConfig)
+	require.True(t, ok, "service configuration should be a partition config")
+
+	cfg.KetoReadURI = fakeKeto.URL()
+	cfg.KetoWriteURI = fakeKeto.URL()
+	return fakeKeto
+}
+
 func (bs *BaseTestSuite) TearDownSuite() {
 	bs.FrameBaseTestSuite.TearDownSuite()
 }
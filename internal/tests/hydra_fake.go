@@ -0,0 +1,255 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const hydraClientsPath = "/admin/clients"
+
+// HydraRequest is a record of a single call received by the FakeHydra admin server.
+type HydraRequest struct {
+	Method   string
+	Path     string
+	ClientID string
+	Body     map[string]any
+}
+
+// HydraFault decides whether a request should fail instead of being served.
+// Returning inject as false lets the request through to the normal handler.
+type HydraFault func(r *HydraRequest) (status int, body string, inject bool)
+
+// FakeHydra is an in-process stand in for the Ory Hydra admin client endpoints.
+// It keeps registered clients in memory and allows tests to inject failures,
+// so that partition synchronisation can be exercised without a running Hydra.
+type FakeHydra struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	clients  map[string]map[string]any
+	requests []HydraRequest
+	faults   []HydraFault
+}
+
+// NewFakeHydra starts a fake Hydra admin server, callers should Close it when done.
+func NewFakeHydra() *FakeHydra {
+	fh := &FakeHydra{
+		clients: make(map[string]map[string]any),
+	}
+	fh.server = httptest.NewServer(http.HandlerFunc(fh.serveHTTP))
+	return fh
+}
+
+// URL is the admin base url to be configured as the Oauth2ServiceAdminURI.
+func (fh *FakeHydra) URL() string {
+	return fh.server.URL
+}
+
+// Close shuts down the underlying http server.
+func (fh *FakeHydra) Close() {
+	fh.server.Close()
+}
+
+// InjectFault registers a fault hook, hooks are consulted in the order they were added.
+func (fh *FakeHydra) InjectFault(fault HydraFault) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	fh.faults = append(fh.faults, fault)
+}
+
+// FailNext makes the next request using the given http method respond with status.
+// Hooks run outside the lock, so concurrent requests race for the single failure.
+func (fh *FakeHydra) FailNext(method string, status int) {
+	var fired atomic.Bool
+	fh.InjectFault(func(r *HydraRequest) (int, string, bool) {
+		if r.Method != method || !fired.CompareAndSwap(false, true) {
+			return 0, "", false
+		}
+		return status, `{"error":"injected fault"}`, true
+	})
+}
+
+// ClearFaults removes all registered fault hooks.
+func (fh *FakeHydra) ClearFaults() {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	fh.faults = nil
+}
+
+// Client returns a copy of the client registered under clientID.
+func (fh *FakeHydra) Client(clientID string) (map[string]any, bool) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	client, ok := fh.clients[clientID]
+	if !ok {
+		return nil, false
+	}
+	return copyClient(client), true
+}
+
+// SetClient registers or replaces a client directly, bypassing the http api.
+func (fh *FakeHydra) SetClient(clientID string, client map[string]any) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	client = copyClient(client)
+	client["client_id"] = clientID
+	fh.clients[clientID] = client
+}
+
+// DeleteClient removes a client directly, as if it was deleted on hydra by someone else.
+func (fh *FakeHydra) DeleteClient(clientID string) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	delete(fh.clients, clientID)
+}
+
+// ClientCount is the number of clients currently registered.
+func (fh *FakeHydra) ClientCount() int {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	return len(fh.clients)
+}
+
+// Requests returns every request received so far.
+func (fh *FakeHydra) Requests() []HydraRequest {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	return append([]HydraRequest(nil), fh.requests...)
+}
+
+func (fh *FakeHydra) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, hydraClientsPath) {
+		writeHydraJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
+		return
+	}
+
+	record := HydraRequest{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		ClientID: strings.Trim(strings.TrimPrefix(r.URL.Path, hydraClientsPath), "/"),
+	}
+
+	if r.Body != nil {
+		raw, err := io.ReadAll(r.Body)
+		if err == nil && len(raw) > 0 {
+			_ = json.Unmarshal(raw, &record.Body)
+		}
+	}
+
+	fh.mu.Lock()
+	fh.requests = append(fh.requests, record)
+	faults := append([]HydraFault(nil), fh.faults...)
+	fh.mu.Unlock()
+
+	for _, fault := range faults {
+		if status, body, inject := fault(&record); inject {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(body))
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		fh.handleGet(w, &record)
+	case http.MethodPost:
+		fh.handleCreate(w, &record)
+	case http.MethodPut:
+		fh.handleUpdate(w, &record)
+	case http.MethodDelete:
+		fh.handleDelete(w, &record)
+	default:
+		writeHydraJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "method_not_allowed"})
+	}
+}
+
+func (fh *FakeHydra) handleGet(w http.ResponseWriter, record *HydraRequest) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	if record.ClientID == "" {
+		clientList := make([]map[string]any, 0, len(fh.clients))
+		for _, client := range fh.clients {
+			clientList = append(clientList, copyClient(client))
+		}
+		writeHydraJSON(w, http.StatusOK, clientList)
+		return
+	}
+
+	client, ok := fh.clients[record.ClientID]
+	if !ok {
+		writeHydraJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
+		return
+	}
+	writeHydraJSON(w, http.StatusOK, client)
+}
+
+func (fh *FakeHydra) handleCreate(w http.ResponseWriter, record *HydraRequest) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	clientID, _ := record.Body["client_id"].(string)
+	if clientID == "" {
+		writeHydraJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_request"})
+		return
+	}
+
+	if _, exists := fh.clients[clientID]; exists {
+		writeHydraJSON(w, http.StatusConflict, map[string]any{"error": "resource_conflict"})
+		return
+	}
+
+	client := copyClient(record.Body)
+	fh.clients[clientID] = client
+	writeHydraJSON(w, http.StatusCreated, client)
+}
+
+func (fh *FakeHydra) handleUpdate(w http.ResponseWriter, record *HydraRequest) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	if _, exists := fh.clients[record.ClientID]; !exists {
+		writeHydraJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
+		return
+	}
+
+	client := copyClient(record.Body)
+	client["client_id"] = record.ClientID
+	fh.clients[record.ClientID] = client
+	writeHydraJSON(w, http.StatusOK, client)
+}
+
+func (fh *FakeHydra) handleDelete(w http.ResponseWriter, record *HydraRequest) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	if _, exists := fh.clients[record.ClientID]; !exists {
+		writeHydraJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
+		return
+	}
+
+	delete(fh.clients, record.ClientID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func copyClient(client map[string]any) map[string]any {
+	clone := make(map[string]any, len(client))
+	for k, v := range client {
+		clone[k] = v
+	}
+	return clone
+}
+
+func writeHydraJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
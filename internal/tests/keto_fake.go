@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FakeKeto is an in-process stand in for the Ory Keto relation tuple read and write apis.
+// Tuples are held as strings in the `namespace:object#relation@namespace:object` notation.
+type FakeKeto struct {
+	server *httptest.Server
+
+	mu     sync.Mutex
+	tuples map[string]map[string]any
+}
+
+// NewFakeKeto starts a fake Keto server serving both the read and the write apis.
+func NewFakeKeto() *FakeKeto {
+	fk := &FakeKeto{
+		tuples: make(map[string]map[string]any),
+	}
+	fk.server = httptest.NewServer(http.HandlerFunc(fk.serveHTTP))
+	return fk
+}
+
+func (fk *FakeKeto) URL() string {
+	return fk.server.URL
+}
+
+func (fk *FakeKeto) Close() {
+	fk.server.Close()
+}
+
+// Tuples lists the stored tuples in a sorted, human readable notation.
+func (fk *FakeKeto) Tuples() []string {
+	fk.mu.Lock()
+	defer fk.mu.Unlock()
+
+	tupleList := make([]string, 0, len(fk.tuples))
+	for key := range fk.tuples {
+		tupleList = append(tupleList, key)
+	}
+	sort.Strings(tupleList)
+	return tupleList
+}
+
+func ketoTupleKey(namespace, object, relation, subjectNamespace, subjectObject string) string {
+	return namespace + ":" + object + "#" + relation + "@" + subjectNamespace + ":" + subjectObject
+}
+
+func (fk *FakeKeto) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/relation-tuples":
+		fk.handleList(w, r)
+	case r.Method == http.MethodPut && r.URL.Path == "/admin/relation-tuples":
+		fk.handleWrite(w, r)
+	case r.Method == http.MethodDelete && r.URL.Path == "/admin/relation-tuples":
+		fk.handleDelete(w, r)
+	default:
+		writeHydraJSON(w, http.StatusNotFound, map[string]any{"error": "not_found"})
+	}
+}
+
+func (fk *FakeKeto) handleList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	fk.mu.Lock()
+	defer fk.mu.Unlock()
+
+	matches := make([]map[string]any, 0)
+	for _, tuple := range fk.tuples {
+		subject, _ := tuple["subject_set"].(map[string]any)
+		if (query.Get("namespace") == "" || tuple["namespace"] == query.Get("namespace")) &&
+			(query.Get("object") == "" || tuple["object"] == query.Get("object")) &&
+			(query.Get("relation") == "" || tuple["relation"] == query.Get("relation")) &&
+			(query.Get("subject_set.object") == "" || subject["object"] == query.Get("subject_set.object")) {
+			matches = append(matches, tuple)
+		}
+	}
+
+	writeHydraJSON(w, http.StatusOK, map[string]any{"relation_tuples": matches, "next_page_token": ""})
+}
+
+func (fk *FakeKeto) handleWrite(w http.ResponseWriter, r *http.Request) {
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeHydraJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	tuple := map[string]any{}
+	err = json.Unmarshal(raw, &tuple)
+	if err != nil {
+		writeHydraJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	subject, _ := tuple["subject_set"].(map[string]any)
+	key := ketoTupleKey(asString(tuple["namespace"]), asString(tuple["object"]), asString(tuple["relation"]),
+		asString(subject["namespace"]), asString(subject["object"]))
+
+	fk.mu.Lock()
+	fk.tuples[key] = tuple
+	fk.mu.Unlock()
+
+	writeHydraJSON(w, http.StatusCreated, tuple)
+}
+
+func (fk *FakeKeto) handleDelete(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	key := ketoTupleKey(query.Get("namespace"), query.Get("object"), query.Get("relation"),
+		query.Get("subject_set.namespace"), query.Get("subject_set.object"))
+
+	fk.mu.Lock()
+	delete(fk.tuples, key)
+	fk.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func asString(val any) string {
+	str, _ := val.(string)
+	return strings.TrimSpace(str)
+}
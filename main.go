@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	"buf.build/go/protovalidate"
 	"github.com/antinvestor/apis/go/common"
@@ -90,7 +91,15 @@ func main() {
 		return
 	}
 
-	proxyServerOpt := frame.WithHTTPHandler(proxyMux)
+	httpMux := http.NewServeMux()
+	httpMux.Handle(handlers.PolicyBundlePath, &handlers.PolicyBundleHandler{
+		Service:      svc,
+		Token:        cfg.PolicyBundleToken,
+		TenantTokens: cfg.PolicyBundleTokens,
+	})
+	httpMux.Handle("/", proxyMux)
+
+	proxyServerOpt := frame.WithHTTPHandler(httpMux)
 	serviceOptions = append(serviceOptions, proxyServerOpt)
 
 	partitionSyncQueueHandler := queue.PartitionSyncQueueHandler{
@@ -106,12 +115,46 @@ func main() {
 
 	serviceOptions = append(serviceOptions, partitionSyncQueue, partitionSyncQueueP)
 
+	accessSyncQueueHandler := queue.AccessRelationSyncQueueHandler{
+		Service: svc,
+	}
+	accessSyncQueue := frame.WithRegisterSubscriber(
+		cfg.AccessSyncName,
+		cfg.QueueAccessSyncURL,
+		&accessSyncQueueHandler,
+	)
+	accessSyncQueueP := frame.WithRegisterPublisher(cfg.AccessSyncName, cfg.QueueAccessSyncURL)
+
+	serviceOptions = append(serviceOptions, accessSyncQueue, accessSyncQueueP)
+
+	profileEventsQueueHandler := queue.ProfileEventQueueHandler{
+		Service: svc,
+	}
+	profileEventsQueue := frame.WithRegisterSubscriber(
+		cfg.ProfileEventsName,
+		cfg.QueueProfileEventsURL,
+		&profileEventsQueueHandler,
+	)
+
+	serviceOptions = append(serviceOptions, profileEventsQueue)
+
+	accessEventsP := frame.WithRegisterPublisher(cfg.AccessEventsName, cfg.QueueAccessEventsURL)
+	serviceOptions = append(serviceOptions, accessEventsP)
+
 	svc.Init(ctx, serviceOptions...)
 
 	if cfg.SynchronizePrimaryPartitions {
 		svc.AddPreStartMethod(business.ReQueuePrimaryPartitionsForSync)
 	}
 
+	if cfg.SynchronizeAccessRelations {
+		svc.AddPreStartMethod(business.ReQueueAccessesForSync)
+	}
+
+	svc.AddPreStartMethod(func(s *frame.Service) {
+		go business.RunAccessExpiryJob(ctx, s, cfg.AccessExpiryInterval)
+	})
+
 	log.WithField("server http port", cfg.HTTPServerPort).
 		WithField("server grpc port", cfg.GrpcServerPort).
 		Info(" Initiating server operations")
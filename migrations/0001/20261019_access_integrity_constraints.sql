@@ -0,0 +1,45 @@
+-- Enforce access integrity in the database in addition to the checks done by the service.
+
+-- Keep only the oldest live access per partition and profile before making it unique.
+UPDATE accesses SET deleted_at = now()
+    WHERE deleted_at IS NULL AND id IN (
+        SELECT id FROM (
+            SELECT id, row_number() OVER (PARTITION BY partition_id, profile_id ORDER BY created_at, id) AS position
+            FROM accesses WHERE deleted_at IS NULL
+        ) ranked WHERE position > 1
+    );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_accesses_partition_profile
+    ON accesses (partition_id, profile_id) WHERE deleted_at IS NULL;
+
+-- Keep only the oldest live assignment of a role to an access before making it unique.
+UPDATE access_roles SET deleted_at = now()
+    WHERE deleted_at IS NULL AND id IN (
+        SELECT id FROM (
+            SELECT id, row_number() OVER (PARTITION BY access_id, partition_role_id ORDER BY created_at, id) AS position
+            FROM access_roles WHERE deleted_at IS NULL
+        ) ranked WHERE position > 1
+    );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_access_roles_access_partition_role
+    ON access_roles (access_id, partition_role_id) WHERE deleted_at IS NULL;
+
+-- Foreign keys are added as NOT VALID so that historic orphans do not block the migration,
+-- they are still enforced for every row written from now on.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_accesses_partition') THEN
+        ALTER TABLE accesses ADD CONSTRAINT fk_accesses_partition
+            FOREIGN KEY (partition_id) REFERENCES partitions (id) NOT VALID;
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_access_roles_access') THEN
+        ALTER TABLE access_roles ADD CONSTRAINT fk_access_roles_access
+            FOREIGN KEY (access_id) REFERENCES accesses (id) NOT VALID;
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_access_roles_partition_role') THEN
+        ALTER TABLE access_roles ADD CONSTRAINT fk_access_roles_partition_role
+            FOREIGN KEY (partition_role_id) REFERENCES partition_roles (id) NOT VALID;
+    END IF;
+END $$;
@@ -0,0 +1,60 @@
+-- Roles used to be stored with the partition_id column of their partition instead of its id, so the role
+-- integrity check rejects assigning them. A legacy role belongs to the partition it has been assigned in,
+-- roles assigned in exactly one partition whose partition_id matches are moved there.
+-- A role that would clash with a role name of that partition gets its id appended, as duplicates did before.
+WITH assigned AS (
+    SELECT r.id AS role_id, MIN(a.partition_id) AS partition_id
+    FROM partition_roles r
+        JOIN access_roles ar ON ar.partition_role_id = r.id AND ar.deleted_at IS NULL
+        JOIN accesses a ON a.id = ar.access_id AND a.deleted_at IS NULL
+    WHERE r.deleted_at IS NULL
+    GROUP BY r.id, r.partition_id
+    HAVING COUNT(DISTINCT a.partition_id) = 1 AND MIN(a.partition_id) <> r.partition_id
+)
+UPDATE partition_roles r
+SET partition_id = assigned.partition_id,
+    name = CASE WHEN EXISTS (
+            SELECT 1 FROM partition_roles other
+            WHERE other.deleted_at IS NULL AND other.partition_id = assigned.partition_id
+                AND LOWER(other.name) = LOWER(r.name)
+        ) THEN LEFT(r.name, 79) || '-' || r.id ELSE r.name END
+FROM assigned
+    JOIN partitions p ON p.id = assigned.partition_id
+WHERE r.id = assigned.role_id AND p.partition_id = r.partition_id;
+
+-- Legacy roles still pointing at no partition, never assigned or assigned in several partitions,
+-- belong to the only partition of their tenant.
+WITH orphaned AS (
+    SELECT r.id AS role_id, MIN(p.id) AS partition_id
+    FROM partition_roles r
+        JOIN partitions p ON p.tenant_id = r.tenant_id AND p.deleted_at IS NULL
+    WHERE r.deleted_at IS NULL
+        AND NOT EXISTS (SELECT 1 FROM partitions owner WHERE owner.id = r.partition_id)
+    GROUP BY r.id
+    HAVING COUNT(p.id) = 1
+)
+UPDATE partition_roles r
+SET partition_id = orphaned.partition_id,
+    name = CASE WHEN EXISTS (
+            SELECT 1 FROM partition_roles other
+            WHERE other.deleted_at IS NULL AND other.partition_id = orphaned.partition_id
+                AND LOWER(other.name) = LOWER(r.name)
+        ) THEN LEFT(r.name, 79) || '-' || r.id ELSE r.name END
+FROM orphaned
+WHERE r.id = orphaned.role_id;
+
+-- Any role left without a partition lives in a tenant with several partitions and can not be placed
+-- safely, the migration stops so that it is assigned by hand instead of staying unusable.
+DO $$
+DECLARE
+    orphans TEXT;
+BEGIN
+    SELECT string_agg(r.id, ', ' ORDER BY r.id) INTO orphans
+    FROM partition_roles r
+    WHERE r.deleted_at IS NULL
+        AND NOT EXISTS (SELECT 1 FROM partitions owner WHERE owner.id = r.partition_id);
+
+    IF orphans IS NOT NULL THEN
+        RAISE EXCEPTION 'partition roles without a partition must be moved to their partition first: %', orphans;
+    END IF;
+END $$;
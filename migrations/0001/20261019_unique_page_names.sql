@@ -0,0 +1,11 @@
+-- Page names are unique within a partition, older duplicates keep their name and later ones get their id appended.
+UPDATE pages SET name = LEFT(name, 29) || '-' || id
+    WHERE deleted_at IS NULL AND id IN (
+        SELECT id FROM (
+            SELECT id, row_number() OVER (PARTITION BY partition_id, name ORDER BY created_at, id) AS position
+            FROM pages WHERE deleted_at IS NULL
+        ) ranked WHERE position > 1
+    );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pages_partition_name
+    ON pages (partition_id, name) WHERE deleted_at IS NULL;
@@ -0,0 +1,5 @@
+-- Pages come in locale variants, a name is unique per partition and locale.
+DROP INDEX IF EXISTS idx_pages_partition_name;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pages_partition_name_locale
+    ON pages (partition_id, name, locale) WHERE deleted_at IS NULL;
@@ -0,0 +1,11 @@
+-- Role names are unique within a partition, older duplicates keep their name and later ones get their id appended.
+UPDATE partition_roles SET name = LEFT(name, 79) || '-' || id
+    WHERE deleted_at IS NULL AND id IN (
+        SELECT id FROM (
+            SELECT id, row_number() OVER (PARTITION BY partition_id, LOWER(name) ORDER BY created_at, id) AS position
+            FROM partition_roles WHERE deleted_at IS NULL
+        ) ranked WHERE position > 1
+    );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_partition_roles_partition_name
+    ON partition_roles (partition_id, LOWER(name)) WHERE deleted_at IS NULL;
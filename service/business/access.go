@@ -3,10 +3,13 @@ package business
 import (
 	"context"
 	"errors"
+	"time"
 
 	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
 	"github.com/antinvestor/service-partition/service/models"
 	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/pitabwire/frame"
 )
@@ -23,6 +26,38 @@ type AccessBusiness interface {
 	CreateAccessRole(
 		ctx context.Context,
 		request *partitionv1.CreateAccessRoleRequest) (*partitionv1.AccessRoleObject, error)
+
+	GetActiveAccess(ctx context.Context, request *partitionv1.GetAccessRequest) (*partitionv1.AccessObject, error)
+	SuspendAccess(ctx context.Context, accessID string, reason string) (*partitionv1.AccessObject, error)
+	ReinstateAccess(ctx context.Context, accessID string) (*partitionv1.AccessObject, error)
+	RevokeAccess(ctx context.Context, accessID string, reason string) (*partitionv1.AccessObject, error)
+
+	SetAccessValidity(
+		ctx context.Context,
+		accessID string,
+		validFrom *time.Time,
+		validUntil *time.Time) (*partitionv1.AccessObject, error)
+	SetAccessRoleValidity(
+		ctx context.Context,
+		accessRoleID string,
+		validFrom *time.Time,
+		validUntil *time.Time) (*partitionv1.AccessRoleObject, error)
+	SetAccessRoleCondition(
+		ctx context.Context,
+		accessRoleID string,
+		condition string) (*partitionv1.AccessRoleObject, error)
+
+	ListPartitionAccess(ctx context.Context, request *ListPartitionAccessRequest) ([]*AccessEntry, error)
+	ListProfileAccess(ctx context.Context, request *ListProfileAccessRequest) ([]*AccessEntry, error)
+
+	CheckPermission(ctx context.Context, request *CheckPermissionRequest) (*PermissionDecision, error)
+	GetEffectiveAccess(ctx context.Context, partitionID string, profileID string) (*EffectiveAccessResult, error)
+
+	BulkGrantAccess(ctx context.Context, request *BulkAccessRequest) (*BulkAccessResponse, error)
+	BulkRevokeAccess(ctx context.Context, request *BulkAccessRequest) (*BulkAccessResponse, error)
+
+	CreateGuestAccess(ctx context.Context, request *CreateGuestAccessRequest) (*AccessEntry, error)
+	RevokeGuests(ctx context.Context, partitionID string, reason string) (int, error)
 }
 
 func NewAccessBusiness(_ context.Context, service *frame.Service) AccessBusiness {
@@ -33,6 +68,7 @@ func NewAccessBusiness(_ context.Context, service *frame.Service) AccessBusiness
 		service:       service,
 		accessRepo:    accessRepo,
 		partitionRepo: partitionRepo,
+		tenantRepo:    repository.NewTenantRepository(service),
 	}
 }
 
@@ -40,6 +76,7 @@ type accessBusiness struct {
 	service       *frame.Service
 	accessRepo    repository.AccessRepository
 	partitionRepo repository.PartitionRepository
+	tenantRepo    repository.TenantRepository
 }
 
 func toAPIAccess(
@@ -53,6 +90,7 @@ func toAPIAccess(
 		AccessId:  accessModel.GetID(),
 		ProfileId: accessModel.ProfileID,
 		Partition: partitionObject,
+		State:     toAPIAccessState(accessModel.EffectiveState(time.Now())),
 	}, nil
 }
 
@@ -70,55 +108,66 @@ func toAPIAccessRole(
 func (ab *accessBusiness) GetAccess(
 	ctx context.Context,
 	request *partitionv1.GetAccessRequest) (*partitionv1.AccessObject, error) {
-	var err error
-	var access *models.Access
+	effective, err := ab.getAccess(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	partitionObject := toAPIPartition(effective.partition)
+	if effective.inherited() {
+		partitionObject.Properties[rolePropertyInheritedFrom] = effective.access.PartitionID
+		partitionObject.Properties[accessPropertyExplanation] = effective.explanation()
+	}
+
+	return toAPIAccess(partitionObject, effective.access)
+}
 
+// getAccess loads an access by id, or the access a profile holds in a partition. Without a direct
+// access there, the closest ancestor access granting inheritable roles is returned instead.
+func (ab *accessBusiness) getAccess(
+	ctx context.Context,
+	request *partitionv1.GetAccessRequest) (*effectiveAccess, error) {
 	if request.GetAccessId() != "" {
-		access, err = ab.accessRepo.GetByID(ctx, request.GetAccessId())
+		access, err := ab.accessRepo.GetByID(ctx, request.GetAccessId())
 		if err != nil {
 			return nil, err
 		}
 
-		partition, partitionErr := ab.partitionRepo.GetByID(ctx, access.PartitionID)
-		if partitionErr != nil {
-			return nil, partitionErr
+		partition, err := ab.partitionRepo.GetByID(ctx, access.PartitionID)
+		if err != nil {
+			return nil, err
 		}
 
-		partitionObject := toAPIPartition(partition)
-
-		return toAPIAccess(partitionObject, access)
+		return &effectiveAccess{partition: partition, access: access}, nil
 	}
 
-	var partition *models.Partition
 	partitionID := request.GetPartitionId()
 	if partitionID == "" {
 		partitionID = request.GetClientId()
 	}
 
-	partition, err = ab.partitionRepo.GetByID(ctx, partitionID)
+	partition, err := ab.partitionRepo.GetByID(ctx, partitionID)
 	if err != nil {
 		return nil, err
 	}
 
-	access, err = ab.accessRepo.GetByPartitionAndProfile(ctx, partition.GetID(), request.GetProfileId())
-	if err != nil {
-		return nil, err
-	}
-
-	partitionObject := toAPIPartition(partition)
-
-	return toAPIAccess(partitionObject, access)
+	return ab.resolveEffectiveAccess(ctx, partition, request.GetProfileId())
 }
 
 func (ab *accessBusiness) RemoveAccess(
 	ctx context.Context,
 	request *partitionv1.RemoveAccessRequest) error {
-	err := ab.accessRepo.Delete(ctx, request.GetId())
+	access, err := ab.accessRepo.GetByID(ctx, request.GetId())
+	if err != nil {
+		return err
+	}
+
+	err = ab.accessRepo.Delete(ctx, access.GetID())
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return QueueAccessRelationSync(ctx, ab.service, access)
 }
 
 func (ab *accessBusiness) CreateAccess(
@@ -146,6 +195,10 @@ func (ab *accessBusiness) CreateAccess(
 			return nil, err
 		}
 	} else {
+		if access.State == models.AccessStateRevoked {
+			return ab.regrantAccess(ctx, partition, access)
+		}
+
 		partitionObject := toAPIPartition(partition)
 		return toAPIAccess(partitionObject, access)
 	}
@@ -164,6 +217,12 @@ func (ab *accessBusiness) CreateAccess(
 	}
 
 	logger.WithField("access", access).Debug(" access created")
+
+	err = QueueAccessRelationSync(ctx, ab.service, access)
+	if err != nil {
+		return nil, err
+	}
+
 	partitionObject := toAPIPartition(partition)
 
 	return toAPIAccess(partitionObject, access)
@@ -172,31 +231,16 @@ func (ab *accessBusiness) CreateAccess(
 func (ab *accessBusiness) ListAccessRoles(
 	ctx context.Context,
 	request *partitionv1.ListAccessRoleRequest) (*partitionv1.ListAccessRoleResponse, error) {
-	accessRoleList, err := ab.accessRepo.GetRoles(ctx, request.GetAccessId())
-	if err != nil {
-		return nil, err
-	}
-
-	parititionRoleIDs := make([]string, 0)
-
-	for _, accessR := range accessRoleList {
-		parititionRoleIDs = append(parititionRoleIDs, accessR.PartitionRoleID)
-	}
-
-	partitionRoles, err := ab.partitionRepo.GetRolesByID(ctx, parititionRoleIDs...)
+	// Assignments outside of their validity window or of a removed role are left out,
+	// roles included by the assigned ones are listed along with them.
+	resolvedRoles, err := ab.resolveAccessRoles(ctx, request.GetAccessId())
 	if err != nil {
 		return nil, err
 	}
 
-	partitionRoleIDMap := make(map[string]*partitionv1.PartitionRoleObject)
-	for _, partitionRole := range partitionRoles {
-		partitionRoleIDMap[partitionRole.ID] = toAPIPartitionRole(partitionRole)
-	}
-
-	response := make([]*partitionv1.AccessRoleObject, 0)
-
-	for _, acc := range accessRoleList {
-		response = append(response, toAPIAccessRole(partitionRoleIDMap[acc.PartitionRoleID], acc))
+	response := make([]*partitionv1.AccessRoleObject, 0, len(resolvedRoles))
+	for _, resolved := range resolvedRoles {
+		response = append(response, toAPIResolvedRole(resolved))
 	}
 
 	return &partitionv1.ListAccessRoleResponse{
@@ -204,15 +248,37 @@ func (ab *accessBusiness) ListAccessRoles(
 	}, nil
 }
 
+// toAPIResolvedRole marks a role that is only held through another role with the role that included it.
+func toAPIResolvedRole(resolved *resolvedRole) *partitionv1.AccessRoleObject {
+	partitionRoleObj := toAPIPartitionRole(resolved.role)
+	if resolved.includedBy != nil {
+		partitionRoleObj.Properties[rolePropertyIncludedBy] = resolved.includedBy.GetID()
+	}
+	if resolved.inheritedFrom != nil {
+		partitionRoleObj.Properties[rolePropertyInheritedFrom] = resolved.inheritedFrom.GetID()
+	}
+	return toAPIAccessRole(partitionRoleObj, resolved.accessRole)
+}
+
 func (ab *accessBusiness) RemoveAccessRole(
 	ctx context.Context,
 	request *partitionv1.RemoveAccessRoleRequest) error {
-	err := ab.accessRepo.RemoveRole(ctx, request.GetId())
+	accessRole, err := ab.accessRepo.GetRoleByID(ctx, request.GetId())
+	if err != nil {
+		return err
+	}
+
+	access, err := ab.accessRepo.GetByID(ctx, accessRole.AccessID)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	err = ab.accessRepo.RemoveRole(ctx, accessRole.GetID())
+	if err != nil {
+		return err
+	}
+
+	return QueueAccessRelationSync(ctx, ab.service, access)
 }
 
 func (ab *accessBusiness) CreateAccessRole(
@@ -220,24 +286,67 @@ func (ab *accessBusiness) CreateAccessRole(
 	request *partitionv1.CreateAccessRoleRequest) (*partitionv1.AccessRoleObject, error) {
 	access, err := ab.accessRepo.GetByID(ctx, request.GetAccessId())
 	if err != nil {
+		if frame.ErrorIsNoRows(err) {
+			return nil, status.Errorf(codes.NotFound, "access %s does not exist", request.GetAccessId())
+		}
 		return nil, err
 	}
 
+	if access.State == models.AccessStateRevoked {
+		return nil, status.Errorf(codes.FailedPrecondition, "access %s has been revoked", access.GetID())
+	}
+
 	partitionRoles, err := ab.partitionRepo.GetRolesByID(ctx, request.GetPartitionRoleId())
 	if err != nil {
 		return nil, err
 	}
 
+	if len(partitionRoles) == 0 {
+		return nil, status.Errorf(codes.NotFound, "partition role %s does not exist", request.GetPartitionRoleId())
+	}
+
+	partitionRole := partitionRoles[0]
+	if partitionRole.PartitionID != access.PartitionID {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"partition role %s does not belong to partition %s", partitionRole.GetID(), access.PartitionID)
+	}
+
+	err = ensureGuestEligible(access, partitionRole)
+	if err != nil {
+		return nil, err
+	}
+
+	accessRoles, err := ab.accessRepo.GetRoles(ctx, access.GetID())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, accessRole := range accessRoles {
+		if accessRole.PartitionRoleID == partitionRole.GetID() {
+			return nil, status.Errorf(codes.AlreadyExists,
+				"access %s already holds partition role %s", access.GetID(), partitionRole.GetID())
+		}
+	}
+
 	accessRole := &models.AccessRole{
 		AccessID:        access.GetID(),
-		PartitionRoleID: partitionRoles[0].GetID(),
+		PartitionRoleID: partitionRole.GetID(),
 	}
 
 	err = ab.accessRepo.SaveRole(ctx, accessRole)
+	if err != nil {
+		// A concurrent request may have assigned the same role after the check above.
+		if repository.ErrorIsUniqueViolation(err) {
+			return nil, status.Errorf(codes.AlreadyExists,
+				"access %s already holds partition role %s", access.GetID(), partitionRole.GetID())
+		}
+		return nil, err
+	}
+
+	err = QueueAccessRelationSync(ctx, ab.service, access)
 	if err != nil {
 		return nil, err
 	}
 
-	partitionRoleObj := toAPIPartitionRole(partitionRoles[0])
-	return toAPIAccessRole(partitionRoleObj, accessRole), nil
+	return toAPIAccessRole(toAPIPartitionRole(partitionRole), accessRole), nil
 }
@@ -0,0 +1,451 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+const maxBulkAccessItems = 1000
+
+// BulkAccessItem names a profile within a partition and the partition roles to act on.
+type BulkAccessItem struct {
+	PartitionID string
+	ProfileID   string
+	RoleIDs     []string
+}
+
+// BulkAccessRequest applies one operation to many items, when AllOrNothing is set
+// every item is written in a single transaction and nothing is kept if one fails.
+type BulkAccessRequest struct {
+	Items        []*BulkAccessItem
+	AllOrNothing bool
+	// Reason is recorded on accesses revoked by BulkRevokeAccess.
+	Reason string
+}
+
+// BulkAccessResult is the outcome for the item at Index, Roles holds the role
+// assignments that were added or removed.
+type BulkAccessResult struct {
+	Index       int
+	PartitionID string
+	ProfileID   string
+	Access      *partitionv1.AccessObject
+	Roles       []*partitionv1.AccessRoleObject
+	Err         error
+}
+
+type BulkAccessResponse struct {
+	Results   []*BulkAccessResult
+	Succeeded int
+	Failed    int
+}
+
+// bulkPlan holds what an item will write and the roles needed to report on it.
+type bulkPlan struct {
+	partition     *models.Partition
+	change        *repository.AccessChange
+	roles         []*models.PartitionRole
+	removedRoles  []*models.AccessRole
+	existingRoles map[string]*models.PartitionRole
+}
+
+type bulkReferences struct {
+	partitions map[string]*models.Partition
+	roles      map[string]*models.PartitionRole
+}
+
+func validateBulkRequest(request *BulkAccessRequest) error {
+	if len(request.Items) == 0 {
+		return status.Error(codes.InvalidArgument, "at least one item is required")
+	}
+	if len(request.Items) > maxBulkAccessItems {
+		return status.Errorf(codes.InvalidArgument, "at most %d items are allowed per request", maxBulkAccessItems)
+	}
+	return nil
+}
+
+func (ab *accessBusiness) BulkGrantAccess(
+	ctx context.Context,
+	request *BulkAccessRequest,
+) (*BulkAccessResponse, error) {
+	return ab.bulkApply(ctx, request, ab.planGrant)
+}
+
+func (ab *accessBusiness) BulkRevokeAccess(
+	ctx context.Context,
+	request *BulkAccessRequest,
+) (*BulkAccessResponse, error) {
+	return ab.bulkApply(ctx, request, ab.planRevoke)
+}
+
+func (ab *accessBusiness) bulkApply(
+	ctx context.Context,
+	request *BulkAccessRequest,
+	plan func(context.Context, *BulkAccessRequest, *BulkAccessItem, *bulkReferences) (*bulkPlan, error),
+) (*BulkAccessResponse, error) {
+	err := validateBulkRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	references, err := ab.loadBulkReferences(ctx, request.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*BulkAccessResult, len(request.Items))
+	plans := make([]*bulkPlan, len(request.Items))
+	seen := make(map[string]int, len(request.Items))
+
+	for i, item := range request.Items {
+		results[i] = &BulkAccessResult{Index: i, PartitionID: item.PartitionID, ProfileID: item.ProfileID}
+
+		key := item.PartitionID + "/" + item.ProfileID
+		if first, ok := seen[key]; ok {
+			results[i].Err = status.Errorf(codes.InvalidArgument, "item duplicates item %d", first)
+			continue
+		}
+		seen[key] = i
+
+		plans[i], results[i].Err = plan(ctx, request, item, references)
+	}
+
+	if request.AllOrNothing {
+		ab.applyAllOrNothing(ctx, plans, results)
+	} else {
+		ab.applyEach(ctx, plans, results)
+	}
+
+	response := &BulkAccessResponse{Results: results}
+	for _, result := range results {
+		if result.Err != nil {
+			response.Failed++
+		} else {
+			response.Succeeded++
+		}
+	}
+
+	return response, nil
+}
+
+// loadBulkReferences fetches every partition and role referenced by the items in two queries.
+func (ab *accessBusiness) loadBulkReferences(
+	ctx context.Context,
+	items []*BulkAccessItem,
+) (*bulkReferences, error) {
+	var partitionIDs, roleIDs []string
+	for _, item := range items {
+		partitionIDs = append(partitionIDs, item.PartitionID)
+		roleIDs = append(roleIDs, item.RoleIDs...)
+	}
+
+	slices.Sort(partitionIDs)
+	slices.Sort(roleIDs)
+
+	references := &bulkReferences{
+		partitions: make(map[string]*models.Partition),
+		roles:      make(map[string]*models.PartitionRole),
+	}
+
+	partitions, err := ab.partitionRepo.GetByIDs(ctx, slices.Compact(partitionIDs)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, partition := range partitions {
+		references.partitions[partition.GetID()] = partition
+	}
+
+	roleIDs = slices.Compact(roleIDs)
+	if len(roleIDs) > 0 {
+		roles, roleErr := ab.partitionRepo.GetRolesByID(ctx, roleIDs...)
+		if roleErr != nil {
+			return nil, roleErr
+		}
+		for _, role := range roles {
+			references.roles[role.GetID()] = role
+		}
+	}
+
+	return references, nil
+}
+
+// itemRoles resolves the partition roles named by an item, they must belong to its partition.
+func (references *bulkReferences) itemRoles(item *BulkAccessItem) ([]*models.PartitionRole, error) {
+	roles := make([]*models.PartitionRole, 0, len(item.RoleIDs))
+	for _, roleID := range item.RoleIDs {
+		role, ok := references.roles[roleID]
+		if !ok {
+			return nil, status.Errorf(codes.NotFound, "partition role %s does not exist", roleID)
+		}
+		if role.PartitionID != item.PartitionID {
+			return nil, status.Errorf(codes.FailedPrecondition,
+				"partition role %s does not belong to partition %s", roleID, item.PartitionID)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func (references *bulkReferences) itemPartition(item *BulkAccessItem) (*models.Partition, error) {
+	if item.PartitionID == "" || item.ProfileID == "" {
+		return nil, status.Error(codes.InvalidArgument, "partition id and profile id are required")
+	}
+
+	partition, ok := references.partitions[item.PartitionID]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "partition %s does not exist", item.PartitionID)
+	}
+	return partition, nil
+}
+
+// planGrant makes sure the profile has an active access carrying every requested role,
+// a revoked access is granted afresh without the roles it held before.
+func (ab *accessBusiness) planGrant(
+	ctx context.Context,
+	_ *BulkAccessRequest,
+	item *BulkAccessItem,
+	references *bulkReferences,
+) (*bulkPlan, error) {
+	partition, err := references.itemPartition(item)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := references.itemRoles(item)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &bulkPlan{partition: partition}
+	change := &repository.AccessChange{}
+
+	access, err := ab.accessRepo.GetByPartitionAndProfile(ctx, partition.GetID(), item.ProfileID)
+	switch {
+	case err == nil:
+		change.Access = access
+		change.ExpectedState = access.State
+	case frame.ErrorIsNoRows(err):
+		change.Access = &models.Access{
+			ProfileID: item.ProfileID,
+			BaseModel: frame.BaseModel{
+				TenantID:    partition.TenantID,
+				PartitionID: partition.GetID(),
+			},
+		}
+	default:
+		return nil, err
+	}
+
+	assigned := make(map[string]bool)
+	if access != nil && access.State == models.AccessStateRevoked {
+		err = planRegrant(ctx, ab.accessRepo, change)
+		if err != nil {
+			return nil, err
+		}
+	} else if access != nil {
+		accessRoles, rolesErr := ab.accessRepo.GetRoles(ctx, access.GetID())
+		if rolesErr != nil {
+			return nil, rolesErr
+		}
+		for _, accessRole := range accessRoles {
+			assigned[accessRole.PartitionRoleID] = true
+		}
+	}
+
+	for _, role := range roles {
+		if assigned[role.GetID()] {
+			continue
+		}
+		assigned[role.GetID()] = true
+
+		err = ensureGuestEligible(change.Access, role)
+		if err != nil {
+			return nil, err
+		}
+
+		change.AddRoles = append(change.AddRoles, &models.AccessRole{PartitionRoleID: role.GetID()})
+		plan.roles = append(plan.roles, role)
+	}
+
+	plan.change = change
+	return plan, nil
+}
+
+// planRegrant reactivates a revoked access, roles held before the revocation are dropped.
+func planRegrant(
+	ctx context.Context,
+	accessRepo repository.AccessRepository,
+	change *repository.AccessChange,
+) error {
+	accessRoles, err := accessRepo.GetRoles(ctx, change.Access.GetID())
+	if err != nil {
+		return err
+	}
+
+	for _, accessRole := range accessRoles {
+		change.RemoveRoleIDs = append(change.RemoveRoleIDs, accessRole.GetID())
+	}
+
+	change.Access.State = models.AccessStateActive
+	change.Access.StateReason = ""
+	change.Access.HomeTenantID = ""
+	change.Access.SponsorProfileID = ""
+	return nil
+}
+
+// planRevoke removes the listed roles from an access, or revokes the whole access
+// when no roles are listed.
+func (ab *accessBusiness) planRevoke(
+	ctx context.Context,
+	request *BulkAccessRequest,
+	item *BulkAccessItem,
+	references *bulkReferences,
+) (*bulkPlan, error) {
+	partition, err := references.itemPartition(item)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := references.itemRoles(item)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := ab.accessRepo.GetByPartitionAndProfile(ctx, partition.GetID(), item.ProfileID)
+	if err != nil {
+		if frame.ErrorIsNoRows(err) {
+			return nil, status.Errorf(codes.NotFound, "profile %s has no access to partition %s",
+				item.ProfileID, partition.GetID())
+		}
+		return nil, err
+	}
+
+	plan := &bulkPlan{partition: partition, existingRoles: make(map[string]*models.PartitionRole)}
+	change := &repository.AccessChange{Access: access, ExpectedState: access.State}
+
+	if len(roles) == 0 {
+		// Revoking an already revoked access is a no-op so that retried requests succeed.
+		if access.State != models.AccessStateRevoked {
+			if !access.State.CanTransitionTo(models.AccessStateRevoked) {
+				return nil, status.Errorf(codes.FailedPrecondition, "access %s can not move from %s to %s",
+					access.GetID(), access.State, models.AccessStateRevoked)
+			}
+
+			access.State = models.AccessStateRevoked
+			access.StateReason = request.Reason
+		}
+		plan.change = change
+		return plan, nil
+	}
+
+	accessRoles, err := ab.accessRepo.GetRoles(ctx, access.GetID())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range roles {
+		plan.existingRoles[role.GetID()] = role
+	}
+	for _, accessRole := range accessRoles {
+		if _, ok := plan.existingRoles[accessRole.PartitionRoleID]; ok {
+			change.RemoveRoleIDs = append(change.RemoveRoleIDs, accessRole.GetID())
+			plan.removedRoles = append(plan.removedRoles, accessRole)
+		}
+	}
+
+	plan.change = change
+	return plan, nil
+}
+
+// accessChangeError asks the caller to retry a change that lost the race with another change to the access.
+func accessChangeError(err error, access *models.Access) error {
+	if errors.Is(err, repository.ErrAccessChanged) {
+		return status.Errorf(codes.Aborted, "access %s changed while applying, try again", access.GetID())
+	}
+	return err
+}
+
+// applyAllOrNothing writes every planned change in one transaction, unless an item
+// already failed in which case nothing is written at all.
+func (ab *accessBusiness) applyAllOrNothing(ctx context.Context, plans []*bulkPlan, results []*BulkAccessResult) {
+	failed := slices.IndexFunc(results, func(result *BulkAccessResult) bool { return result.Err != nil })
+	if failed >= 0 {
+		for _, result := range results {
+			if result.Err == nil {
+				result.Err = status.Errorf(codes.Aborted, "not applied because item %d failed", failed)
+			}
+		}
+		return
+	}
+
+	changes := make([]*repository.AccessChange, 0, len(plans))
+	for _, plan := range plans {
+		changes = append(changes, plan.change)
+	}
+
+	err := ab.accessRepo.ApplyChanges(ctx, changes...)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccessChanged) {
+			err = status.Error(codes.Aborted, "an access changed while applying the bulk transaction, try again")
+		} else {
+			err = fmt.Errorf("bulk transaction failed: %w", err)
+		}
+		for _, result := range results {
+			result.Err = err
+		}
+		return
+	}
+
+	for i, plan := range plans {
+		ab.completeBulkItem(ctx, plan, results[i])
+	}
+}
+
+func (ab *accessBusiness) applyEach(ctx context.Context, plans []*bulkPlan, results []*BulkAccessResult) {
+	for i, plan := range plans {
+		if results[i].Err != nil {
+			continue
+		}
+
+		err := ab.accessRepo.ApplyChanges(ctx, plan.change)
+		if err != nil {
+			results[i].Err = accessChangeError(err, plan.change.Access)
+			continue
+		}
+
+		ab.completeBulkItem(ctx, plan, results[i])
+	}
+}
+
+// completeBulkItem fills in the result of an applied item and queues its relations for sync,
+// a failed sync is only logged as the reconciliation on start up catches it later.
+func (ab *accessBusiness) completeBulkItem(ctx context.Context, plan *bulkPlan, result *BulkAccessResult) {
+	access := plan.change.Access
+
+	err := QueueAccessRelationSync(ctx, ab.service, access)
+	if err != nil {
+		ab.service.Log(ctx).WithError(err).WithField("access_id", access.GetID()).
+			Warn("could not queue access relation sync")
+	}
+
+	result.Access, result.Err = toAPIAccess(toAPIPartition(plan.partition), access)
+
+	for i, accessRole := range plan.change.AddRoles {
+		result.Roles = append(result.Roles, toAPIAccessRole(toAPIPartitionRole(plan.roles[i]), accessRole))
+	}
+
+	for _, accessRole := range plan.removedRoles {
+		result.Roles = append(result.Roles,
+			toAPIAccessRole(toAPIPartitionRole(plan.existingRoles[accessRole.PartitionRoleID]), accessRole))
+	}
+}
@@ -0,0 +1,93 @@
+package business_test
+
+import (
+	"testing"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type BulkAccessTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (b *BulkAccessTestSuite) TestBulkGrantAndRevokeAccess() {
+	b.WithTestDependancies(b.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := b.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+
+		role := &models.PartitionRole{Name: "clerk"}
+		partition := b.CreatePartition(t, svc, nil, role)
+
+		response, err := accessBusiness.BulkGrantAccess(ctx, &business.BulkAccessRequest{
+			Items: []*business.BulkAccessItem{
+				{PartitionID: partition.GetID(), ProfileID: "bulk-1", RoleIDs: []string{role.GetID()}},
+				{PartitionID: partition.GetID(), ProfileID: "bulk-2", RoleIDs: []string{"missing-role"}},
+				{PartitionID: partition.GetID(), ProfileID: "bulk-3"},
+			},
+			AllOrNothing: true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, response.Failed)
+		assert.Equal(t, codes.Aborted, status.Code(response.Results[0].Err))
+		assert.Equal(t, codes.NotFound, status.Code(response.Results[1].Err))
+
+		_, err = accessBusiness.GetAccess(ctx, &partitionv1.GetAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "bulk-1",
+		})
+		require.Error(t, err, "nothing should be written when an all or nothing request fails")
+
+		response, err = accessBusiness.BulkGrantAccess(ctx, &business.BulkAccessRequest{
+			Items: []*business.BulkAccessItem{
+				{PartitionID: partition.GetID(), ProfileID: "bulk-1", RoleIDs: []string{role.GetID()}},
+				{PartitionID: partition.GetID(), ProfileID: "bulk-2", RoleIDs: []string{"missing-role"}},
+				{PartitionID: partition.GetID(), ProfileID: "bulk-3"},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, response.Succeeded)
+		assert.Equal(t, 1, response.Failed)
+		require.Len(t, response.Results[0].Roles, 1)
+
+		roles, err := accessBusiness.ListAccessRoles(ctx, &partitionv1.ListAccessRoleRequest{
+			AccessId: response.Results[0].Access.GetAccessId(),
+		})
+		require.NoError(t, err)
+		assert.Len(t, roles.GetRole(), 1)
+
+		response, err = accessBusiness.BulkRevokeAccess(ctx, &business.BulkAccessRequest{
+			Items: []*business.BulkAccessItem{
+				{PartitionID: partition.GetID(), ProfileID: "bulk-1", RoleIDs: []string{role.GetID()}},
+				{PartitionID: partition.GetID(), ProfileID: "bulk-3"},
+			},
+			AllOrNothing: true,
+			Reason:       "offboarding",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, response.Succeeded)
+		require.Len(t, response.Results[0].Roles, 1)
+
+		revoked, err := accessBusiness.GetActiveAccess(ctx, &partitionv1.GetAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "bulk-3",
+		})
+		require.Error(t, err)
+		assert.Nil(t, revoked)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+}
+
+// TestBulkAccess runs the bulk access grants and revocations test suite.
+func TestBulkAccess(t *testing.T) {
+	suite.Run(t, new(BulkAccessTestSuite))
+}
@@ -0,0 +1,293 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/config"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PermissionContext describes the request a permission is checked for, role assignment
+// conditions are evaluated against it.
+type PermissionContext struct {
+	// Time defaults to the time of the check.
+	Time     time.Time
+	SourceIP string
+	// Claims are the claims of the caller's token, such as `amr` for the authentication methods used.
+	Claims            map[string]any
+	ProfileAttributes map[string]any
+}
+
+// conditionEnvironment declares what a condition can refer to:
+// `now`, `source_ip`, `claims`, `profile` and the `inCIDR(ip, cidr)` function.
+// For example `now.getHours("Africa/Nairobi") < 17 && inCIDR(source_ip, "10.0.0.0/8")`.
+func conditionEnvironment() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("now", cel.TimestampType),
+		cel.Variable("source_ip", cel.StringType),
+		cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("profile", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Function("inCIDR",
+			cel.Overload("in_cidr_string_string",
+				[]*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(inCIDR))),
+	)
+}
+
+func inCIDR(ipVal ref.Val, cidrVal ref.Val) ref.Val {
+	ip, ok := ipVal.Value().(string)
+	if !ok {
+		return types.NewErr("inCIDR expects the ip as a string")
+	}
+
+	cidr, ok := cidrVal.Value().(string)
+	if !ok {
+		return types.NewErr("inCIDR expects the cidr as a string")
+	}
+
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return types.NewErr("invalid cidr %s: %v", cidr, err)
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return types.False
+	}
+
+	return types.Bool(prefix.Contains(addr.Unmap()))
+}
+
+// conditionInputMaxSize is the size cost estimation assumes for the claims, the profile attributes
+// and the strings in them, without it every comprehension over them is estimated as unbounded.
+const conditionInputMaxSize = 100
+
+type conditionSizeEstimator struct{}
+
+func (conditionSizeEstimator) EstimateSize(element checker.AstNode) *checker.SizeEstimate {
+	if len(element.Path()) == 0 {
+		return nil
+	}
+	return &checker.SizeEstimate{Min: 0, Max: conditionInputMaxSize}
+}
+
+func (conditionSizeEstimator) EstimateCallCost(
+	_ string,
+	_ string,
+	_ *checker.AstNode,
+	_ []checker.AstNode,
+) *checker.CallEstimate {
+	return nil
+}
+
+// compileCondition rejects conditions whose estimated cost is above maxCost, evaluation stops once it
+// costs more than maxCost as well.
+func compileCondition(env *cel.Env, condition string, maxCost uint64) (cel.Program, error) {
+	ast, issues := env.Compile(condition)
+	if issues != nil && issues.Err() != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid condition: %v", issues.Err())
+	}
+
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, status.Errorf(codes.InvalidArgument, "condition must evaluate to a bool, not %s",
+			ast.OutputType())
+	}
+
+	cost, err := env.EstimateCost(ast, conditionSizeEstimator{})
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid condition: %v", err)
+	}
+	if cost.Max > maxCost {
+		return nil, status.Errorf(codes.InvalidArgument, "condition may cost up to %d to evaluate, more than %d",
+			cost.Max, maxCost)
+	}
+
+	program, err := env.Program(ast, cel.CostLimit(maxCost))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid condition: %v", err)
+	}
+
+	return program, nil
+}
+
+// conditionEvaluator compiles each distinct condition once for the duration of a check.
+type conditionEvaluator struct {
+	env        *cel.Env
+	activation map[string]any
+	programs   map[string]cel.Program
+	maxCost    uint64
+}
+
+func newConditionEvaluator(permissionContext *PermissionContext, maxCost uint64) (*conditionEvaluator, error) {
+	env, err := conditionEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	if permissionContext == nil {
+		permissionContext = &PermissionContext{}
+	}
+
+	now := permissionContext.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	claims := permissionContext.Claims
+	if claims == nil {
+		claims = map[string]any{}
+	}
+
+	profile := permissionContext.ProfileAttributes
+	if profile == nil {
+		profile = map[string]any{}
+	}
+
+	return &conditionEvaluator{
+		env: env,
+		activation: map[string]any{
+			"now":       now,
+			"source_ip": permissionContext.SourceIP,
+			"claims":    claims,
+			"profile":   profile,
+		},
+		programs: make(map[string]cel.Program),
+		maxCost:  maxCost,
+	}, nil
+}
+
+// holds evaluates a condition, a condition that can not be evaluated does not hold.
+func (ce *conditionEvaluator) holds(condition string) (bool, error) {
+	if strings.TrimSpace(condition) == "" {
+		return true, nil
+	}
+
+	program, ok := ce.programs[condition]
+	if !ok {
+		var err error
+		program, err = compileCondition(ce.env, condition, ce.maxCost)
+		if err != nil {
+			return false, err
+		}
+		ce.programs[condition] = program
+	}
+
+	out, _, err := program.Eval(ce.activation)
+	if err != nil {
+		return false, err
+	}
+
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("condition evaluated to %v instead of a bool", out.Value())
+	}
+
+	return result, nil
+}
+
+// applyConditions drops the roles whose assignment condition does not hold for the request,
+// returning why each of them was left out.
+func applyConditions(
+	resolvedRoles []*resolvedRole,
+	permissionContext *PermissionContext,
+	maxCost uint64,
+) ([]*resolvedRole, []string, error) {
+	evaluator, err := newConditionEvaluator(permissionContext, maxCost)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	applicable := make([]*resolvedRole, 0, len(resolvedRoles))
+	var excluded []string
+	for _, resolved := range resolvedRoles {
+		holds, evalErr := evaluator.holds(resolved.accessRole.Condition)
+		if evalErr != nil {
+			excluded = append(excluded, fmt.Sprintf("%s (condition failed: %v)", resolved.role.Name, evalErr))
+			continue
+		}
+		if !holds {
+			excluded = append(excluded, fmt.Sprintf("%s (condition not met)", resolved.role.Name))
+			continue
+		}
+		applicable = append(applicable, resolved)
+	}
+
+	return applicable, excluded, nil
+}
+
+// SetAccessRoleCondition restricts a role assignment to requests matching a CEL condition,
+// an empty condition makes the assignment unconditional again.
+func (ab *accessBusiness) SetAccessRoleCondition(
+	ctx context.Context,
+	accessRoleID string,
+	condition string,
+) (*partitionv1.AccessRoleObject, error) {
+	cfg, ok := ab.service.Config().(*config.PartitionConfig)
+	if !ok {
+		return nil, errors.New("invalid configuration type")
+	}
+
+	condition = strings.TrimSpace(condition)
+	if condition != "" {
+		env, err := conditionEnvironment()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = compileCondition(env, condition, cfg.AccessConditionMaxCost)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	accessRole, err := ab.accessRepo.GetRoleByID(ctx, accessRoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := ab.accessRepo.GetByID(ctx, accessRole.AccessID)
+	if err != nil {
+		return nil, err
+	}
+
+	partitionRoles, err := ab.partitionRepo.GetRolesByID(ctx, accessRole.PartitionRoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessRole.Condition = condition
+	err = ab.accessRepo.SaveRole(ctx, accessRole)
+	if err != nil {
+		return nil, err
+	}
+
+	// Conditional assignments are not mirrored on keto, so the relations need refreshing.
+	err = QueueAccessRelationSync(ctx, ab.service, access)
+	if err != nil {
+		return nil, err
+	}
+
+	var partitionRoleObj *partitionv1.PartitionRoleObject
+	if len(partitionRoles) > 0 {
+		partitionRoleObj = toAPIPartitionRole(partitionRoles[0])
+	}
+
+	return toAPIAccessRole(partitionRoleObj, accessRole), nil
+}
+
+// isConditional reports whether an assignment only applies to some requests.
+func isConditional(accessRole *models.AccessRole) bool {
+	return strings.TrimSpace(accessRole.Condition) != ""
+}
@@ -0,0 +1,159 @@
+package business_test
+
+import (
+	"testing"
+	"time"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/config"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type AccessConditionTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (c *AccessConditionTestSuite) TestCheckPermissionConditions() {
+	c.WithTestDependancies(c.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := c.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+
+		role := &models.PartitionRole{
+			Name:        "treasury",
+			Permissions: []string{"payments:approve"},
+		}
+		partition := c.CreatePartition(t, svc, nil, role)
+
+		access, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "treasury-profile",
+		})
+		require.NoError(t, err)
+
+		accessRole, err := accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+			AccessId:        access.GetAccessId(),
+			PartitionRoleId: role.GetID(),
+		})
+		require.NoError(t, err)
+
+		_, err = accessBusiness.SetAccessRoleCondition(ctx, accessRole.GetAccessRoleId(), "now.getHours( <")
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		_, err = accessBusiness.SetAccessRoleCondition(ctx, accessRole.GetAccessRoleId(), "source_ip")
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "a condition must be a bool")
+
+		condition := `now.getHours("UTC") >= 8 && now.getHours("UTC") < 17 && ` +
+			`inCIDR(source_ip, "10.1.0.0/16") && "mfa" in claims.amr`
+		_, err = accessBusiness.SetAccessRoleCondition(ctx, accessRole.GetAccessRoleId(), condition)
+		require.NoError(t, err)
+
+		businessHours := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+		testCases := []struct {
+			name    string
+			context *business.PermissionContext
+			allowed bool
+		}{
+			{
+				name: "office network during business hours with mfa",
+				context: &business.PermissionContext{
+					Time: businessHours, SourceIP: "10.1.4.20", Claims: map[string]any{"amr": []any{"pwd", "mfa"}},
+				},
+				allowed: true,
+			},
+			{
+				name: "outside business hours",
+				context: &business.PermissionContext{
+					Time: businessHours.Add(10 * time.Hour), SourceIP: "10.1.4.20",
+					Claims: map[string]any{"amr": []any{"mfa"}},
+				},
+			},
+			{
+				name: "outside the office network",
+				context: &business.PermissionContext{
+					Time: businessHours, SourceIP: "192.168.1.5", Claims: map[string]any{"amr": []any{"mfa"}},
+				},
+			},
+			{
+				name: "missing mfa claim",
+				context: &business.PermissionContext{
+					Time: businessHours, SourceIP: "10.1.4.20",
+				},
+			},
+			{
+				name: "no request context",
+			},
+		}
+
+		for _, tt := range testCases {
+			t.Run(tt.name, func(t *testing.T) {
+				decision, checkErr := accessBusiness.CheckPermission(ctx, &business.CheckPermissionRequest{
+					ProfileID:   "treasury-profile",
+					PartitionID: partition.GetID(),
+					Permission:  "payments:approve",
+					Context:     tt.context,
+				})
+				require.NoError(t, checkErr)
+				assert.Equal(t, tt.allowed, decision.Allowed)
+				if !tt.allowed {
+					require.Len(t, decision.ConditionsNotMet, 1)
+					assert.Contains(t, decision.Reason, "treasury")
+				}
+			})
+		}
+
+		_, err = accessBusiness.SetAccessRoleCondition(ctx, accessRole.GetAccessRoleId(),
+			`claims.all(a, claims.all(b, claims.all(c, a != b)))`)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "a condition can not cost more than the limit")
+
+		// The estimate assumes a bounded number of claims, evaluation stops at the limit when there are more.
+		cfg, ok := svc.Config().(*config.PartitionConfig)
+		require.True(t, ok)
+		cfg.AccessConditionMaxCost = 1000
+
+		_, err = accessBusiness.SetAccessRoleCondition(ctx, accessRole.GetAccessRoleId(),
+			`claims.amr.exists(m, m == "mfa")`)
+		require.NoError(t, err)
+
+		methods := make([]any, 0, 10000)
+		for len(methods) < cap(methods)-1 {
+			methods = append(methods, "pwd")
+		}
+		methods = append(methods, "mfa")
+
+		decision, err := accessBusiness.CheckPermission(ctx, &business.CheckPermissionRequest{
+			ProfileID:   "treasury-profile",
+			PartitionID: partition.GetID(),
+			Permission:  "payments:approve",
+			Context:     &business.PermissionContext{Claims: map[string]any{"amr": methods}},
+		})
+		require.NoError(t, err)
+		assert.False(t, decision.Allowed)
+		require.Len(t, decision.ConditionsNotMet, 1)
+		assert.Contains(t, decision.ConditionsNotMet[0], "cost limit")
+
+		_, err = accessBusiness.SetAccessRoleCondition(ctx, accessRole.GetAccessRoleId(), "")
+		require.NoError(t, err)
+
+		decision, err = accessBusiness.CheckPermission(ctx, &business.CheckPermissionRequest{
+			ProfileID:   "treasury-profile",
+			PartitionID: partition.GetID(),
+			Permission:  "payments:approve",
+		})
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed, "clearing the condition makes the role unconditional")
+	})
+}
+
+// TestAccessConditions runs the conditional role assignment test suite.
+func TestAccessConditions(t *testing.T) {
+	suite.Run(t, new(AccessConditionTestSuite))
+}
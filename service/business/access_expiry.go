@@ -0,0 +1,259 @@
+package business
+
+import (
+	"context"
+	"time"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+const defaultMaxExpiriesPerBatch = 100
+
+func validateValidity(validFrom *time.Time, validUntil *time.Time) error {
+	if validFrom != nil && validUntil != nil && !validUntil.After(*validFrom) {
+		return status.Error(codes.InvalidArgument, "valid_until must be after valid_from")
+	}
+	return nil
+}
+
+func (ab *accessBusiness) SetAccessValidity(
+	ctx context.Context,
+	accessID string,
+	validFrom *time.Time,
+	validUntil *time.Time,
+) (*partitionv1.AccessObject, error) {
+	err := validateValidity(validFrom, validUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := ab.accessRepo.GetByID(ctx, accessID)
+	if err != nil {
+		return nil, err
+	}
+
+	if access.State == models.AccessStateRevoked {
+		return nil, status.Errorf(codes.FailedPrecondition, "access %s has been revoked", accessID)
+	}
+
+	partition, err := ab.partitionRepo.GetByID(ctx, access.PartitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	access.ValidFrom = validFrom
+	access.ValidUntil = validUntil
+
+	target := access.State
+	// Extending the validity of an expired access brings back the state it expired in,
+	// a suspended access stays suspended.
+	if access.State == models.AccessStateExpired && (validUntil == nil || validUntil.After(time.Now())) {
+		target = access.StateBeforeExpiry
+		if !access.State.CanTransitionTo(target) {
+			return nil, status.Errorf(codes.FailedPrecondition,
+				"access %s can not move from %s to %s", access.GetID(), access.State, target)
+		}
+	}
+
+	return ab.saveAccessState(ctx, partition, access, target, access.StateReason)
+}
+
+func (ab *accessBusiness) SetAccessRoleValidity(
+	ctx context.Context,
+	accessRoleID string,
+	validFrom *time.Time,
+	validUntil *time.Time,
+) (*partitionv1.AccessRoleObject, error) {
+	err := validateValidity(validFrom, validUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	accessRole, err := ab.accessRepo.GetRoleByID(ctx, accessRoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := ab.accessRepo.GetByID(ctx, accessRole.AccessID)
+	if err != nil {
+		return nil, err
+	}
+
+	partitionRoles, err := ab.partitionRepo.GetRolesByID(ctx, accessRole.PartitionRoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessRole.ValidFrom = validFrom
+	accessRole.ValidUntil = validUntil
+	// Extending the validity of an expired assignment brings it back into force.
+	if validUntil == nil || validUntil.After(time.Now()) {
+		accessRole.ExpiredAt = nil
+	}
+
+	err = ab.accessRepo.SaveRole(ctx, accessRole)
+	if err != nil {
+		return nil, err
+	}
+
+	err = QueueAccessRelationSync(ctx, ab.service, access)
+	if err != nil {
+		return nil, err
+	}
+
+	var partitionRoleObj *partitionv1.PartitionRoleObject
+	if len(partitionRoles) > 0 {
+		partitionRoleObj = toAPIPartitionRole(partitionRoles[0])
+	}
+
+	return toAPIAccessRole(partitionRoleObj, accessRole), nil
+}
+
+// ExpireTimeBoundAccess moves accesses and role assignments whose validity has ended
+// out of force, emitting an event for each, and reports how many rows it changed.
+// Rows are changed conditionally, so replicas running it at the same time expire each row once.
+func ExpireTimeBoundAccess(ctx context.Context, service *frame.Service) (int, error) {
+	accessRepo := repository.NewAccessRepository(service)
+	now := time.Now()
+	changed := 0
+
+	for {
+		accessList, err := accessRepo.GetExpired(ctx, now, defaultMaxExpiriesPerBatch)
+		if err != nil {
+			return changed, err
+		}
+
+		for _, access := range accessList {
+			expired, expireErr := expireAccess(ctx, service, accessRepo, access, now)
+			if expireErr != nil {
+				return changed, expireErr
+			}
+			if expired {
+				changed++
+			}
+		}
+
+		if len(accessList) < defaultMaxExpiriesPerBatch {
+			break
+		}
+	}
+
+	for {
+		accessRoles, err := accessRepo.GetExpiredRoles(ctx, now, defaultMaxExpiriesPerBatch)
+		if err != nil {
+			return changed, err
+		}
+
+		for _, accessRole := range accessRoles {
+			expired, expireErr := expireAccessRole(ctx, service, accessRepo, accessRole, now)
+			if expireErr != nil {
+				return changed, expireErr
+			}
+			if expired {
+				changed++
+			}
+		}
+
+		if len(accessRoles) < defaultMaxExpiriesPerBatch {
+			return changed, nil
+		}
+	}
+}
+
+func expireAccess(
+	ctx context.Context,
+	service *frame.Service,
+	accessRepo repository.AccessRepository,
+	access *models.Access,
+	at time.Time,
+) (bool, error) {
+	expired, err := accessRepo.Expire(ctx, access, at)
+	if err != nil || !expired {
+		return false, err
+	}
+
+	err = QueueAccessRelationSync(ctx, service, access)
+	if err != nil {
+		return true, err
+	}
+
+	return true, PublishAccessEvent(ctx, service, &AccessEvent{
+		Type:        EventAccessExpired,
+		TenantID:    access.TenantID,
+		PartitionID: access.PartitionID,
+		ProfileID:   access.ProfileID,
+		AccessID:    access.GetID(),
+	})
+}
+
+// expireAccessRole marks a lapsed role assignment as expired, the row is kept so that its validity can be extended.
+func expireAccessRole(
+	ctx context.Context,
+	service *frame.Service,
+	accessRepo repository.AccessRepository,
+	accessRole *models.AccessRole,
+	at time.Time,
+) (bool, error) {
+	expired, err := accessRepo.ExpireRole(ctx, accessRole, at)
+	if err != nil || !expired {
+		return false, err
+	}
+
+	access, err := accessRepo.GetByID(ctx, accessRole.AccessID)
+	if err != nil {
+		if frame.ErrorIsNoRows(err) {
+			return true, nil
+		}
+		return true, err
+	}
+
+	err = QueueAccessRelationSync(ctx, service, access)
+	if err != nil {
+		return true, err
+	}
+
+	return true, PublishAccessEvent(ctx, service, &AccessEvent{
+		Type:         EventAccessRoleExpired,
+		TenantID:     access.TenantID,
+		PartitionID:  access.PartitionID,
+		ProfileID:    access.ProfileID,
+		AccessID:     access.GetID(),
+		AccessRoleID: accessRole.GetID(),
+		Attributes:   map[string]string{"partition_role_id": accessRole.PartitionRoleID},
+	})
+}
+
+// RunAccessExpiryJob periodically expires time bound access until the context is done,
+// an interval that is not positive disables the job.
+func RunAccessExpiryJob(ctx context.Context, service *frame.Service, interval time.Duration) {
+	logger := service.Log(ctx)
+
+	if interval <= 0 {
+		logger.WithField("interval", interval).Warn("access expiry job is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		changed, err := ExpireTimeBoundAccess(ctx, service)
+		if err != nil {
+			logger.WithError(err).Error("could not expire time bound access")
+		} else if changed > 0 {
+			logger.WithField("expired", changed).Debug("expired time bound access")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
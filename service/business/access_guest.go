@@ -0,0 +1,241 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/config"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+// CreateGuestAccessRequest lets a member sponsor a profile of another tenant into a partition.
+type CreateGuestAccessRequest struct {
+	PartitionID      string
+	ProfileID        string
+	HomeTenantID     string
+	SponsorProfileID string
+	RoleIDs          []string
+	// ValidUntil defaults to the configured guest access validity.
+	ValidUntil *time.Time
+}
+
+// ensureGuestEligible refuses to give a guest a role that is not open to guests.
+func ensureGuestEligible(access *models.Access, partitionRole *models.PartitionRole) error {
+	if !access.IsGuest() || partitionRole.GuestEligible {
+		return nil
+	}
+
+	return status.Errorf(codes.FailedPrecondition, "partition role %s can not be held by guests",
+		partitionRole.GetID())
+}
+
+// guestEligibleRoles drops the roles a guest holds that have since been closed to guests.
+func guestEligibleRoles(resolvedRoles []*resolvedRole) []*resolvedRole {
+	eligible := make([]*resolvedRole, 0, len(resolvedRoles))
+	for _, resolved := range resolvedRoles {
+		if resolved.role.GuestEligible {
+			eligible = append(eligible, resolved)
+		}
+	}
+	return eligible
+}
+
+func guestValidity(service *frame.Service, validUntil *time.Time) (*time.Time, error) {
+	now := time.Now()
+	if validUntil != nil {
+		if !validUntil.After(now) {
+			return nil, status.Error(codes.InvalidArgument, "guest access must be valid until a future time")
+		}
+		return validUntil, nil
+	}
+
+	cfg, ok := service.Config().(*config.PartitionConfig)
+	if !ok {
+		return nil, errors.New("invalid configuration type")
+	}
+
+	expiresAt := now.Add(cfg.GuestAccessValidity)
+	return &expiresAt, nil
+}
+
+// ensureSponsor checks that the sponsor is an active member of the partition, guests can not sponsor guests.
+func (ab *accessBusiness) ensureSponsor(ctx context.Context, partition *models.Partition, sponsorID string) error {
+	if sponsorID == "" {
+		return status.Error(codes.InvalidArgument, "a sponsor is required for guest access")
+	}
+
+	effective, err := ab.resolveEffectiveAccess(ctx, partition, sponsorID)
+	if err != nil {
+		if frame.ErrorIsNoRows(err) {
+			return status.Errorf(codes.PermissionDenied, "sponsor %s has no access to partition %s",
+				sponsorID, partition.GetID())
+		}
+		return err
+	}
+
+	if !effective.access.IsActive() || effective.access.IsGuest() {
+		return status.Errorf(codes.PermissionDenied, "sponsor %s is not an active member of partition %s",
+			sponsorID, partition.GetID())
+	}
+
+	return nil
+}
+
+// CreateGuestAccess grants a profile from another tenant access to a partition. Guests may only
+// hold guest eligible roles and their access expires, by default after the configured validity.
+func (ab *accessBusiness) CreateGuestAccess(
+	ctx context.Context,
+	request *CreateGuestAccessRequest,
+) (*AccessEntry, error) {
+	if request.ProfileID == "" {
+		return nil, status.Error(codes.InvalidArgument, "profile is required")
+	}
+
+	partition, err := ab.partitionRepo.GetByID(ctx, request.PartitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	homeTenant, err := ab.tenantRepo.GetByID(ctx, request.HomeTenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if homeTenant.GetID() == partition.TenantID {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"profiles of tenant %s are members of partition %s, not guests", homeTenant.GetID(), partition.GetID())
+	}
+
+	err = ab.ensureSponsor(ctx, partition, request.SponsorProfileID)
+	if err != nil {
+		return nil, err
+	}
+
+	validUntil, err := guestValidity(ab.service, request.ValidUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &repository.AccessChange{}
+	access, err := ab.accessRepo.GetByPartitionAndProfile(ctx, partition.GetID(), request.ProfileID)
+	switch {
+	case err == nil:
+		if access.State != models.AccessStateRevoked {
+			return nil, status.Errorf(codes.AlreadyExists, "profile %s already has access %s to partition %s",
+				request.ProfileID, access.GetID(), partition.GetID())
+		}
+
+		// A revoked access is reused, without the roles it held before.
+		change.Access = access
+		change.ExpectedState = access.State
+		err = planRegrant(ctx, ab.accessRepo, change)
+		if err != nil {
+			return nil, err
+		}
+	case frame.ErrorIsNoRows(err):
+		access = &models.Access{
+			ProfileID: request.ProfileID,
+			BaseModel: frame.BaseModel{
+				TenantID:    partition.TenantID,
+				PartitionID: partition.GetID(),
+			},
+		}
+	default:
+		return nil, err
+	}
+
+	access.State = models.AccessStateActive
+	access.HomeTenantID = homeTenant.GetID()
+	access.SponsorProfileID = request.SponsorProfileID
+	access.ValidUntil = validUntil
+	change.Access = access
+
+	roleIDs := slices.Compact(slices.Sorted(slices.Values(request.RoleIDs)))
+	if len(roleIDs) > 0 {
+		partitionRoles, rolesErr := ab.partitionRepo.GetRolesByID(ctx, roleIDs...)
+		if rolesErr != nil {
+			return nil, rolesErr
+		}
+
+		if len(partitionRoles) != len(roleIDs) {
+			return nil, status.Error(codes.NotFound, "some of the partition roles do not exist")
+		}
+
+		for _, partitionRole := range partitionRoles {
+			if partitionRole.PartitionID != partition.GetID() {
+				return nil, status.Errorf(codes.FailedPrecondition,
+					"partition role %s does not belong to partition %s", partitionRole.GetID(), partition.GetID())
+			}
+
+			err = ensureGuestEligible(access, partitionRole)
+			if err != nil {
+				return nil, err
+			}
+
+			change.AddRoles = append(change.AddRoles, &models.AccessRole{PartitionRoleID: partitionRole.GetID()})
+		}
+	}
+
+	err = ab.accessRepo.ApplyChanges(ctx, change)
+	if err != nil {
+		return nil, accessChangeError(err, access)
+	}
+
+	err = QueueAccessRelationSync(ctx, ab.service, access)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ab.toAccessEntries(ctx, []*models.Access{access},
+		map[string]*partitionv1.PartitionObject{partition.GetID(): toAPIPartition(partition)}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries[0], nil
+}
+
+// RevokeGuests revokes the access of every guest of a partition and reports how many were revoked.
+func (ab *accessBusiness) RevokeGuests(ctx context.Context, partitionID string, reason string) (int, error) {
+	partition, err := ab.partitionRepo.GetByID(ctx, partitionID)
+	if err != nil {
+		return 0, err
+	}
+
+	filter := &repository.AccessFilter{
+		GuestsOnly: true,
+		States: []models.AccessState{
+			models.AccessStateActive, models.AccessStatePending,
+			models.AccessStateSuspended, models.AccessStateExpired,
+		},
+	}
+
+	revoked := 0
+	for {
+		// Revoked guests drop out of the filter, so the first page always holds the ones left.
+		guests, listErr := ab.accessRepo.ListByPartition(ctx, partition.GetID(), filter, maxAccessPageSize, 0)
+		if listErr != nil {
+			return revoked, listErr
+		}
+
+		if len(guests) == 0 {
+			return revoked, nil
+		}
+
+		for _, guest := range guests {
+			_, err = ab.saveAccessState(ctx, partition, guest, models.AccessStateRevoked, reason)
+			if err != nil {
+				return revoked, err
+			}
+			revoked++
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package business_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type GuestAccessTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (g *GuestAccessTestSuite) TestGuestAccess() {
+	g.WithTestDependancies(g.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := g.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+		partitionRepo := repository.NewPartitionRepository(svc)
+		tenantRepo := repository.NewTenantRepository(svc)
+
+		collaborator := &models.PartitionRole{
+			Name:          "collaborator",
+			Permissions:   []string{"documents:read"},
+			GuestEligible: true,
+		}
+		treasurer := &models.PartitionRole{
+			Name:        "treasurer",
+			Permissions: []string{"payments:*"},
+		}
+		partition := g.CreatePartition(t, svc, nil, collaborator, treasurer)
+
+		partner := models.Tenant{Name: "partner tenant", Description: "Test"}
+		require.NoError(t, tenantRepo.Save(ctx, &partner))
+
+		_, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "sponsor-profile",
+		})
+		require.NoError(t, err)
+
+		_, err = accessBusiness.CreateGuestAccess(ctx, &business.CreateGuestAccessRequest{
+			PartitionID:      partition.GetID(),
+			ProfileID:        "guest-profile",
+			HomeTenantID:     partner.GetID(),
+			SponsorProfileID: "stranger-profile",
+		})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err), "sponsors must be members")
+
+		_, err = accessBusiness.CreateGuestAccess(ctx, &business.CreateGuestAccessRequest{
+			PartitionID:      partition.GetID(),
+			ProfileID:        "guest-profile",
+			HomeTenantID:     partition.TenantID,
+			SponsorProfileID: "sponsor-profile",
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "members of the tenant are not guests")
+
+		_, err = accessBusiness.CreateGuestAccess(ctx, &business.CreateGuestAccessRequest{
+			PartitionID:      partition.GetID(),
+			ProfileID:        "guest-profile",
+			HomeTenantID:     partner.GetID(),
+			SponsorProfileID: "sponsor-profile",
+			RoleIDs:          []string{treasurer.GetID()},
+		})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err), "guests only get guest eligible roles")
+
+		guest, err := accessBusiness.CreateGuestAccess(ctx, &business.CreateGuestAccessRequest{
+			PartitionID:      partition.GetID(),
+			ProfileID:        "guest-profile",
+			HomeTenantID:     partner.GetID(),
+			SponsorProfileID: "sponsor-profile",
+			RoleIDs:          []string{collaborator.GetID()},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, partner.GetID(), guest.HomeTenantID)
+		assert.Equal(t, "sponsor-profile", guest.SponsorProfileID)
+		require.NotNil(t, guest.ValidUntil, "guest access expires by default")
+		assert.True(t, guest.ValidUntil.After(time.Now()))
+		require.Len(t, guest.Roles, 1)
+
+		_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+			AccessId:        guest.Access.GetAccessId(),
+			PartitionRoleId: treasurer.GetID(),
+		})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+		decision, err := accessBusiness.CheckPermission(ctx, &business.CheckPermissionRequest{
+			ProfileID:   "guest-profile",
+			PartitionID: partition.GetID(),
+			Permission:  "documents:read",
+		})
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed)
+
+		collaborator.IncludedRoleIDs = []string{treasurer.GetID()}
+		require.NoError(t, partitionRepo.SaveRole(ctx, collaborator))
+
+		bundle, err := business.BuildPolicyBundle(ctx, svc, &business.PolicyBundleRequest{
+			PartitionID: partition.GetID(),
+		})
+		require.NoError(t, err)
+
+		var data struct {
+			Partition struct {
+				Tenants map[string]struct {
+					Partitions map[string]struct {
+						Access map[string]struct {
+							Guest       bool     `json:"guest"`
+							Permissions []string `json:"permissions"`
+						} `json:"access"`
+					} `json:"partitions"`
+				} `json:"tenants"`
+			} `json:"partition"`
+		}
+		require.NoError(t, json.Unmarshal(readBundle(t, bundle)["/data.json"], &data))
+
+		guestPolicy := data.Partition.Tenants[partition.TenantID].Partitions[partition.GetID()].Access["guest-profile"]
+		assert.True(t, guestPolicy.Guest)
+		assert.Equal(t, []string{"documents:read"}, guestPolicy.Permissions,
+			"guests do not get roles included by their eligible roles")
+
+		guests, err := accessBusiness.ListPartitionAccess(ctx, &business.ListPartitionAccessRequest{
+			PartitionID: partition.GetID(),
+			GuestsOnly:  true,
+		})
+		require.NoError(t, err)
+		require.Len(t, guests, 1)
+		assert.Equal(t, "guest-profile", guests[0].Access.GetProfileId())
+
+		revoked, err := accessBusiness.RevokeGuests(ctx, partition.GetID(), "partnership ended")
+		require.NoError(t, err)
+		assert.Equal(t, 1, revoked)
+
+		_, err = accessBusiness.GetActiveAccess(ctx, &partitionv1.GetAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "guest-profile",
+		})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		_, err = accessBusiness.GetActiveAccess(ctx, &partitionv1.GetAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "sponsor-profile",
+		})
+		require.NoError(t, err, "revoking guests leaves members alone")
+	})
+}
+
+// TestGuestAccesses runs the guest access test suite.
+func TestGuestAccesses(t *testing.T) {
+	suite.Run(t, new(GuestAccessTestSuite))
+}
@@ -0,0 +1,261 @@
+package business
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/service/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+const (
+	rolePropertyInheritable   = "inheritable"
+	rolePropertyInheritedFrom = "inherited_from"
+	accessPropertyExplanation = "explanation"
+
+	// maxPartitionDepth bounds ancestor walks so a corrupt parent chain can not loop forever.
+	maxPartitionDepth = 32
+)
+
+// flagFromProperties reads a boolean role flag such as inheritable, given either as a bool or a string.
+func flagFromProperties(properties frame.JSONMap, key string) (bool, error) {
+	val, ok := properties[key]
+	if !ok {
+		return false, nil
+	}
+
+	switch v := val.(type) {
+	case bool:
+		return v, nil
+	case string:
+		flag, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, status.Errorf(codes.InvalidArgument, "invalid %s flag: %s", key, v)
+		}
+		return flag, nil
+	default:
+		return false, status.Errorf(codes.InvalidArgument, "invalid %s flag: %v", key, val)
+	}
+}
+
+// effectiveAccess is the access a profile holds in a partition together with the roles in force there,
+// the roles of its direct access merged with the inheritable roles of its active ancestor accesses.
+type effectiveAccess struct {
+	partition *models.Partition
+	// access is the direct access, or the closest ancestor access granting roles when there is none.
+	access *models.Access
+	roles  []*resolvedRole
+}
+
+func (ea *effectiveAccess) inherited() bool {
+	return ea.access.PartitionID != ea.partition.GetID()
+}
+
+// holdsRole reports whether a role is already in force, the closest grant of a role wins.
+func (ea *effectiveAccess) holdsRole(roleID string) bool {
+	return slices.ContainsFunc(ea.roles, func(resolved *resolvedRole) bool {
+		return resolved.role.GetID() == roleID
+	})
+}
+
+// inheritedFrom lists the ancestors inherited roles come from, closest first.
+func (ea *effectiveAccess) inheritedFrom() []*models.Partition {
+	var ancestorList []*models.Partition
+	for _, resolved := range ea.roles {
+		if resolved.inheritedFrom != nil && !slices.Contains(ancestorList, resolved.inheritedFrom) {
+			ancestorList = append(ancestorList, resolved.inheritedFrom)
+		}
+	}
+	return ancestorList
+}
+
+func (ea *effectiveAccess) explanation() string {
+	explanation := fmt.Sprintf("access %s granted directly in partition %s", ea.access.GetID(), ea.partition.GetID())
+	if ea.inherited() {
+		explanation = fmt.Sprintf("access %s held in ancestor partition %s", ea.access.GetID(), ea.access.PartitionID)
+	}
+
+	for _, ancestor := range ea.inheritedFrom() {
+		explanation += fmt.Sprintf(", roles inherited from ancestor partition %s (%s)", ancestor.GetID(), ancestor.Name)
+	}
+	return explanation
+}
+
+// ancestors lists the parents of a partition, closest first.
+func (ab *accessBusiness) ancestors(ctx context.Context, partition *models.Partition) ([]*models.Partition, error) {
+	var ancestorList []*models.Partition
+	visited := map[string]bool{partition.GetID(): true}
+
+	parentID := partition.ParentID
+	for depth := 0; parentID != "" && depth < maxPartitionDepth; depth++ {
+		if visited[parentID] {
+			return nil, status.Errorf(codes.FailedPrecondition, "partition %s has a cyclic parent chain",
+				partition.GetID())
+		}
+		visited[parentID] = true
+
+		parent, err := ab.partitionRepo.GetByID(ctx, parentID)
+		if err != nil {
+			if frame.ErrorIsNoRows(err) {
+				break
+			}
+			return nil, err
+		}
+
+		ancestorList = append(ancestorList, parent)
+		parentID = parent.ParentID
+	}
+
+	return ancestorList, nil
+}
+
+// rolesInForce resolves the roles of an access, a guest only holds its guest eligible roles.
+func (ab *accessBusiness) rolesInForce(ctx context.Context, access *models.Access) ([]*resolvedRole, error) {
+	accessRoles, err := ab.accessRepo.GetRoles(ctx, access.GetID())
+	if err != nil {
+		return nil, err
+	}
+
+	return ab.assignmentsInForce(ctx, access, accessRoles)
+}
+
+// assignmentsInForce resolves the already loaded role assignments of an access like rolesInForce.
+func (ab *accessBusiness) assignmentsInForce(
+	ctx context.Context,
+	access *models.Access,
+	accessRoles []*models.AccessRole,
+) ([]*resolvedRole, error) {
+	resolvedRoles, err := ab.resolveAssignments(ctx, accessRoles)
+	if err != nil {
+		return nil, err
+	}
+
+	if access.IsGuest() {
+		resolvedRoles = guestEligibleRoles(resolvedRoles)
+	}
+	return resolvedRoles, nil
+}
+
+// resolveEffectiveAccess loads the roles of the direct access and walks up the hierarchy adding the
+// inheritable roles of every active ancestor access. An inactive direct access holds no roles at all.
+func (ab *accessBusiness) resolveEffectiveAccess(
+	ctx context.Context,
+	partition *models.Partition,
+	profileID string,
+) (*effectiveAccess, error) {
+	effective := &effectiveAccess{partition: partition}
+
+	access, directErr := ab.accessRepo.GetByPartitionAndProfile(ctx, partition.GetID(), profileID)
+	if directErr != nil && !frame.ErrorIsNoRows(directErr) {
+		return nil, directErr
+	}
+
+	if directErr == nil {
+		effective.access = access
+		if !access.IsActive() {
+			return effective, nil
+		}
+
+		roles, err := ab.rolesInForce(ctx, access)
+		if err != nil {
+			return nil, err
+		}
+		effective.roles = roles
+	}
+
+	ancestorList, err := ab.ancestors(ctx, partition)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ancestor := range ancestorList {
+		ancestorAccess, accessErr := ab.accessRepo.GetByPartitionAndProfile(ctx, ancestor.GetID(), profileID)
+		if accessErr != nil {
+			if frame.ErrorIsNoRows(accessErr) {
+				continue
+			}
+			return nil, accessErr
+		}
+
+		if !ancestorAccess.IsActive() {
+			continue
+		}
+
+		resolvedRoles, roleErr := ab.rolesInForce(ctx, ancestorAccess)
+		if roleErr != nil {
+			return nil, roleErr
+		}
+
+		granted := false
+		for _, resolved := range resolvedRoles {
+			if !resolved.assignedRole().Inheritable || effective.holdsRole(resolved.role.GetID()) {
+				continue
+			}
+
+			resolved.inheritedFrom = ancestor
+			effective.roles = append(effective.roles, resolved)
+			granted = true
+		}
+
+		if effective.access == nil && granted {
+			effective.access = ancestorAccess
+		}
+	}
+
+	if effective.access == nil {
+		return nil, directErr
+	}
+
+	return effective, nil
+}
+
+// EffectiveAccessResult is the access a profile holds in a partition together with
+// the roles in force and where they came from.
+type EffectiveAccessResult struct {
+	Access                   *partitionv1.AccessObject
+	Roles                    []*partitionv1.AccessRoleObject
+	InheritedFromPartitionID string
+	Explanation              string
+}
+
+func (ab *accessBusiness) GetEffectiveAccess(
+	ctx context.Context,
+	partitionID string,
+	profileID string,
+) (*EffectiveAccessResult, error) {
+	partition, err := ab.partitionRepo.GetByID(ctx, partitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	effective, err := ab.resolveEffectiveAccess(ctx, partition, profileID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessObject, err := toAPIAccess(toAPIPartition(partition), effective.access)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &EffectiveAccessResult{
+		Access:      accessObject,
+		Explanation: effective.explanation(),
+	}
+
+	if effective.inherited() {
+		result.InheritedFromPartitionID = effective.access.PartitionID
+	}
+
+	for _, resolved := range effective.roles {
+		result.Roles = append(result.Roles, toAPIResolvedRole(resolved))
+	}
+
+	return result, nil
+}
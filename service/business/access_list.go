@@ -0,0 +1,215 @@
+package business
+
+import (
+	"context"
+	"time"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultAccessPageSize = 20
+	maxAccessPageSize     = 100
+)
+
+// ListPartitionAccessRequest pages through the members of a partition.
+type ListPartitionAccessRequest struct {
+	PartitionID string
+	RoleIDs     []string
+	States      []models.AccessState
+	// GuestsOnly lists only guests from other tenants.
+	GuestsOnly  bool
+	ExpandRoles bool
+	Count       uint32
+	Page        uint32
+}
+
+// ListProfileAccessRequest pages through the partitions a profile has access to,
+// by default only accesses that currently grant entry are listed.
+type ListProfileAccessRequest struct {
+	ProfileID       string
+	IncludeInactive bool
+	ExpandRoles     bool
+	ExpandPartition bool
+	Count           uint32
+	Page            uint32
+}
+
+// AccessEntry is one access in a listing together with its roles when they were asked for.
+type AccessEntry struct {
+	Access *partitionv1.AccessObject
+	Roles  []*partitionv1.AccessRoleObject
+	// HomeTenantID and SponsorProfileID are only set for guests from other tenants.
+	HomeTenantID     string
+	SponsorProfileID string
+	ValidUntil       *time.Time
+}
+
+func normalisePageSize(count uint32) uint32 {
+	if count == 0 {
+		return defaultAccessPageSize
+	}
+	if count > maxAccessPageSize {
+		return maxAccessPageSize
+	}
+	return count
+}
+
+func (ab *accessBusiness) ListPartitionAccess(
+	ctx context.Context,
+	request *ListPartitionAccessRequest,
+) ([]*AccessEntry, error) {
+	if request.PartitionID == "" {
+		return nil, status.Error(codes.InvalidArgument, "partition id is required")
+	}
+
+	partition, err := ab.partitionRepo.GetByID(ctx, request.PartitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessList, err := ab.accessRepo.ListByPartition(ctx, partition.GetID(), &repository.AccessFilter{
+		RoleIDs:    request.RoleIDs,
+		States:     request.States,
+		GuestsOnly: request.GuestsOnly,
+	}, normalisePageSize(request.Count), request.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	partitionObjects := map[string]*partitionv1.PartitionObject{partition.GetID(): toAPIPartition(partition)}
+
+	return ab.toAccessEntries(ctx, accessList, partitionObjects, request.ExpandRoles)
+}
+
+func (ab *accessBusiness) ListProfileAccess(
+	ctx context.Context,
+	request *ListProfileAccessRequest,
+) ([]*AccessEntry, error) {
+	if request.ProfileID == "" {
+		return nil, status.Error(codes.InvalidArgument, "profile id is required")
+	}
+
+	filter := &repository.AccessFilter{}
+	if !request.IncludeInactive {
+		now := time.Now()
+		filter.ActiveAt = &now
+	}
+
+	accessList, err := ab.accessRepo.ListByProfile(
+		ctx, request.ProfileID, filter, normalisePageSize(request.Count), request.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	partitionObjects := make(map[string]*partitionv1.PartitionObject)
+	if request.ExpandPartition {
+		partitionIDs := make([]string, 0, len(accessList))
+		for _, access := range accessList {
+			partitionIDs = append(partitionIDs, access.PartitionID)
+		}
+
+		partitions, partitionErr := ab.partitionRepo.GetByIDs(ctx, partitionIDs...)
+		if partitionErr != nil {
+			return nil, partitionErr
+		}
+
+		for _, partition := range partitions {
+			partitionObjects[partition.GetID()] = toAPIPartition(partition)
+		}
+	}
+
+	return ab.toAccessEntries(ctx, accessList, partitionObjects, request.ExpandRoles)
+}
+
+// toAccessEntries converts accesses for a listing, a partition that was not expanded
+// is only referenced by its identifiers.
+func (ab *accessBusiness) toAccessEntries(
+	ctx context.Context,
+	accessList []*models.Access,
+	partitionObjects map[string]*partitionv1.PartitionObject,
+	expandRoles bool,
+) ([]*AccessEntry, error) {
+	rolesByAccess := make(map[string][]*partitionv1.AccessRoleObject)
+	if expandRoles {
+		var err error
+		rolesByAccess, err = ab.accessRolesByAccess(ctx, accessList)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make([]*AccessEntry, 0, len(accessList))
+	for _, access := range accessList {
+		partitionObject, ok := partitionObjects[access.PartitionID]
+		if !ok {
+			partitionObject = &partitionv1.PartitionObject{
+				Id:       access.PartitionID,
+				TenantId: access.TenantID,
+			}
+		}
+
+		accessObject, err := toAPIAccess(partitionObject, access)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := &AccessEntry{
+			Access:     accessObject,
+			Roles:      rolesByAccess[access.GetID()],
+			ValidUntil: access.ValidUntil,
+		}
+		if access.IsGuest() {
+			entry.HomeTenantID = access.HomeTenantID
+			entry.SponsorProfileID = access.SponsorProfileID
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// accessRolesByAccess lists the roles in force for each access as ListAccessRoles does, with included roles
+// and without removed roles or, for guests, roles not open to guests.
+func (ab *accessBusiness) accessRolesByAccess(
+	ctx context.Context,
+	accessList []*models.Access,
+) (map[string][]*partitionv1.AccessRoleObject, error) {
+	accessIDs := make([]string, 0, len(accessList))
+	for _, access := range accessList {
+		accessIDs = append(accessIDs, access.GetID())
+	}
+
+	accessRoles, err := ab.accessRepo.GetRolesByAccessIDs(ctx, accessIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	assignments := make(map[string][]*models.AccessRole)
+	for _, accessRole := range accessRoles {
+		assignments[accessRole.AccessID] = append(assignments[accessRole.AccessID], accessRole)
+	}
+
+	rolesByAccess := make(map[string][]*partitionv1.AccessRoleObject)
+	for _, access := range accessList {
+		if len(assignments[access.GetID()]) == 0 {
+			continue
+		}
+
+		resolvedRoles, resolveErr := ab.assignmentsInForce(ctx, access, assignments[access.GetID()])
+		if resolveErr != nil {
+			return nil, resolveErr
+		}
+
+		for _, resolved := range resolvedRoles {
+			rolesByAccess[access.GetID()] = append(rolesByAccess[access.GetID()], toAPIResolvedRole(resolved))
+		}
+	}
+
+	return rolesByAccess, nil
+}
@@ -0,0 +1,507 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+const (
+	// PermissionApproveAccessRequests is held by the roles whose members decide on access requests.
+	PermissionApproveAccessRequests = "access_requests:approve"
+
+	AccessRequestActionRequested = "requested"
+	AccessRequestActionApproved  = "approved"
+	AccessRequestActionDenied    = "denied"
+	AccessRequestActionCancelled = "cancelled"
+)
+
+// CreateAccessRequestRequest is a profile asking for a role in a partition.
+type CreateAccessRequestRequest struct {
+	PartitionID string
+	// ProfileID files the request for another profile, only approvers may do so. The authenticated
+	// profile asks for itself when it is empty.
+	ProfileID     string
+	RoleID        string
+	Justification string
+}
+
+type AccessRequestBusiness interface {
+	// RequestAccess, ApproveAccessRequest, DenyAccessRequest and CancelAccessRequest act as the authenticated profile.
+	RequestAccess(ctx context.Context, request *CreateAccessRequestRequest) (*models.AccessRequest, error)
+	ApproveAccessRequest(ctx context.Context, accessRequestID string, reason string) (*models.AccessRequest, error)
+	DenyAccessRequest(ctx context.Context, accessRequestID string, reason string) (*models.AccessRequest, error)
+	CancelAccessRequest(ctx context.Context, accessRequestID string) (*models.AccessRequest, error)
+	ListAccessRequests(
+		ctx context.Context,
+		partitionID string,
+		states ...models.AccessRequestState) ([]*models.AccessRequest, error)
+	GetAccessRequestHistory(ctx context.Context, accessRequestID string) ([]*models.AccessRequestEvent, error)
+}
+
+func NewAccessRequestBusiness(ctx context.Context, service *frame.Service) AccessRequestBusiness {
+	return newAccessRequestBusiness(ctx, service)
+}
+
+func newAccessRequestBusiness(ctx context.Context, service *frame.Service) *accessRequestBusiness {
+	return &accessRequestBusiness{
+		service:        service,
+		requestRepo:    repository.NewAccessRequestRepository(service),
+		partitionRepo:  repository.NewPartitionRepository(service),
+		accessRepo:     repository.NewAccessRepository(service),
+		accessBusiness: NewAccessBusiness(ctx, service),
+	}
+}
+
+type accessRequestBusiness struct {
+	service        *frame.Service
+	requestRepo    repository.AccessRequestRepository
+	partitionRepo  repository.PartitionRepository
+	accessRepo     repository.AccessRepository
+	accessBusiness AccessBusiness
+}
+
+// holdsRole reports whether the profile already has an active access carrying the role.
+func (arb *accessRequestBusiness) holdsRole(
+	ctx context.Context,
+	partitionID string,
+	profileID string,
+	roleID string,
+) (bool, error) {
+	access, err := arb.accessRepo.GetByPartitionAndProfile(ctx, partitionID, profileID)
+	if err != nil {
+		if frame.ErrorIsNoRows(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if !access.IsActive() {
+		return false, nil
+	}
+
+	accessRoles, err := arb.accessRepo.GetRoles(ctx, access.GetID())
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	for _, accessRole := range accessRoles {
+		if accessRole.PartitionRoleID == roleID && accessRole.IsActiveAt(now) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (arb *accessRequestBusiness) RequestAccess(
+	ctx context.Context,
+	request *CreateAccessRequestRequest,
+) (*models.AccessRequest, error) {
+	actorProfileID, err := authenticatedProfileID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	justification := strings.TrimSpace(request.Justification)
+	if justification == "" {
+		return nil, status.Error(codes.InvalidArgument, "a justification is required")
+	}
+
+	partition, err := arb.partitionRepo.GetByID(ctx, request.PartitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	partitionRoles, err := arb.partitionRepo.GetRolesByID(ctx, request.RoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(partitionRoles) == 0 || partitionRoles[0].PartitionID != partition.GetID() {
+		return nil, status.Errorf(codes.InvalidArgument, "role %s does not belong to partition %s",
+			request.RoleID, partition.GetID())
+	}
+
+	profileID := actorProfileID
+	if request.ProfileID != "" && request.ProfileID != actorProfileID {
+		decision, checkErr := arb.approvalPermission(ctx, partition.GetID(), actorProfileID)
+		if checkErr != nil {
+			return nil, checkErr
+		}
+
+		if !decision.Allowed {
+			return nil, status.Errorf(codes.PermissionDenied, "profile %s may not request access for others: %s",
+				actorProfileID, decision.Reason)
+		}
+		profileID = request.ProfileID
+	}
+
+	holds, err := arb.holdsRole(ctx, partition.GetID(), profileID, request.RoleID)
+	if err != nil {
+		return nil, err
+	}
+	if holds {
+		return nil, status.Errorf(codes.AlreadyExists, "profile %s already holds role %s",
+			profileID, request.RoleID)
+	}
+
+	_, err = arb.requestRepo.GetPending(ctx, partition.GetID(), profileID, request.RoleID)
+	if err == nil {
+		return nil, status.Errorf(codes.AlreadyExists, "profile %s already has a pending request for role %s",
+			profileID, request.RoleID)
+	}
+	if !frame.ErrorIsNoRows(err) {
+		return nil, err
+	}
+
+	accessRequest := &models.AccessRequest{
+		ProfileID:       profileID,
+		PartitionRoleID: request.RoleID,
+		Justification:   justification,
+		State:           models.AccessRequestStatePending,
+		BaseModel: frame.BaseModel{
+			TenantID:    partition.TenantID,
+			PartitionID: partition.GetID(),
+		},
+	}
+
+	err = arb.requestRepo.SaveWithEvent(ctx, accessRequest, &models.AccessRequestEvent{
+		ActorProfileID: actorProfileID,
+		Action:         AccessRequestActionRequested,
+		Reason:         justification,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = arb.publish(ctx, accessRequest, EventAccessRequestCreated, actorProfileID)
+	if err != nil {
+		return nil, err
+	}
+
+	return accessRequest, nil
+}
+
+// authenticatedProfileID is the profile of the caller's token, decisions are only ever taken on its behalf.
+func authenticatedProfileID(ctx context.Context) (string, error) {
+	claims := frame.ClaimsFromContext(ctx)
+	if claims == nil {
+		return "", status.Error(codes.Unauthenticated, "an authenticated profile is required")
+	}
+
+	profileID, err := claims.GetSubject()
+	if err != nil || profileID == "" {
+		return "", status.Error(codes.Unauthenticated, "an authenticated profile is required")
+	}
+
+	return profileID, nil
+}
+
+// pendingRequest loads a request that is still waiting on a decision.
+func (arb *accessRequestBusiness) pendingRequest(
+	ctx context.Context,
+	accessRequestID string,
+) (*models.AccessRequest, error) {
+	accessRequest, err := arb.requestRepo.GetByID(ctx, accessRequestID)
+	if err != nil {
+		return nil, err
+	}
+
+	if accessRequest.State != models.AccessRequestStatePending {
+		return nil, status.Errorf(codes.FailedPrecondition, "access request %s is already %s",
+			accessRequestID, accessRequest.State)
+	}
+
+	return accessRequest, nil
+}
+
+// approvalPermission checks whether the profile may decide on access requests in the partition.
+func (arb *accessRequestBusiness) approvalPermission(
+	ctx context.Context,
+	partitionID string,
+	profileID string,
+) (*PermissionDecision, error) {
+	return arb.accessBusiness.CheckPermission(ctx, &CheckPermissionRequest{
+		ProfileID:   profileID,
+		PartitionID: partitionID,
+		Permission:  PermissionApproveAccessRequests,
+	})
+}
+
+// ensureApprover checks that the approver holds the approval permission in the request's
+// partition, and that nobody decides on their own request.
+func (arb *accessRequestBusiness) ensureApprover(
+	ctx context.Context,
+	accessRequest *models.AccessRequest,
+	approverProfileID string,
+) error {
+	if approverProfileID == accessRequest.ProfileID {
+		return status.Error(codes.PermissionDenied, "access requests can not be decided by the requester")
+	}
+
+	decision, err := arb.approvalPermission(ctx, accessRequest.PartitionID, approverProfileID)
+	if err != nil {
+		return err
+	}
+
+	if !decision.Allowed {
+		return status.Errorf(codes.PermissionDenied, "profile %s may not decide on access requests: %s",
+			approverProfileID, decision.Reason)
+	}
+
+	return nil
+}
+
+// accessGrant prepares the access and role assignment an approval writes. A profile whose access is
+// suspended, expired or revoked is not granted anything until that access is dealt with.
+func (arb *accessRequestBusiness) accessGrant(
+	ctx context.Context,
+	accessRequest *models.AccessRequest,
+) (*repository.AccessChange, error) {
+	partitionRoles, err := arb.partitionRepo.GetRolesByID(ctx, accessRequest.PartitionRoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(partitionRoles) == 0 || partitionRoles[0].PartitionID != accessRequest.PartitionID {
+		return nil, status.Errorf(codes.FailedPrecondition, "role %s no longer exists in partition %s",
+			accessRequest.PartitionRoleID, accessRequest.PartitionID)
+	}
+	partitionRole := partitionRoles[0]
+
+	access, err := arb.accessRepo.GetByPartitionAndProfile(ctx, accessRequest.PartitionID, accessRequest.ProfileID)
+	if err != nil {
+		if !frame.ErrorIsNoRows(err) {
+			return nil, err
+		}
+
+		access = &models.Access{
+			ProfileID: accessRequest.ProfileID,
+			BaseModel: frame.BaseModel{
+				TenantID:    accessRequest.TenantID,
+				PartitionID: accessRequest.PartitionID,
+			},
+		}
+		return &repository.AccessChange{
+			Access:   access,
+			AddRoles: []*models.AccessRole{{PartitionRoleID: partitionRole.GetID()}},
+		}, nil
+	}
+
+	if !access.IsActive() {
+		return nil, status.Errorf(codes.FailedPrecondition, "access %s of profile %s is %s",
+			access.GetID(), access.ProfileID, access.EffectiveState(time.Now()))
+	}
+
+	err = ensureGuestEligible(access, partitionRole)
+	if err != nil {
+		return nil, err
+	}
+
+	accessRoles, err := arb.accessRepo.GetRoles(ctx, access.GetID())
+	if err != nil {
+		return nil, err
+	}
+
+	grant := &repository.AccessChange{Access: access, ExpectedState: access.State}
+	for _, accessRole := range accessRoles {
+		if accessRole.PartitionRoleID != partitionRole.GetID() {
+			continue
+		}
+
+		// An assignment that lapsed is brought back into force by the approval.
+		if !accessRole.IsActiveAt(time.Now()) {
+			accessRole.ValidFrom, accessRole.ValidUntil, accessRole.ExpiredAt = nil, nil, nil
+			grant.AddRoles = append(grant.AddRoles, accessRole)
+		}
+		return grant, nil
+	}
+
+	grant.AddRoles = append(grant.AddRoles, &models.AccessRole{PartitionRoleID: partitionRole.GetID()})
+	return grant, nil
+}
+
+func (arb *accessRequestBusiness) ApproveAccessRequest(
+	ctx context.Context,
+	accessRequestID string,
+	reason string,
+) (*models.AccessRequest, error) {
+	approverProfileID, err := authenticatedProfileID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	accessRequest, err := arb.pendingRequest(ctx, accessRequestID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = arb.ensureApprover(ctx, accessRequest, approverProfileID)
+	if err != nil {
+		return nil, err
+	}
+
+	grant, err := arb.accessGrant(ctx, accessRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	accessRequest, err = arb.decide(
+		ctx, accessRequest, models.AccessRequestStateApproved, approverProfileID, reason, grant)
+	if err != nil {
+		return nil, err
+	}
+
+	err = QueueAccessRelationSync(ctx, arb.service, grant.Access)
+	if err != nil {
+		return nil, err
+	}
+
+	return accessRequest, nil
+}
+
+func (arb *accessRequestBusiness) DenyAccessRequest(
+	ctx context.Context,
+	accessRequestID string,
+	reason string,
+) (*models.AccessRequest, error) {
+	approverProfileID, err := authenticatedProfileID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	accessRequest, err := arb.pendingRequest(ctx, accessRequestID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = arb.ensureApprover(ctx, accessRequest, approverProfileID)
+	if err != nil {
+		return nil, err
+	}
+
+	return arb.decide(ctx, accessRequest, models.AccessRequestStateDenied, approverProfileID, reason, nil)
+}
+
+// CancelAccessRequest withdraws a pending request, only the requester may do so.
+func (arb *accessRequestBusiness) CancelAccessRequest(
+	ctx context.Context,
+	accessRequestID string,
+) (*models.AccessRequest, error) {
+	profileID, err := authenticatedProfileID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	accessRequest, err := arb.pendingRequest(ctx, accessRequestID)
+	if err != nil {
+		return nil, err
+	}
+
+	if profileID != accessRequest.ProfileID {
+		return nil, status.Error(codes.PermissionDenied, "only the requester can cancel an access request")
+	}
+
+	return arb.decide(ctx, accessRequest, models.AccessRequestStateCancelled, profileID, "", nil)
+}
+
+// decide moves a pending request to its final state, failing when it was decided concurrently.
+func (arb *accessRequestBusiness) decide(
+	ctx context.Context,
+	accessRequest *models.AccessRequest,
+	state models.AccessRequestState,
+	actorProfileID string,
+	reason string,
+	grant *repository.AccessChange,
+) (*models.AccessRequest, error) {
+	decidedAt := time.Now()
+	accessRequest.State = state
+	accessRequest.DecidedBy = actorProfileID
+	accessRequest.DecisionReason = strings.TrimSpace(reason)
+	accessRequest.DecidedAt = &decidedAt
+
+	action, eventType := AccessRequestActionDenied, EventAccessRequestDenied
+	switch state {
+	case models.AccessRequestStateApproved:
+		action, eventType = AccessRequestActionApproved, EventAccessRequestApproved
+	case models.AccessRequestStateCancelled:
+		action, eventType = AccessRequestActionCancelled, EventAccessRequestCancelled
+	}
+
+	decided, err := arb.requestRepo.Decide(ctx, accessRequest, &models.AccessRequestEvent{
+		ActorProfileID: actorProfileID,
+		Action:         action,
+		Reason:         accessRequest.DecisionReason,
+	}, grant)
+	if err != nil {
+		// The profile was granted an access or role by someone else, or its access changed state,
+		// between reading and writing.
+		if repository.ErrorIsUniqueViolation(err) || errors.Is(err, repository.ErrAccessChanged) {
+			return nil, status.Errorf(codes.Aborted, "access of profile %s changed while deciding, try again",
+				accessRequest.ProfileID)
+		}
+		return nil, err
+	}
+
+	if !decided {
+		return nil, status.Errorf(codes.FailedPrecondition, "access request %s has already been decided",
+			accessRequest.GetID())
+	}
+
+	err = arb.publish(ctx, accessRequest, eventType, actorProfileID)
+	if err != nil {
+		return nil, err
+	}
+
+	return accessRequest, nil
+}
+
+func (arb *accessRequestBusiness) publish(
+	ctx context.Context,
+	accessRequest *models.AccessRequest,
+	eventType string,
+	actorProfileID string,
+) error {
+	return PublishAccessEvent(ctx, arb.service, &AccessEvent{
+		Type:        eventType,
+		TenantID:    accessRequest.TenantID,
+		PartitionID: accessRequest.PartitionID,
+		ProfileID:   accessRequest.ProfileID,
+		AccessID:    accessRequest.AccessID,
+		Attributes: map[string]string{
+			"access_request_id": accessRequest.GetID(),
+			"partition_role_id": accessRequest.PartitionRoleID,
+			"actor_profile_id":  actorProfileID,
+		},
+	})
+}
+
+func (arb *accessRequestBusiness) ListAccessRequests(
+	ctx context.Context,
+	partitionID string,
+	states ...models.AccessRequestState,
+) ([]*models.AccessRequest, error) {
+	return arb.requestRepo.ListByPartition(ctx, partitionID, states)
+}
+
+func (arb *accessRequestBusiness) GetAccessRequestHistory(
+	ctx context.Context,
+	accessRequestID string,
+) ([]*models.AccessRequestEvent, error) {
+	_, err := arb.requestRepo.GetByID(ctx, accessRequestID)
+	if err != nil {
+		return nil, err
+	}
+
+	return arb.requestRepo.GetEvents(ctx, accessRequestID)
+}
@@ -0,0 +1,175 @@
+package business_test
+
+import (
+	"context"
+	"testing"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+// asProfile authenticates the context as the profile, decisions on access requests are taken as the caller.
+func asProfile(ctx context.Context, profileID string) context.Context {
+	claims := &frame.AuthenticationClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: profileID}}
+	return claims.ClaimsToContext(ctx)
+}
+
+type AccessRequestTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (r *AccessRequestTestSuite) TestAccessRequestWorkflow() {
+	r.WithTestDependancies(r.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := r.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+		requestBusiness := business.NewAccessRequestBusiness(ctx, svc)
+
+		approverRole := &models.PartitionRole{
+			Name:        "access-approver",
+			Permissions: []string{business.PermissionApproveAccessRequests},
+		}
+		analystRole := &models.PartitionRole{
+			Name:        "analyst",
+			Permissions: []string{"reports:read"},
+		}
+		partition := r.CreatePartition(t, svc, nil, approverRole, analystRole)
+
+		approverAccess, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "approver-profile",
+		})
+		require.NoError(t, err)
+		_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+			AccessId:        approverAccess.GetAccessId(),
+			PartitionRoleId: approverRole.GetID(),
+		})
+		require.NoError(t, err)
+
+		_, err = requestBusiness.RequestAccess(ctx, &business.CreateAccessRequestRequest{
+			PartitionID:   partition.GetID(),
+			RoleID:        analystRole.GetID(),
+			Justification: "quarterly reporting",
+		})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), "requests are filed by an authenticated profile")
+
+		analystCtx := asProfile(ctx, "analyst-profile")
+		_, err = requestBusiness.RequestAccess(analystCtx, &business.CreateAccessRequestRequest{
+			PartitionID: partition.GetID(),
+			RoleID:      analystRole.GetID(),
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "a justification is required")
+
+		_, err = requestBusiness.RequestAccess(analystCtx, &business.CreateAccessRequestRequest{
+			PartitionID:   partition.GetID(),
+			ProfileID:     "other-profile",
+			RoleID:        analystRole.GetID(),
+			Justification: "on their behalf",
+		})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err), "only approvers file requests for others")
+
+		accessRequest, err := requestBusiness.RequestAccess(analystCtx, &business.CreateAccessRequestRequest{
+			PartitionID:   partition.GetID(),
+			RoleID:        analystRole.GetID(),
+			Justification: "quarterly reporting",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, models.AccessRequestStatePending, accessRequest.State)
+		assert.Equal(t, "analyst-profile", accessRequest.ProfileID)
+
+		_, err = requestBusiness.RequestAccess(analystCtx, &business.CreateAccessRequestRequest{
+			PartitionID:   partition.GetID(),
+			RoleID:        analystRole.GetID(),
+			Justification: "again",
+		})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+		_, err = requestBusiness.ApproveAccessRequest(ctx, accessRequest.GetID(), "")
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), "decisions are taken by an authenticated profile")
+
+		_, err = requestBusiness.ApproveAccessRequest(asProfile(ctx, "analyst-profile"), accessRequest.GetID(), "")
+		assert.Equal(t, codes.PermissionDenied, status.Code(err), "requesters can not approve themselves")
+
+		_, err = requestBusiness.ApproveAccessRequest(asProfile(ctx, "bystander-profile"), accessRequest.GetID(), "")
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		approverCtx := asProfile(ctx, "approver-profile")
+		approved, err := requestBusiness.ApproveAccessRequest(approverCtx, accessRequest.GetID(), "ok")
+		require.NoError(t, err)
+		assert.Equal(t, models.AccessRequestStateApproved, approved.State)
+		assert.Equal(t, "approver-profile", approved.DecidedBy)
+		assert.NotEmpty(t, approved.AccessID)
+
+		decision, err := accessBusiness.CheckPermission(ctx, &business.CheckPermissionRequest{
+			ProfileID:   "analyst-profile",
+			PartitionID: partition.GetID(),
+			Permission:  "reports:read",
+		})
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed)
+
+		_, err = requestBusiness.DenyAccessRequest(approverCtx, accessRequest.GetID(), "")
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err), "decided requests stay decided")
+
+		history, err := requestBusiness.GetAccessRequestHistory(ctx, accessRequest.GetID())
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.Equal(t, business.AccessRequestActionRequested, history[0].Action)
+		assert.Equal(t, "analyst-profile", history[0].ActorProfileID)
+		assert.Equal(t, business.AccessRequestActionApproved, history[1].Action)
+		assert.Equal(t, "approver-profile", history[1].ActorProfileID)
+
+		denied, err := requestBusiness.RequestAccess(approverCtx, &business.CreateAccessRequestRequest{
+			PartitionID:   partition.GetID(),
+			ProfileID:     "other-profile",
+			RoleID:        analystRole.GetID(),
+			Justification: "curious",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "other-profile", denied.ProfileID, "approvers may file requests for others")
+
+		denied, err = requestBusiness.DenyAccessRequest(approverCtx, denied.GetID(), "not needed")
+		require.NoError(t, err)
+		assert.Equal(t, models.AccessRequestStateDenied, denied.State)
+		assert.Equal(t, "not needed", denied.DecisionReason)
+
+		suspended, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "suspended-profile",
+		})
+		require.NoError(t, err)
+		_, err = accessBusiness.SuspendAccess(ctx, suspended.GetAccessId(), "under review")
+		require.NoError(t, err)
+
+		suspendedCtx := asProfile(ctx, "suspended-profile")
+		blocked, err := requestBusiness.RequestAccess(suspendedCtx, &business.CreateAccessRequestRequest{
+			PartitionID:   partition.GetID(),
+			RoleID:        analystRole.GetID(),
+			Justification: "back to work",
+		})
+		require.NoError(t, err)
+
+		_, err = requestBusiness.ApproveAccessRequest(approverCtx, blocked.GetID(), "")
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err), "suspended accesses are not granted roles")
+
+		pending, err := requestBusiness.ListAccessRequests(ctx, partition.GetID(), models.AccessRequestStatePending)
+		require.NoError(t, err)
+		require.Len(t, pending, 1, "a request that could not be approved stays pending")
+		assert.Equal(t, blocked.GetID(), pending[0].GetID())
+	})
+}
+
+// TestAccessRequests runs the access request workflow test suite.
+func TestAccessRequests(t *testing.T) {
+	suite.Run(t, new(AccessRequestTestSuite))
+}
@@ -0,0 +1,139 @@
+package business
+
+import (
+	"context"
+	"time"
+
+	commonv1 "github.com/antinvestor/apis/go/common/v1"
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/service/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func toAPIAccessState(state models.AccessState) commonv1.STATE {
+	switch state {
+	case models.AccessStateActive:
+		return commonv1.STATE_ACTIVE
+	case models.AccessStatePending:
+		return commonv1.STATE_CREATED
+	case models.AccessStateSuspended:
+		return commonv1.STATE_INACTIVE
+	case models.AccessStateRevoked:
+		return commonv1.STATE_DELETED
+	case models.AccessStateExpired:
+		return commonv1.STATE_INACTIVE
+	default:
+		return commonv1.STATE_INACTIVE
+	}
+}
+
+// GetActiveAccess behaves like GetAccess but rejects any access that does not
+// currently grant entry to the partition.
+func (ab *accessBusiness) GetActiveAccess(
+	ctx context.Context,
+	request *partitionv1.GetAccessRequest) (*partitionv1.AccessObject, error) {
+	effective, err := ab.getAccess(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	access := effective.access
+	if !access.IsActive() {
+		return nil, status.Errorf(codes.PermissionDenied, "access %s is %s",
+			access.GetID(), access.EffectiveState(time.Now()))
+	}
+
+	return toAPIAccess(toAPIPartition(effective.partition), access)
+}
+
+func (ab *accessBusiness) SuspendAccess(
+	ctx context.Context,
+	accessID string,
+	reason string) (*partitionv1.AccessObject, error) {
+	return ab.transitionAccess(ctx, accessID, models.AccessStateSuspended, reason)
+}
+
+func (ab *accessBusiness) ReinstateAccess(ctx context.Context, accessID string) (*partitionv1.AccessObject, error) {
+	return ab.transitionAccess(ctx, accessID, models.AccessStateActive, "")
+}
+
+func (ab *accessBusiness) RevokeAccess(
+	ctx context.Context,
+	accessID string,
+	reason string) (*partitionv1.AccessObject, error) {
+	return ab.transitionAccess(ctx, accessID, models.AccessStateRevoked, reason)
+}
+
+// transitionAccess moves an access to the target state, role assignments are kept
+// untouched so that a suspended access can be reinstated exactly as it was.
+func (ab *accessBusiness) transitionAccess(
+	ctx context.Context,
+	accessID string,
+	target models.AccessState,
+	reason string,
+) (*partitionv1.AccessObject, error) {
+	access, err := ab.accessRepo.GetByID(ctx, accessID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !access.State.CanTransitionTo(target) {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"access %s can not move from %s to %s", access.GetID(), access.State, target)
+	}
+
+	partition, err := ab.partitionRepo.GetByID(ctx, access.PartitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ab.saveAccessState(ctx, partition, access, target, reason)
+}
+
+func (ab *accessBusiness) saveAccessState(
+	ctx context.Context,
+	partition *models.Partition,
+	access *models.Access,
+	target models.AccessState,
+	reason string,
+) (*partitionv1.AccessObject, error) {
+	access.State = target
+	access.StateReason = reason
+
+	err := ab.accessRepo.Save(ctx, access)
+	if err != nil {
+		return nil, err
+	}
+
+	err = QueueAccessRelationSync(ctx, ab.service, access)
+	if err != nil {
+		return nil, err
+	}
+
+	return toAPIAccess(toAPIPartition(partition), access)
+}
+
+// regrantAccess reactivates a revoked access when it is explicitly created again,
+// roles held before the revocation are not restored and a former guest comes back as a member.
+func (ab *accessBusiness) regrantAccess(
+	ctx context.Context,
+	partition *models.Partition,
+	access *models.Access,
+) (*partitionv1.AccessObject, error) {
+	accessRoles, err := ab.accessRepo.GetRoles(ctx, access.GetID())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, accessRole := range accessRoles {
+		err = ab.accessRepo.RemoveRole(ctx, accessRole.GetID())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	access.HomeTenantID = ""
+	access.SponsorProfileID = ""
+	return ab.saveAccessState(ctx, partition, access, models.AccessStateActive, "")
+}
@@ -0,0 +1,314 @@
+package business_test
+
+import (
+	"testing"
+	"time"
+
+	commonv1 "github.com/antinvestor/apis/go/common/v1"
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type AccessBusinessTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (a *AccessBusinessTestSuite) TestAccessStateTransitions() {
+	a.WithTestDependancies(a.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := a.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+
+		partition := a.CreatePartition(t, svc, nil)
+
+		access, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "state-profile",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, commonv1.STATE_ACTIVE, access.GetState())
+
+		suspended, err := accessBusiness.SuspendAccess(ctx, access.GetAccessId(), "investigation")
+		require.NoError(t, err)
+		assert.Equal(t, commonv1.STATE_INACTIVE, suspended.GetState())
+
+		_, err = accessBusiness.GetActiveAccess(ctx, &partitionv1.GetAccessRequest{AccessId: access.GetAccessId()})
+		require.Error(t, err)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		_, err = accessBusiness.SuspendAccess(ctx, access.GetAccessId(), "again")
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err), "a suspended access can not be suspended")
+
+		reinstated, err := accessBusiness.ReinstateAccess(ctx, access.GetAccessId())
+		require.NoError(t, err)
+		assert.Equal(t, commonv1.STATE_ACTIVE, reinstated.GetState())
+
+		_, err = accessBusiness.GetActiveAccess(ctx, &partitionv1.GetAccessRequest{AccessId: access.GetAccessId()})
+		require.NoError(t, err)
+
+		revoked, err := accessBusiness.RevokeAccess(ctx, access.GetAccessId(), "left the company")
+		require.NoError(t, err)
+		assert.Equal(t, commonv1.STATE_DELETED, revoked.GetState())
+
+		_, err = accessBusiness.ReinstateAccess(ctx, access.GetAccessId())
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err), "a revoked access is final")
+	})
+}
+
+func (a *AccessBusinessTestSuite) TestTimeBoundAccessExpires() {
+	a.WithTestDependancies(a.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := a.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+		accessRepo := repository.NewAccessRepository(svc)
+
+		role := &models.PartitionRole{Name: "auditor"}
+		partition := a.CreatePartition(t, svc, nil, role)
+
+		access, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "contractor-profile",
+		})
+		require.NoError(t, err)
+
+		accessRole, err := accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+			AccessId:        access.GetAccessId(),
+			PartitionRoleId: role.GetID(),
+		})
+		require.NoError(t, err)
+
+		lapsed := time.Now().Add(-time.Minute)
+
+		_, err = accessBusiness.SetAccessRoleValidity(ctx, accessRole.GetAccessRoleId(), nil, &lapsed)
+		require.NoError(t, err)
+
+		roles, err := accessBusiness.ListAccessRoles(ctx, &partitionv1.ListAccessRoleRequest{
+			AccessId: access.GetAccessId(),
+		})
+		require.NoError(t, err)
+		assert.Empty(t, roles.GetRole(), "a lapsed role assignment should not be listed")
+
+		expiring, err := accessBusiness.SetAccessValidity(ctx, access.GetAccessId(), nil, &lapsed)
+		require.NoError(t, err)
+		assert.Equal(t, commonv1.STATE_INACTIVE, expiring.GetState())
+
+		changed, err := business.ExpireTimeBoundAccess(ctx, svc)
+		require.NoError(t, err)
+		assert.Equal(t, 2, changed)
+
+		expired, err := accessRepo.GetByID(ctx, access.GetAccessId())
+		require.NoError(t, err)
+		assert.Equal(t, models.AccessStateExpired, expired.State)
+
+		changed, err = business.ExpireTimeBoundAccess(ctx, svc)
+		require.NoError(t, err)
+		assert.Equal(t, 0, changed, "expiry should be idempotent")
+
+		extended := time.Now().Add(time.Hour)
+		renewed, err := accessBusiness.SetAccessValidity(ctx, access.GetAccessId(), nil, &extended)
+		require.NoError(t, err)
+		assert.Equal(t, commonv1.STATE_ACTIVE, renewed.GetState())
+
+		_, err = accessBusiness.SetAccessRoleValidity(ctx, accessRole.GetAccessRoleId(), nil, &extended)
+		require.NoError(t, err)
+
+		roles, err = accessBusiness.ListAccessRoles(ctx, &partitionv1.ListAccessRoleRequest{
+			AccessId: access.GetAccessId(),
+		})
+		require.NoError(t, err)
+		assert.Len(t, roles.GetRole(), 1, "an expired role assignment can be extended")
+
+		_, err = accessBusiness.SuspendAccess(ctx, access.GetAccessId(), "under review")
+		require.NoError(t, err)
+		_, err = accessBusiness.SetAccessValidity(ctx, access.GetAccessId(), nil, &lapsed)
+		require.NoError(t, err)
+
+		changed, err = business.ExpireTimeBoundAccess(ctx, svc)
+		require.NoError(t, err)
+		assert.Equal(t, 1, changed)
+
+		_, err = accessBusiness.SetAccessValidity(ctx, access.GetAccessId(), nil, &extended)
+		require.NoError(t, err)
+
+		restored, err := accessRepo.GetByID(ctx, access.GetAccessId())
+		require.NoError(t, err)
+		assert.Equal(t, models.AccessStateSuspended, restored.State, "extending restores the state before expiry")
+	})
+}
+
+func (a *AccessBusinessTestSuite) TestAccessInheritedFromAncestor() {
+	a.WithTestDependancies(a.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := a.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+		partitionRepo := repository.NewPartitionRepository(svc)
+
+		manager := &models.PartitionRole{
+			Name:        "regional manager",
+			Permissions: []string{"reports:read"},
+			Inheritable: true,
+		}
+		treasurer := &models.PartitionRole{
+			Name:        "regional treasurer",
+			Permissions: []string{"payments:approve"},
+		}
+		region := a.CreatePartition(t, svc, nil, manager, treasurer)
+
+		branch := &models.Partition{
+			Name:      "branch partition",
+			ParentID:  region.GetID(),
+			BaseModel: frame.BaseModel{TenantID: region.TenantID},
+		}
+		require.NoError(t, partitionRepo.Save(ctx, branch))
+
+		access, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+			PartitionId: region.GetID(),
+			ProfileId:   "manager-profile",
+		})
+		require.NoError(t, err)
+
+		for _, role := range []models.PartitionRole{manager, treasurer} {
+			_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+				AccessId:        access.GetAccessId(),
+				PartitionRoleId: role.GetID(),
+			})
+			require.NoError(t, err)
+		}
+
+		inherited, err := accessBusiness.GetAccess(ctx, &partitionv1.GetAccessRequest{
+			PartitionId: branch.GetID(),
+			ProfileId:   "manager-profile",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, access.GetAccessId(), inherited.GetAccessId())
+		assert.Equal(t, branch.GetID(), inherited.GetPartition().GetId())
+		assert.Equal(t, region.GetID(), inherited.GetPartition().GetProperties()["inherited_from"])
+		assert.Contains(t, inherited.GetPartition().GetProperties()["explanation"], region.GetID())
+
+		effective, err := accessBusiness.GetEffectiveAccess(ctx, branch.GetID(), "manager-profile")
+		require.NoError(t, err)
+		assert.Equal(t, region.GetID(), effective.InheritedFromPartitionID)
+		assert.Contains(t, effective.Explanation, region.GetID())
+		require.Len(t, effective.Roles, 1, "only inheritable roles apply below the granting partition")
+
+		decision, err := accessBusiness.CheckPermission(ctx, &business.CheckPermissionRequest{
+			ProfileID:   "manager-profile",
+			PartitionID: branch.GetID(),
+			Permission:  "reports:read",
+		})
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed)
+		require.Len(t, decision.Grants, 1)
+		assert.Equal(t, region.GetID(), decision.Grants[0].InheritedFromPartitionID)
+		assert.Contains(t, decision.Reason, region.GetID())
+
+		decision, err = accessBusiness.CheckPermission(ctx, &business.CheckPermissionRequest{
+			ProfileID:   "manager-profile",
+			PartitionID: branch.GetID(),
+			Permission:  "payments:approve",
+		})
+		require.NoError(t, err)
+		assert.False(t, decision.Allowed)
+
+		direct, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+			PartitionId: branch.GetID(),
+			ProfileId:   "manager-profile",
+		})
+		require.NoError(t, err)
+
+		inherited, err = accessBusiness.GetAccess(ctx, &partitionv1.GetAccessRequest{
+			PartitionId: branch.GetID(),
+			ProfileId:   "manager-profile",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, direct.GetAccessId(), inherited.GetAccessId(), "a direct access wins over the ancestor")
+		assert.NotContains(t, inherited.GetPartition().GetProperties(), "inherited_from")
+
+		effective, err = accessBusiness.GetEffectiveAccess(ctx, branch.GetID(), "manager-profile")
+		require.NoError(t, err)
+		assert.Equal(t, direct.GetAccessId(), effective.Access.GetAccessId())
+		assert.Empty(t, effective.InheritedFromPartitionID)
+		require.Len(t, effective.Roles, 1, "a direct access without roles keeps the inherited ones")
+		assert.Equal(t, access.GetAccessId(), effective.Roles[0].GetAccessId())
+		assert.Equal(t, region.GetID(), effective.Roles[0].GetRole().GetProperties()["inherited_from"])
+
+		decision, err = accessBusiness.CheckPermission(ctx, &business.CheckPermissionRequest{
+			ProfileID:   "manager-profile",
+			PartitionID: branch.GetID(),
+			Permission:  "reports:read",
+		})
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed)
+		require.Len(t, decision.Grants, 1)
+		assert.Equal(t, access.GetAccessId(), decision.Grants[0].AccessID)
+
+		_, err = accessBusiness.SuspendAccess(ctx, access.GetAccessId(), "on leave")
+		require.NoError(t, err)
+
+		effective, err = accessBusiness.GetEffectiveAccess(ctx, branch.GetID(), "manager-profile")
+		require.NoError(t, err)
+		assert.Empty(t, effective.Roles, "a suspended ancestor access is not inherited")
+	})
+}
+
+func (a *AccessBusinessTestSuite) TestCreateAccessRoleIntegrity() {
+	a.WithTestDependancies(a.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := a.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+
+		role := &models.PartitionRole{Name: "teller"}
+		partition := a.CreatePartition(t, svc, nil, role)
+
+		foreignRole := &models.PartitionRole{Name: "teller"}
+		otherPartition := a.CreatePartition(t, svc, nil, foreignRole)
+
+		access, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "teller-profile",
+		})
+		require.NoError(t, err)
+
+		_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+			AccessId:        access.GetAccessId(),
+			PartitionRoleId: "unknown-role",
+		})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+			AccessId:        "unknown-access",
+			PartitionRoleId: role.GetID(),
+		})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+			AccessId:        access.GetAccessId(),
+			PartitionRoleId: foreignRole.GetID(),
+		})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+		_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+			AccessId:        access.GetAccessId(),
+			PartitionRoleId: role.GetID(),
+		})
+		require.NoError(t, err)
+
+		_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+			AccessId:        access.GetAccessId(),
+			PartitionRoleId: role.GetID(),
+		})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+}
+
+// TestAccessBusiness runs the access business test suite.
+func TestAccessBusiness(t *testing.T) {
+	suite.Run(t, new(AccessBusinessTestSuite))
+}
@@ -0,0 +1,53 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/antinvestor/service-partition/config"
+
+	"github.com/pitabwire/frame"
+)
+
+const (
+	EventAccessExpired     = "access.expired"
+	EventAccessRoleExpired = "access_role.expired"
+
+	EventPartitionRoleRemoved = "partition_role.removed"
+	EventAccessRoleRevoked    = "access_role.revoked"
+
+	EventAccessRequestCreated   = "access_request.created"
+	EventAccessRequestApproved  = "access_request.approved"
+	EventAccessRequestDenied    = "access_request.denied"
+	EventAccessRequestCancelled = "access_request.cancelled"
+
+	EventAccessRemoved = "access.removed"
+	EventAccessMerged  = "access.merged"
+)
+
+// AccessEvent is published to the access events queue so that other services
+// can react to access changes this service makes on its own.
+type AccessEvent struct {
+	Type         string            `json:"type"`
+	TenantID     string            `json:"tenant_id"`
+	PartitionID  string            `json:"partition_id"`
+	ProfileID    string            `json:"profile_id,omitempty"`
+	AccessID     string            `json:"access_id,omitempty"`
+	AccessRoleID string            `json:"access_role_id,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	OccurredAt   time.Time         `json:"occurred_at"`
+}
+
+func PublishAccessEvent(ctx context.Context, service *frame.Service, event *AccessEvent) error {
+	cfg, ok := service.Config().(*config.PartitionConfig)
+	if !ok {
+		return errors.New("invalid configuration type")
+	}
+
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	return service.Publish(ctx, cfg.AccessEventsName, event)
+}
@@ -0,0 +1,505 @@
+package business
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/config"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+const invitationNotificationTemplate = "partition.invitation"
+
+// CreateInvitationRequest asks for a contact, an email or a phone number, to be invited into a partition.
+type CreateInvitationRequest struct {
+	PartitionID      string
+	Contact          string
+	RoleIDs          []string
+	InviterProfileID string
+	// Validity overrides the configured lifetime of the invitation token when set.
+	Validity time.Duration
+}
+
+// InvitationNotifier delivers the invitation token to the invited contact.
+type InvitationNotifier interface {
+	NotifyInvitation(
+		ctx context.Context,
+		invitation *models.Invitation,
+		partition *models.Partition,
+		token string,
+	) error
+}
+
+type InvitationBusiness interface {
+	CreateInvitation(ctx context.Context, request *CreateInvitationRequest) (*models.Invitation, error)
+	AcceptInvitation(ctx context.Context, token string, profileID string) (*partitionv1.AccessObject, error)
+	RevokeInvitation(ctx context.Context, invitationID string) error
+}
+
+func NewInvitationBusiness(ctx context.Context, service *frame.Service) InvitationBusiness {
+	return NewInvitationBusinessWithNotifier(ctx, service, &notificationServiceNotifier{service: service})
+}
+
+func NewInvitationBusinessWithNotifier(
+	ctx context.Context,
+	service *frame.Service,
+	notifier InvitationNotifier,
+) InvitationBusiness {
+	return &invitationBusiness{
+		service:        service,
+		notifier:       notifier,
+		invitationRepo: repository.NewInvitationRepository(service),
+		partitionRepo:  repository.NewPartitionRepository(service),
+		accessRepo:     repository.NewAccessRepository(service),
+	}
+}
+
+type invitationBusiness struct {
+	service        *frame.Service
+	notifier       InvitationNotifier
+	invitationRepo repository.InvitationRepository
+	partitionRepo  repository.PartitionRepository
+	accessRepo     repository.AccessRepository
+}
+
+func phoneNumberPattern() *regexp.Regexp {
+	return regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+}
+
+// normaliseContact validates an invited contact and returns it in a canonical form.
+func normaliseContact(contact string) (string, error) {
+	contact = strings.TrimSpace(contact)
+
+	if strings.Contains(contact, "@") {
+		address, err := mail.ParseAddress(contact)
+		if err != nil {
+			return "", status.Errorf(codes.InvalidArgument, "invalid email contact: %v", err)
+		}
+		return strings.ToLower(address.Address), nil
+	}
+
+	phone := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(contact)
+	if !phoneNumberPattern().MatchString(phone) {
+		return "", status.Errorf(codes.InvalidArgument, "contact %s is neither an email nor a phone number", contact)
+	}
+	return phone, nil
+}
+
+func invitationConfig(service *frame.Service) (*config.PartitionConfig, error) {
+	cfg, ok := service.Config().(*config.PartitionConfig)
+	if !ok {
+		return nil, errors.New("invalid configuration type")
+	}
+
+	if cfg.InvitationSigningSecret == "" {
+		return nil, status.Error(codes.FailedPrecondition, "invitation signing secret is not configured")
+	}
+
+	return cfg, nil
+}
+
+// signInvitationToken produces `base64(invitation_id.expiry).base64(hmac)` so that the
+// invitation and its expiry can be checked before touching the database.
+func signInvitationToken(secret string, invitationID string, expiresAt time.Time) string {
+	claims := fmt.Sprintf("%s.%d", invitationID, expiresAt.Unix())
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(claims))
+
+	return base64.RawURLEncoding.EncodeToString([]byte(claims)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func verifyInvitationToken(secret string, token string, now time.Time) (string, error) {
+	encodedClaims, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return "", status.Error(codes.InvalidArgument, "malformed invitation token")
+	}
+
+	claims, err := base64.RawURLEncoding.DecodeString(encodedClaims)
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, "malformed invitation token")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, "malformed invitation token")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(claims)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", status.Error(codes.PermissionDenied, "invalid invitation token signature")
+	}
+
+	invitationID, expiry, found := strings.Cut(string(claims), ".")
+	if !found {
+		return "", status.Error(codes.InvalidArgument, "malformed invitation token")
+	}
+
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, "malformed invitation token")
+	}
+
+	if now.After(time.Unix(expiresAt, 0)) {
+		return "", status.Error(codes.FailedPrecondition, "invitation token has expired")
+	}
+
+	return invitationID, nil
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (ib *invitationBusiness) CreateInvitation(
+	ctx context.Context,
+	request *CreateInvitationRequest,
+) (*models.Invitation, error) {
+	cfg, err := invitationConfig(ib.service)
+	if err != nil {
+		return nil, err
+	}
+
+	contact, err := normaliseContact(request.Contact)
+	if err != nil {
+		return nil, err
+	}
+
+	partition, err := ib.partitionRepo.GetByID(ctx, request.PartitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ib.validateInvitationRoles(ctx, partition, request.RoleIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reissuing an invitation supersedes any earlier one still waiting on the same contact.
+	previous, err := ib.invitationRepo.GetPendingByPartitionAndContact(ctx, partition.GetID(), contact)
+	if err != nil {
+		if !frame.ErrorIsNoRows(err) {
+			return nil, err
+		}
+	} else {
+		previous.State = models.InvitationStateRevoked
+		err = ib.invitationRepo.Save(ctx, previous)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	validity := request.Validity
+	if validity <= 0 {
+		validity = cfg.InvitationValidity
+	}
+
+	invitation := &models.Invitation{
+		Contact:          contact,
+		InviterProfileID: request.InviterProfileID,
+		State:            models.InvitationStatePending,
+		ExpiresAt:        time.Now().Add(validity),
+		BaseModel: frame.BaseModel{
+			TenantID:    partition.TenantID,
+			PartitionID: partition.GetID(),
+		},
+	}
+	invitation.SetRoleIDs(request.RoleIDs)
+
+	err = ib.invitationRepo.Save(ctx, invitation)
+	if err != nil {
+		return nil, err
+	}
+
+	token := signInvitationToken(cfg.InvitationSigningSecret, invitation.GetID(), invitation.ExpiresAt)
+	invitation.TokenHash = hashInvitationToken(token)
+
+	err = ib.invitationRepo.Save(ctx, invitation)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ib.notifier.NotifyInvitation(ctx, invitation, partition, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+func (ib *invitationBusiness) validateInvitationRoles(
+	ctx context.Context,
+	partition *models.Partition,
+	roleIDs []string,
+) error {
+	if len(roleIDs) == 0 {
+		return nil
+	}
+
+	partitionRoles, err := ib.partitionRepo.GetRolesByID(ctx, roleIDs...)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]bool, len(partitionRoles))
+	for _, role := range partitionRoles {
+		if role.PartitionID == partition.GetID() {
+			known[role.GetID()] = true
+		}
+	}
+
+	for _, roleID := range roleIDs {
+		if !known[roleID] {
+			return status.Errorf(codes.InvalidArgument, "role %s does not belong to partition %s",
+				roleID, partition.GetID())
+		}
+	}
+
+	return nil
+}
+
+func (ib *invitationBusiness) AcceptInvitation(
+	ctx context.Context,
+	token string,
+	profileID string,
+) (*partitionv1.AccessObject, error) {
+	cfg, err := invitationConfig(ib.service)
+	if err != nil {
+		return nil, err
+	}
+
+	invitationID, err := verifyInvitationToken(cfg.InvitationSigningSecret, token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	invitation, err := ib.invitationRepo.GetByID(ctx, invitationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal([]byte(invitation.TokenHash), []byte(hashInvitationToken(token))) {
+		return nil, status.Error(codes.PermissionDenied, "invitation token does not match")
+	}
+
+	if invitation.State != models.InvitationStatePending {
+		return nil, status.Errorf(codes.FailedPrecondition, "invitation %s is no longer pending", invitationID)
+	}
+
+	if time.Now().After(invitation.ExpiresAt) {
+		invitation.State = models.InvitationStateExpired
+		_, err = ib.invitationRepo.UpdatePending(ctx, invitation)
+		if err != nil {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.FailedPrecondition, "invitation %s has expired", invitationID)
+	}
+
+	partition, err := ib.partitionRepo.GetByID(ctx, invitation.PartitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	grant, err := ib.acceptanceGrant(ctx, partition, invitation, profileID)
+	if err != nil {
+		return nil, err
+	}
+
+	acceptedAt := time.Now()
+	invitation.State = models.InvitationStateAccepted
+	invitation.AcceptedAt = &acceptedAt
+	invitation.ProfileID = profileID
+
+	accepted, err := ib.invitationRepo.Accept(ctx, invitation, grant)
+	if err != nil {
+		// The profile was granted an access or role by someone else, or its access changed state,
+		// between reading and writing.
+		if repository.ErrorIsUniqueViolation(err) || errors.Is(err, repository.ErrAccessChanged) {
+			return nil, status.Errorf(codes.Aborted, "access of profile %s changed while accepting, try again",
+				profileID)
+		}
+		return nil, err
+	}
+
+	if !accepted {
+		return nil, status.Errorf(codes.FailedPrecondition, "invitation %s is no longer pending", invitationID)
+	}
+
+	err = QueueAccessRelationSync(ctx, ib.service, grant.Access)
+	if err != nil {
+		return nil, err
+	}
+
+	return toAPIAccess(toAPIPartition(partition), grant.Access)
+}
+
+// acceptanceGrant adds the invited roles to the access the profile holds in the partition, creating the access
+// or reactivating a revoked one without its former roles as CreateAccess does. Roles already held are kept.
+func (ib *invitationBusiness) acceptanceGrant(
+	ctx context.Context,
+	partition *models.Partition,
+	invitation *models.Invitation,
+	profileID string,
+) (*repository.AccessChange, error) {
+	grant := &repository.AccessChange{}
+	heldRoles := make(map[string]bool)
+
+	access, err := ib.accessRepo.GetByPartitionAndProfile(ctx, partition.GetID(), profileID)
+	switch {
+	case err == nil:
+		grant.Access = access
+		grant.ExpectedState = access.State
+		if access.State == models.AccessStateRevoked {
+			err = planRegrant(ctx, ib.accessRepo, grant)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		accessRoles, rolesErr := ib.accessRepo.GetRoles(ctx, access.GetID())
+		if rolesErr != nil {
+			return nil, rolesErr
+		}
+		for _, accessRole := range accessRoles {
+			heldRoles[accessRole.PartitionRoleID] = true
+		}
+	case frame.ErrorIsNoRows(err):
+		grant.Access = &models.Access{
+			ProfileID: profileID,
+			BaseModel: frame.BaseModel{
+				TenantID:    partition.TenantID,
+				PartitionID: partition.GetID(),
+			},
+		}
+	default:
+		return nil, err
+	}
+
+	roleIDs := invitation.RoleIDs()
+	if len(roleIDs) == 0 {
+		return grant, nil
+	}
+
+	partitionRoles, err := ib.partitionRepo.GetRolesByID(ctx, roleIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]*models.PartitionRole, len(partitionRoles))
+	for _, partitionRole := range partitionRoles {
+		if partitionRole.PartitionID == partition.GetID() {
+			known[partitionRole.GetID()] = partitionRole
+		}
+	}
+
+	for _, roleID := range roleIDs {
+		partitionRole, ok := known[roleID]
+		if !ok {
+			return nil, status.Errorf(codes.FailedPrecondition, "role %s no longer exists in partition %s",
+				roleID, partition.GetID())
+		}
+
+		if heldRoles[roleID] {
+			continue
+		}
+
+		err = ensureGuestEligible(grant.Access, partitionRole)
+		if err != nil {
+			return nil, err
+		}
+
+		heldRoles[roleID] = true
+		grant.AddRoles = append(grant.AddRoles, &models.AccessRole{PartitionRoleID: roleID})
+	}
+
+	return grant, nil
+}
+
+func (ib *invitationBusiness) RevokeInvitation(ctx context.Context, invitationID string) error {
+	invitation, err := ib.invitationRepo.GetByID(ctx, invitationID)
+	if err != nil {
+		return err
+	}
+
+	if invitation.State != models.InvitationStatePending {
+		return status.Errorf(codes.FailedPrecondition, "invitation %s is no longer pending", invitationID)
+	}
+
+	invitation.State = models.InvitationStateRevoked
+	revoked, err := ib.invitationRepo.UpdatePending(ctx, invitation)
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		return status.Errorf(codes.FailedPrecondition, "invitation %s is no longer pending", invitationID)
+	}
+	return nil
+}
+
+// notificationServiceNotifier hands the invitation over to the notification service for delivery.
+type notificationServiceNotifier struct {
+	service *frame.Service
+}
+
+func (nn *notificationServiceNotifier) NotifyInvitation(
+	ctx context.Context,
+	invitation *models.Invitation,
+	partition *models.Partition,
+	token string,
+) error {
+	cfg, ok := nn.service.Config().(*config.PartitionConfig)
+	if !ok {
+		return errors.New("invalid configuration type")
+	}
+
+	notificationURI := cfg.NotificationServiceURI
+	if !strings.Contains(notificationURI, "://") {
+		notificationURI = "http://" + notificationURI
+	}
+
+	payload := map[string]any{
+		"contact":  invitation.Contact,
+		"template": invitationNotificationTemplate,
+		"payload": map[string]any{
+			"invitation_id":  invitation.GetID(),
+			"partition_id":   partition.GetID(),
+			"partition_name": partition.Name,
+			"token":          token,
+			"expires_at":     invitation.ExpiresAt.Format(time.RFC3339),
+		},
+	}
+
+	respStatus, result, err := nn.service.InvokeRestService(
+		ctx, http.MethodPost, notificationURI+cfg.NotificationSendPath, payload, nil)
+	if err != nil {
+		return err
+	}
+
+	if respStatus < 200 || respStatus > 299 {
+		return fmt.Errorf("invalid response status %d: %s", respStatus, string(result))
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package business_test
+
+import (
+	"context"
+	"testing"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/config"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type capturingNotifier struct {
+	tokens map[string]string
+}
+
+func (cn *capturingNotifier) NotifyInvitation(
+	_ context.Context,
+	invitation *models.Invitation,
+	_ *models.Partition,
+	token string,
+) error {
+	cn.tokens[invitation.Contact] = token
+	return nil
+}
+
+type InvitationBusinessTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (i *InvitationBusinessTestSuite) TestInviteAndAccept() {
+	i.WithTestDependancies(i.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := i.CreateService(t, dep)
+
+		cfg, ok := svc.Config().(*config.PartitionConfig)
+		require.True(t, ok)
+		cfg.InvitationSigningSecret = "invitation-test-secret"
+
+		tenantRepo := repository.NewTenantRepository(svc)
+		partitionRepo := repository.NewPartitionRepository(svc)
+
+		tenant := models.Tenant{Name: "invite tenant", Description: "Test"}
+		require.NoError(t, tenantRepo.Save(ctx, &tenant))
+
+		partition := models.Partition{
+			Name:      "invite partition",
+			BaseModel: frame.BaseModel{TenantID: tenant.GetID()},
+		}
+		require.NoError(t, partitionRepo.Save(ctx, &partition))
+
+		role := models.PartitionRole{
+			Name:      "member",
+			BaseModel: frame.BaseModel{TenantID: tenant.GetID(), PartitionID: partition.GetID()},
+		}
+		require.NoError(t, partitionRepo.SaveRole(ctx, &role))
+
+		notifier := &capturingNotifier{tokens: map[string]string{}}
+		invitationBusiness := business.NewInvitationBusinessWithNotifier(ctx, svc, notifier)
+
+		invitation, err := invitationBusiness.CreateInvitation(ctx, &business.CreateInvitationRequest{
+			PartitionID: partition.GetID(),
+			Contact:     " Guest@Example.com ",
+			RoleIDs:     []string{role.GetID()},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "guest@example.com", invitation.Contact)
+
+		token, ok := notifier.tokens["guest@example.com"]
+		require.True(t, ok, "the invitation token should be handed to the notifier")
+
+		_, err = invitationBusiness.AcceptInvitation(ctx, token+"tampered", "invited-profile")
+		require.Error(t, err)
+
+		access, err := invitationBusiness.AcceptInvitation(ctx, token, "invited-profile")
+		require.NoError(t, err)
+		assert.Equal(t, "invited-profile", access.GetProfileId())
+
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+		roles, err := accessBusiness.ListAccessRoles(ctx, &partitionv1.ListAccessRoleRequest{
+			AccessId: access.GetAccessId(),
+		})
+		require.NoError(t, err)
+		require.Len(t, roles.GetRole(), 1)
+		assert.Equal(t, "member", roles.GetRole()[0].GetRole().GetName())
+
+		_, err = invitationBusiness.AcceptInvitation(ctx, token, "another-profile")
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err), "an invitation can only be accepted once")
+	})
+}
+
+// TestInvitationBusiness runs the invitation business test suite.
+func TestInvitationBusiness(t *testing.T) {
+	suite.Run(t, new(InvitationBusinessTestSuite))
+}
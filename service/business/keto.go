@@ -0,0 +1,336 @@
+package business
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/antinvestor/service-partition/config"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+
+	"github.com/pitabwire/frame"
+)
+
+const (
+	KetoPartitionNamespace = "partition"
+	KetoProfileNamespace   = "profile"
+
+	ketoRelationTuplesPath      = "/relation-tuples"
+	ketoAdminRelationTuplesPath = "/admin/relation-tuples"
+	defaultMaxAccessesToSync    = 100
+)
+
+// AccessRelationSync is queued whenever the membership of an access changes,
+// the handler reconciles the relation tuples held by keto for that access.
+type AccessRelationSync struct {
+	AccessID    string `json:"access_id"`
+	PartitionID string `json:"partition_id"`
+	ProfileID   string `json:"profile_id"`
+}
+
+// RelationTuple mirrors an access role as `partition:<id>#<role>@profile:<id>`.
+type RelationTuple struct {
+	Namespace  string       `json:"namespace"`
+	Object     string       `json:"object"`
+	Relation   string       `json:"relation"`
+	SubjectSet *RelationSet `json:"subject_set,omitempty"`
+}
+
+type RelationSet struct {
+	Namespace string `json:"namespace"`
+	Object    string `json:"object"`
+	Relation  string `json:"relation"`
+}
+
+func (rt *RelationTuple) String() string {
+	return fmt.Sprintf("%s:%s#%s@%s:%s", rt.Namespace, rt.Object, rt.Relation,
+		rt.SubjectSet.Namespace, rt.SubjectSet.Object)
+}
+
+func (rt *RelationTuple) toPayload() map[string]any {
+	return map[string]any{
+		"namespace": rt.Namespace,
+		"object":    rt.Object,
+		"relation":  rt.Relation,
+		"subject_set": map[string]any{
+			"namespace": rt.SubjectSet.Namespace,
+			"object":    rt.SubjectSet.Object,
+			"relation":  rt.SubjectSet.Relation,
+		},
+	}
+}
+
+func (rt *RelationTuple) toQuery() url.Values {
+	query := url.Values{}
+	query.Set("namespace", rt.Namespace)
+	query.Set("object", rt.Object)
+	query.Set("relation", rt.Relation)
+	query.Set("subject_set.namespace", rt.SubjectSet.Namespace)
+	query.Set("subject_set.object", rt.SubjectSet.Object)
+	query.Set("subject_set.relation", rt.SubjectSet.Relation)
+	return query
+}
+
+func newAccessRelationTuple(partitionID, profileID, relation string) *RelationTuple {
+	return &RelationTuple{
+		Namespace: KetoPartitionNamespace,
+		Object:    partitionID,
+		Relation:  relation,
+		SubjectSet: &RelationSet{
+			Namespace: KetoProfileNamespace,
+			Object:    profileID,
+		},
+	}
+}
+
+func accessSyncConfig(service *frame.Service) (*config.PartitionConfig, error) {
+	if c, ok := service.Config().(*config.PartitionConfig); ok {
+		return c, nil
+	}
+	return nil, errors.New("invalid configuration type")
+}
+
+// QueueAccessRelationSync publishes the access for the keto relation sync.
+func QueueAccessRelationSync(ctx context.Context, service *frame.Service, access *models.Access) error {
+	cfg, err := accessSyncConfig(service)
+	if err != nil {
+		return err
+	}
+
+	return service.Publish(ctx, cfg.AccessSyncName, &AccessRelationSync{
+		AccessID:    access.GetID(),
+		PartitionID: access.PartitionID,
+		ProfileID:   access.ProfileID,
+	})
+}
+
+// ReQueueAccessesForSync is the reconciliation job, every access including
+// deleted ones is queued so that keto converges with the database.
+func ReQueueAccessesForSync(service *frame.Service) {
+	ctx := context.Background()
+	logger := service.Log(ctx)
+
+	accessRepository := repository.NewAccessRepository(service)
+
+	for page := uint32(0); ; page++ {
+		accessList, err := accessRepository.GetAllIncludingDeleted(ctx, defaultMaxAccessesToSync, page)
+		if err != nil {
+			logger.WithError(err).Debug(" could not get accesses to reconcile")
+			return
+		}
+
+		for _, access := range accessList {
+			err = QueueAccessRelationSync(ctx, service, access)
+			if err != nil {
+				logger.WithError(err).Debug("could not publish because")
+				return
+			}
+		}
+
+		if len(accessList) < defaultMaxAccessesToSync {
+			return
+		}
+	}
+}
+
+// syncedAccess finds the access whose roles the profile should hold on keto, nil when there is none.
+func syncedAccess(
+	ctx context.Context,
+	accessRepo repository.AccessRepository,
+	sync *AccessRelationSync,
+) (*models.Access, error) {
+	access, err := accessRepo.GetByID(ctx, sync.AccessID)
+	if err != nil && !frame.ErrorIsNoRows(err) {
+		return nil, err
+	}
+
+	if err == nil && access.ProfileID == sync.ProfileID {
+		return access, nil
+	}
+
+	access, err = accessRepo.GetByPartitionAndProfile(ctx, sync.PartitionID, sync.ProfileID)
+	if err != nil {
+		if frame.ErrorIsNoRows(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return access, nil
+}
+
+// desiredAccessRelations resolves the relation names keto should hold for an access,
+// a missing or inactive access means every relation has to go. Tuples are keyed by partition
+// and profile, so when the access was removed or moved to another profile, as happens when
+// profiles are merged, whichever access the profile now holds in the partition is used.
+func desiredAccessRelations(
+	ctx context.Context,
+	service *frame.Service,
+	sync *AccessRelationSync,
+) (map[string]bool, error) {
+	accessRepo := repository.NewAccessRepository(service)
+	partitionRepo := repository.NewPartitionRepository(service)
+
+	relations := make(map[string]bool)
+
+	access, err := syncedAccess(ctx, accessRepo, sync)
+	if err != nil {
+		return nil, err
+	}
+
+	if access == nil || !access.IsActive() {
+		return relations, nil
+	}
+
+	accessRoles, err := accessRepo.GetRoles(ctx, access.GetID())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	roleIDs := make([]string, 0, len(accessRoles))
+	for _, accessRole := range accessRoles {
+		// Keto can not evaluate conditions, so conditional assignments are only honoured by CheckPermission.
+		if accessRole.IsActiveAt(now) && !isConditional(accessRole) {
+			roleIDs = append(roleIDs, accessRole.PartitionRoleID)
+		}
+	}
+
+	if len(roleIDs) == 0 {
+		return relations, nil
+	}
+
+	partitionRoles, err := partitionRepo.GetRolesByID(ctx, roleIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Guests only hold guest eligible roles, including those their other roles include.
+	guest := access.IsGuest()
+
+	for _, role := range partitionRoles {
+		if !guest || role.GuestEligible {
+			relations[role.Name] = true
+		}
+	}
+
+	includedRoles, err := expandRoleIncludes(ctx, partitionRepo, partitionRoles)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, included := range includedRoles {
+		if !guest || included.role.GuestEligible {
+			relations[included.role.Name] = true
+		}
+	}
+
+	return relations, nil
+}
+
+func listAccessRelationTuples(
+	ctx context.Context,
+	service *frame.Service,
+	cfg *config.PartitionConfig,
+	sync *AccessRelationSync,
+) ([]*RelationTuple, error) {
+	query := url.Values{}
+	query.Set("namespace", KetoPartitionNamespace)
+	query.Set("object", sync.PartitionID)
+	query.Set("subject_set.namespace", KetoProfileNamespace)
+	query.Set("subject_set.object", sync.ProfileID)
+	query.Set("subject_set.relation", "")
+
+	var tuples []*RelationTuple
+	for {
+		listURL := fmt.Sprintf("%s%s?%s", cfg.KetoReadURI, ketoRelationTuplesPath, query.Encode())
+
+		status, result, err := service.InvokeRestService(ctx, http.MethodGet, listURL, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if status < 200 || status > 299 {
+			return nil, fmt.Errorf("invalid response status %d: %s", status, string(result))
+		}
+
+		var response struct {
+			RelationTuples []*RelationTuple `json:"relation_tuples"`
+			NextPageToken  string           `json:"next_page_token"`
+		}
+		err = json.Unmarshal(result, &response)
+		if err != nil {
+			return nil, err
+		}
+
+		tuples = append(tuples, response.RelationTuples...)
+
+		if response.NextPageToken == "" {
+			return tuples, nil
+		}
+		query.Set("page_token", response.NextPageToken)
+	}
+}
+
+// SyncAccessOnKeto writes the relation tuples matching the roles of an access and
+// deletes the ones that no longer have a matching role.
+func SyncAccessOnKeto(ctx context.Context, service *frame.Service, sync *AccessRelationSync) error {
+	// Accesses removed with their profile no longer name it, there is nothing left to sync for them.
+	if sync.ProfileID == "" || sync.PartitionID == "" {
+		return nil
+	}
+
+	cfg, err := accessSyncConfig(service)
+	if err != nil {
+		return err
+	}
+
+	desired, err := desiredAccessRelations(ctx, service, sync)
+	if err != nil {
+		return err
+	}
+
+	existing, err := listAccessRelationTuples(ctx, service, cfg, sync)
+	if err != nil {
+		return err
+	}
+
+	writeURL := fmt.Sprintf("%s%s", cfg.KetoWriteURI, ketoAdminRelationTuplesPath)
+
+	for _, tuple := range existing {
+		if desired[tuple.Relation] {
+			delete(desired, tuple.Relation)
+			continue
+		}
+
+		status, result, deleteErr := service.InvokeRestService(
+			ctx, http.MethodDelete, fmt.Sprintf("%s?%s", writeURL, tuple.toQuery().Encode()), nil, nil)
+		if deleteErr != nil {
+			return deleteErr
+		}
+
+		if status != http.StatusNotFound && (status < 200 || status > 299) {
+			return fmt.Errorf("could not delete tuple %s, status %d: %s", tuple, status, string(result))
+		}
+	}
+
+	for relation := range desired {
+		tuple := newAccessRelationTuple(sync.PartitionID, sync.ProfileID, relation)
+
+		status, result, putErr := service.InvokeRestService(ctx, http.MethodPut, writeURL, tuple.toPayload(), nil)
+		if putErr != nil {
+			return putErr
+		}
+
+		if status < 200 || status > 299 {
+			return fmt.Errorf("could not write tuple %s, status %d: %s", tuple, status, string(result))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package business_test
+
+import (
+	"testing"
+
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/pitabwire/frame"
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type KetoSyncTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (k *KetoSyncTestSuite) TestSyncAccessOnKeto() {
+	k.WithTestDependancies(k.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := k.CreateService(t, dep)
+		fakeKeto := k.WithFakeKeto(t, svc)
+
+		tenantRepo := repository.NewTenantRepository(svc)
+		partitionRepo := repository.NewPartitionRepository(svc)
+		accessRepo := repository.NewAccessRepository(svc)
+
+		tenant := models.Tenant{Name: "keto tenant", Description: "Test"}
+		require.NoError(t, tenantRepo.Save(ctx, &tenant))
+
+		partition := models.Partition{
+			Name:      "keto partition",
+			BaseModel: frame.BaseModel{TenantID: tenant.GetID()},
+		}
+		require.NoError(t, partitionRepo.Save(ctx, &partition))
+
+		roles := make([]*models.PartitionRole, 0)
+		for _, name := range []string{"admin", "viewer"} {
+			role := &models.PartitionRole{
+				Name: name,
+				BaseModel: frame.BaseModel{
+					TenantID:    tenant.GetID(),
+					PartitionID: partition.GetID(),
+				},
+			}
+			require.NoError(t, partitionRepo.SaveRole(ctx, role))
+			roles = append(roles, role)
+		}
+
+		access := models.Access{
+			ProfileID: "keto-profile",
+			BaseModel: frame.BaseModel{
+				TenantID:    tenant.GetID(),
+				PartitionID: partition.GetID(),
+			},
+		}
+		require.NoError(t, accessRepo.Save(ctx, &access))
+
+		accessRoles := make([]*models.AccessRole, 0)
+		for _, role := range roles {
+			accessRole := &models.AccessRole{AccessID: access.GetID(), PartitionRoleID: role.GetID()}
+			require.NoError(t, accessRepo.SaveRole(ctx, accessRole))
+			accessRoles = append(accessRoles, accessRole)
+		}
+
+		syncRequest := &business.AccessRelationSync{
+			AccessID:    access.GetID(),
+			PartitionID: partition.GetID(),
+			ProfileID:   access.ProfileID,
+		}
+
+		err := business.SyncAccessOnKeto(ctx, svc, syncRequest)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"partition:" + partition.GetID() + "#admin@profile:keto-profile",
+			"partition:" + partition.GetID() + "#viewer@profile:keto-profile",
+		}, fakeKeto.Tuples())
+
+		require.NoError(t, accessRepo.RemoveRole(ctx, accessRoles[0].GetID()))
+		err = business.SyncAccessOnKeto(ctx, svc, syncRequest)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"partition:" + partition.GetID() + "#viewer@profile:keto-profile",
+		}, fakeKeto.Tuples())
+
+		require.NoError(t, accessRepo.Delete(ctx, access.GetID()))
+		err = business.SyncAccessOnKeto(ctx, svc, syncRequest)
+		require.NoError(t, err)
+		assert.Empty(t, fakeKeto.Tuples(), "deleted access should leave no tuples behind")
+	})
+}
+
+// TestKetoSync runs the keto relation synchronisation test suite against the fake keto.
+func TestKetoSync(t *testing.T) {
+	suite.Run(t, new(KetoSyncTestSuite))
+}
@@ -2,11 +2,16 @@ package business
 
 import (
 	"context"
+	"slices"
+	"strings"
+	"time"
 
 	commonv1 "github.com/antinvestor/apis/go/common/v1"
 	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
 	"github.com/antinvestor/service-partition/service/models"
 	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/pitabwire/frame"
 )
@@ -14,17 +19,88 @@ import (
 type PageBusiness interface {
 	GetPage(ctx context.Context, request *partitionv1.GetPageRequest) (*partitionv1.PageObject, error)
 	RemovePage(ctx context.Context, request *partitionv1.RemovePageRequest) error
-	CreatePage(ctx context.Context, request *partitionv1.CreatePageRequest) (*partitionv1.PageObject, error)
+	CreatePage(ctx context.Context, request *partitionv1.CreatePageRequest) (*SavedPage, error)
+
+	// GetLocalisedPage serves the variant of the page that best matches the locales, in order of preference.
+	GetLocalisedPage(
+		ctx context.Context,
+		request *partitionv1.GetPageRequest,
+		locales []string,
+	) (*partitionv1.PageObject, error)
+	CreateLocalisedPage(ctx context.Context, request *CreateLocalisedPageRequest) (*SavedPage, error)
+
+	SavePageDraft(ctx context.Context, pageID string, html string) (*models.PageRevision, error)
+	GetPageRevision(ctx context.Context, pageID string, revision int) (*models.PageRevision, error)
+	ListPageRevisions(ctx context.Context, pageID string) ([]*models.PageRevision, error)
+	// PublishPageRevision serves the given revision from now on, publishing an earlier one rolls the page back.
+	PublishPageRevision(ctx context.Context, pageID string, revision int) (*partitionv1.PageObject, error)
+
+	UpdatePage(ctx context.Context, request *UpdatePageRequest) (*SavedPage, error)
+	ListPages(ctx context.Context, request *ListPagesRequest) ([]*PageSummary, error)
+
+	RenderPage(ctx context.Context, request *RenderPageRequest) (*RenderedPage, error)
+}
+
+const (
+	pageFieldName   = "name"
+	pageFieldHTML   = "html"
+	pageFieldLocale = "locale"
+)
+
+// CreateLocalisedPageRequest adds a locale variant of a page, an empty locale creates the
+// variant served when no other matches.
+type CreateLocalisedPageRequest struct {
+	PartitionID string
+	Name        string
+	Locale      string
+	HTML        string
+}
+
+// UpdatePageRequest changes the fields of a page listed in UpdateMask. New HTML is saved
+// as a draft revision, it is served once that revision is published.
+type UpdatePageRequest struct {
+	ID         string
+	Name       string
+	HTML       string
+	Locale     string
+	UpdateMask []string
+}
+
+// SavedPage is a page as written together with the revision the write stored, whose Stripped field
+// reports what the sanitisation policy removed. Revision is nil when no HTML was written.
+type SavedPage struct {
+	Page     *partitionv1.PageObject
+	Revision *models.PageRevision
+}
+
+// ListPagesRequest pages through the pages of a partition in name order.
+type ListPagesRequest struct {
+	PartitionID string
+	Count       uint32
+	Page        uint32
+}
+
+// PageSummary describes a page in a listing without its HTML.
+type PageSummary struct {
+	ID                string
+	Name              string
+	Locale            string
+	State             commonv1.STATE
+	PublishedRevision int
+	LatestRevision    int
+	ModifiedAt        time.Time
 }
 
 func NewPageBusiness(_ context.Context, service *frame.Service) PageBusiness {
 	pageRepo := repository.NewPageRepository(service)
 	partitionRepo := repository.NewPartitionRepository(service)
+	tenantRepo := repository.NewTenantRepository(service)
 
 	return &pageBusiness{
 		service:       service,
 		pageRepo:      pageRepo,
 		partitionRepo: partitionRepo,
+		tenantRepo:    tenantRepo,
 	}
 }
 
@@ -32,6 +108,7 @@ type pageBusiness struct {
 	service       *frame.Service
 	pageRepo      repository.PageRepository
 	partitionRepo repository.PartitionRepository
+	tenantRepo    repository.TenantRepository
 }
 
 func toAPIPage(pageModel *models.Page) *partitionv1.PageObject {
@@ -43,44 +120,323 @@ func toAPIPage(pageModel *models.Page) *partitionv1.PageObject {
 	}
 }
 
+func validatePageName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", status.Error(codes.InvalidArgument, "page name is required")
+	}
+	if len(name) > 50 {
+		return "", status.Error(codes.InvalidArgument, "page name can not be longer than 50 characters")
+	}
+	return name, nil
+}
+
+// ensureUniquePageName rejects a name already used by another page of the partition in the same locale.
+func (ab *pageBusiness) ensureUniquePageName(
+	ctx context.Context,
+	partitionID string,
+	name string,
+	locale string,
+	pageID string,
+) error {
+	existing, err := ab.pageRepo.GetByPartitionNameAndLocale(ctx, partitionID, name, locale)
+	if err != nil {
+		if frame.ErrorIsNoRows(err) {
+			return nil
+		}
+		return err
+	}
+
+	if existing.GetID() == pageID {
+		return nil
+	}
+
+	return pageExistsError(partitionID, name, locale)
+}
+
+func pageExistsError(partitionID string, name string, locale string) error {
+	if locale == "" {
+		return status.Errorf(codes.AlreadyExists, "partition %s already has a page named %s", partitionID, name)
+	}
+	return status.Errorf(codes.AlreadyExists, "partition %s already has a page named %s in locale %s",
+		partitionID, name, locale)
+}
+
+// GetPage serves the page in the default locale.
 func (ab *pageBusiness) GetPage(
 	ctx context.Context,
 	request *partitionv1.GetPageRequest,
 ) (*partitionv1.PageObject, error) {
-	access, err := ab.pageRepo.GetByPartitionAndName(ctx, request.GetPartitionId(), request.GetName())
+	return ab.GetLocalisedPage(ctx, request, nil)
+}
+
+func (ab *pageBusiness) GetLocalisedPage(
+	ctx context.Context,
+	request *partitionv1.GetPageRequest,
+	locales []string,
+) (*partitionv1.PageObject, error) {
+	page, err := ab.pageVariant(ctx, request.GetPartitionId(), request.GetName(), locales)
 	if err != nil {
 		return nil, err
 	}
 
-	return toAPIPage(access), nil
+	return toAPIPage(page), nil
 }
 
 func (ab *pageBusiness) RemovePage(ctx context.Context, request *partitionv1.RemovePageRequest) error {
 	return ab.pageRepo.Delete(ctx, request.GetId())
 }
 
+// CreatePage creates the variant of a page served when no locale variant matches.
 func (ab *pageBusiness) CreatePage(
 	ctx context.Context,
 	request *partitionv1.CreatePageRequest,
-) (*partitionv1.PageObject, error) {
-	partition, err := ab.partitionRepo.GetByID(ctx, request.GetPartitionId())
+) (*SavedPage, error) {
+	return ab.CreateLocalisedPage(ctx, &CreateLocalisedPageRequest{
+		PartitionID: request.GetPartitionId(),
+		Name:        request.GetName(),
+		HTML:        request.GetHtml(),
+	})
+}
+
+func (ab *pageBusiness) CreateLocalisedPage(
+	ctx context.Context,
+	request *CreateLocalisedPageRequest,
+) (*SavedPage, error) {
+	partition, err := ab.partitionRepo.GetByID(ctx, request.PartitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := validatePageName(request.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	locale, err := normalisePageLocale(request.Locale)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ab.ensureUniquePageName(ctx, partition.GetID(), name, locale, "")
+	if err != nil {
+		return nil, err
+	}
+
+	html, stripped, err := ab.sanitisePage(partition.TenantID, request.HTML)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validatePageTemplate(name, html)
 	if err != nil {
 		return nil, err
 	}
 
+	// The first revision of a page is published straight away, there is nothing live it could break.
 	page := &models.Page{
-		Name: request.GetName(),
-		HTML: request.GetHtml(),
+		Name:              name,
+		HTML:              html,
+		Locale:            locale,
+		State:             int32(commonv1.STATE_ACTIVE),
+		PublishedRevision: 1,
 		BaseModel: frame.BaseModel{
 			TenantID:    partition.TenantID,
 			PartitionID: partition.GetID(),
 		},
 	}
 
-	err = ab.pageRepo.Save(ctx, page)
+	revision := &models.PageRevision{HTML: html, Stripped: stripped}
+	err = ab.pageRepo.SaveRevision(ctx, page, revision)
+	if err != nil {
+		if repository.ErrorIsUniqueViolation(err) {
+			return nil, pageExistsError(partition.GetID(), name, locale)
+		}
+		return nil, err
+	}
+
+	return &SavedPage{Page: toAPIPage(page), Revision: revision}, nil
+}
+
+// sanitisePage applies the sanitisation policy to page HTML unless the operator trusts the tenant.
+func (ab *pageBusiness) sanitisePage(tenantID string, html string) (string, []models.StrippedContent, error) {
+	sanitiser, err := newPageSanitiser(ab.service, tenantID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if sanitiser == nil {
+		return html, nil, nil
+	}
+
+	return sanitiser.Sanitise(html)
+}
+
+// SavePageDraft stores the HTML as a new revision of the page without changing what is served,
+// the revision lists what the sanitisation policy stripped from it.
+func (ab *pageBusiness) SavePageDraft(ctx context.Context, pageID string, html string) (*models.PageRevision, error) {
+	page, err := ab.pageRepo.GetByID(ctx, pageID)
+	if err != nil {
+		return nil, err
+	}
+
+	revision, err := ab.draftRevision(page, html)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ab.pageRepo.SaveRevision(ctx, page, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	return revision, nil
+}
+
+// draftRevision sanitises and validates HTML for the page as it is about to be saved.
+func (ab *pageBusiness) draftRevision(page *models.Page, html string) (*models.PageRevision, error) {
+	html, stripped, err := ab.sanitisePage(page.TenantID, html)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validatePageTemplate(page.Name, html)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PageRevision{HTML: html, Stripped: stripped}, nil
+}
+
+func (ab *pageBusiness) GetPageRevision(
+	ctx context.Context,
+	pageID string,
+	revision int,
+) (*models.PageRevision, error) {
+	return ab.pageRepo.GetRevision(ctx, pageID, revision)
+}
+
+func (ab *pageBusiness) ListPageRevisions(ctx context.Context, pageID string) ([]*models.PageRevision, error) {
+	_, err := ab.pageRepo.GetByID(ctx, pageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ab.pageRepo.ListRevisions(ctx, pageID)
+}
+
+func (ab *pageBusiness) PublishPageRevision(
+	ctx context.Context,
+	pageID string,
+	revision int,
+) (*partitionv1.PageObject, error) {
+	page, err := ab.pageRepo.GetByID(ctx, pageID)
+	if err != nil {
+		return nil, err
+	}
+
+	pageRevision, err := ab.pageRepo.GetRevision(ctx, page.GetID(), revision)
+	if err != nil {
+		return nil, err
+	}
+
+	page.State = int32(commonv1.STATE_ACTIVE)
+
+	err = ab.pageRepo.PublishRevision(ctx, page, pageRevision)
 	if err != nil {
 		return nil, err
 	}
 
 	return toAPIPage(page), nil
 }
+
+func (ab *pageBusiness) UpdatePage(ctx context.Context, request *UpdatePageRequest) (*SavedPage, error) {
+	if len(request.UpdateMask) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "update mask is required")
+	}
+
+	for _, field := range request.UpdateMask {
+		if field != pageFieldName && field != pageFieldHTML && field != pageFieldLocale {
+			return nil, status.Errorf(codes.InvalidArgument, "field %s can not be updated", field)
+		}
+	}
+
+	page, err := ab.pageRepo.GetByID(ctx, request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	renamed := false
+	if slices.Contains(request.UpdateMask, pageFieldName) {
+		page.Name, err = validatePageName(request.Name)
+		if err != nil {
+			return nil, err
+		}
+		renamed = true
+	}
+
+	if slices.Contains(request.UpdateMask, pageFieldLocale) {
+		page.Locale, err = normalisePageLocale(request.Locale)
+		if err != nil {
+			return nil, err
+		}
+		renamed = true
+	}
+
+	if renamed {
+		err = ab.ensureUniquePageName(ctx, page.PartitionID, page.Name, page.Locale, page.GetID())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Everything is validated before anything is written, a rename is never kept without its HTML.
+	var revision *models.PageRevision
+	if slices.Contains(request.UpdateMask, pageFieldHTML) {
+		revision, err = ab.draftRevision(page, request.HTML)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = ab.pageRepo.Update(ctx, page, revision)
+	if err != nil {
+		if repository.ErrorIsUniqueViolation(err) {
+			return nil, pageExistsError(page.PartitionID, page.Name, page.Locale)
+		}
+		return nil, err
+	}
+
+	return &SavedPage{Page: toAPIPage(page), Revision: revision}, nil
+}
+
+func (ab *pageBusiness) ListPages(ctx context.Context, request *ListPagesRequest) ([]*PageSummary, error) {
+	if request.PartitionID == "" {
+		return nil, status.Error(codes.InvalidArgument, "partition id is required")
+	}
+
+	partition, err := ab.partitionRepo.GetByID(ctx, request.PartitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := ab.pageRepo.ListByPartition(ctx, partition.GetID(), normalisePageSize(request.Count), request.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*PageSummary, 0, len(pages))
+	for _, page := range pages {
+		summaries = append(summaries, &PageSummary{
+			ID:                page.GetID(),
+			Name:              page.Name,
+			Locale:            page.Locale,
+			State:             commonv1.STATE(page.State),
+			PublishedRevision: page.PublishedRevision,
+			LatestRevision:    page.LatestRevision,
+			ModifiedAt:        page.ModifiedAt,
+		})
+	}
+
+	return summaries, nil
+}
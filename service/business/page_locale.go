@@ -0,0 +1,106 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/antinvestor/service-partition/config"
+	"github.com/antinvestor/service-partition/service/models"
+	"golang.org/x/text/language"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// normalisePageLocale returns the canonical form of a language tag, an empty locale stays empty.
+func normalisePageLocale(locale string) (string, error) {
+	locale = strings.TrimSpace(locale)
+	if locale == "" {
+		return "", nil
+	}
+
+	tag, err := language.Parse(locale)
+	if err != nil || tag == language.Und {
+		return "", status.Errorf(codes.InvalidArgument, "page locale %s is not a valid language tag", locale)
+	}
+
+	return tag.String(), nil
+}
+
+// ParseAcceptLanguage lists the locales of an Accept-Language header from the most to the least preferred,
+// a header that can not be read asks for nothing in particular.
+func ParseAcceptLanguage(header string) []string {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil {
+		return nil
+	}
+
+	locales := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		// The * wildcard is read as "mul", any language is what the fallback gives anyway.
+		if base, _ := tag.Base(); base.String() == "mul" {
+			continue
+		}
+		locales = append(locales, tag.String())
+	}
+	return locales
+}
+
+// pageLocaleCandidates lists the variants to look for in order: each requested locale followed
+// by its language, then the default locale and its language, then the variant without a locale.
+func pageLocaleCandidates(requested []string, defaultLocale string) []string {
+	candidates := make([]string, 0, 2*len(requested)+3)
+	add := func(locale string) {
+		if !slices.Contains(candidates, locale) {
+			candidates = append(candidates, locale)
+		}
+	}
+
+	for _, locale := range append(slices.Clone(requested), defaultLocale) {
+		tag, err := language.Parse(strings.TrimSpace(locale))
+		if err != nil || tag == language.Und {
+			continue
+		}
+
+		add(tag.String())
+		base, _ := tag.Base()
+		add(base.String())
+	}
+
+	add("")
+	return candidates
+}
+
+// pageVariant picks the published variant of a page that best matches the locales.
+func (ab *pageBusiness) pageVariant(
+	ctx context.Context,
+	partitionID string,
+	name string,
+	locales []string,
+) (*models.Page, error) {
+	cfg, ok := ab.service.Config().(*config.PartitionConfig)
+	if !ok {
+		return nil, errors.New("invalid configuration type")
+	}
+
+	variants, err := ab.pageRepo.ListVariants(ctx, partitionID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	published := make(map[string]*models.Page, len(variants))
+	for _, variant := range variants {
+		if variant.IsPublished() {
+			published[variant.Locale] = variant
+		}
+	}
+
+	for _, locale := range pageLocaleCandidates(locales, cfg.DefaultPageLocale) {
+		if page, found := published[locale]; found {
+			return page, nil
+		}
+	}
+
+	return nil, status.Errorf(codes.NotFound, "partition %s has no published page named %s", partitionID, name)
+}
@@ -0,0 +1,302 @@
+package business
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"text/template/parse"
+
+	"github.com/antinvestor/service-partition/config"
+	"github.com/antinvestor/service-partition/service/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RenderPageRequest executes a page of a partition as a template, by default the published
+// revision of the variant best matching the locales.
+type RenderPageRequest struct {
+	PartitionID string
+	Name        string
+	Locales     []string
+	// Revision renders a draft of the variant in the first locale for preview, zero renders the published revision.
+	Revision int
+	// Variables are exposed to the template as .vars.
+	Variables map[string]any
+}
+
+// RenderedPage is the output of a page template together with the revision it came from.
+type RenderedPage struct {
+	PageID   string
+	Revision int
+	HTML     string
+}
+
+// validatePageTemplate rejects HTML that does not parse as a page template.
+func validatePageTemplate(name string, html string) error {
+	_, err := parsePageTemplate(name, html)
+	return err
+}
+
+// pageRenderStepFunc is called at the start of every template and every loop iteration, see renderBudget.
+const pageRenderStepFunc = "pageRenderStep"
+
+func parsePageTemplate(name string, html string) (*template.Template, error) {
+	tmpl, err := template.New(name).
+		Option("missingkey=zero").
+		Funcs(template.FuncMap{pageRenderStepFunc: func() (bool, error) { return true, nil }}).
+		Parse(html)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "page %s is not a valid template: %v", name, err)
+	}
+
+	for _, defined := range tmpl.Templates() {
+		if defined.Tree == nil || defined.Tree.Root == nil {
+			continue
+		}
+
+		root := defined.Tree.Root
+		addRenderSteps(root)
+		root.Nodes = append([]parse.Node{renderStepNode()}, root.Nodes...)
+	}
+
+	return tmpl, nil
+}
+
+// renderStepNode is {{if pageRenderStep}}{{end}}, a call to the step function that writes nothing.
+func renderStepNode() parse.Node {
+	trees, err := parse.Parse(pageRenderStepFunc, "{{if "+pageRenderStepFunc+"}}{{end}}", "", "",
+		map[string]any{pageRenderStepFunc: true})
+	if err != nil {
+		panic(err)
+	}
+	return trees[pageRenderStepFunc].Root.Nodes[0]
+}
+
+// addRenderSteps puts a step at the start of every loop body so that loops and recursion can not run unbounded.
+func addRenderSteps(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+
+	for _, node := range list.Nodes {
+		switch branch := node.(type) {
+		case *parse.IfNode:
+			addRenderSteps(branch.List)
+			addRenderSteps(branch.ElseList)
+		case *parse.WithNode:
+			addRenderSteps(branch.List)
+			addRenderSteps(branch.ElseList)
+		case *parse.RangeNode:
+			addRenderSteps(branch.List)
+			addRenderSteps(branch.ElseList)
+			branch.List.Nodes = append([]parse.Node{renderStepNode()}, branch.List.Nodes...)
+		}
+	}
+}
+
+// renderBudget stops template execution after too many steps or once the render is cancelled,
+// templates that loop without writing never reach the renderWriter.
+type renderBudget struct {
+	ctx       context.Context
+	steps     int
+	maxSteps  int
+	exhausted bool
+}
+
+func (rb *renderBudget) step() (bool, error) {
+	err := rb.ctx.Err()
+	if err != nil {
+		return false, err
+	}
+
+	rb.steps++
+	if rb.steps > rb.maxSteps {
+		rb.exhausted = true
+		return false, errors.New("render step budget exhausted")
+	}
+
+	return true, nil
+}
+
+// renderWriter stops template execution once the output grows too large or the render is cancelled.
+type renderWriter struct {
+	ctx      context.Context
+	buf      bytes.Buffer
+	maxBytes int
+}
+
+func (rw *renderWriter) Write(p []byte) (int, error) {
+	err := rw.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	if rw.buf.Len()+len(p) > rw.maxBytes {
+		return 0, status.Errorf(codes.ResourceExhausted, "rendered page is larger than %d bytes", rw.maxBytes)
+	}
+
+	return rw.buf.Write(p)
+}
+
+// allowedRenderProperties copies the properties pages are allowed to read.
+func allowedRenderProperties(properties map[string]any, keys []string) map[string]any {
+	allowed := make(map[string]any, len(keys))
+	for _, key := range keys {
+		if value, ok := properties[key]; ok {
+			allowed[key] = value
+		}
+	}
+	return allowed
+}
+
+func pageRenderContext(
+	partition *models.Partition,
+	tenant *models.Tenant,
+	variables map[string]any,
+	propertyKeys []string,
+) map[string]any {
+	logoURI, _ := partition.Properties["logo_uri"].(string)
+
+	if variables == nil {
+		variables = map[string]any{}
+	}
+
+	return map[string]any{
+		"partition": map[string]any{
+			"id":          partition.GetID(),
+			"name":        partition.Name,
+			"description": partition.Description,
+			"logo_uri":    logoURI,
+			"properties":  allowedRenderProperties(partition.Properties, propertyKeys),
+		},
+		"tenant": map[string]any{
+			"id":          tenant.GetID(),
+			"name":        tenant.Name,
+			"description": tenant.Description,
+			"properties":  allowedRenderProperties(tenant.Properties, propertyKeys),
+		},
+		"vars": variables,
+	}
+}
+
+// pageToRender finds the page and the HTML of the revision a render request asks for.
+func (ab *pageBusiness) pageToRender(
+	ctx context.Context,
+	partition *models.Partition,
+	request *RenderPageRequest,
+) (*models.Page, string, int, error) {
+	if request.Revision == 0 {
+		page, err := ab.pageVariant(ctx, partition.GetID(), request.Name, request.Locales)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		return page, page.HTML, page.PublishedRevision, nil
+	}
+
+	locale := ""
+	if len(request.Locales) > 0 {
+		var err error
+		locale, err = normalisePageLocale(request.Locales[0])
+		if err != nil {
+			return nil, "", 0, err
+		}
+	}
+
+	page, err := ab.pageRepo.GetByPartitionNameAndLocale(ctx, partition.GetID(), request.Name, locale)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	pageRevision, err := ab.pageRepo.GetRevision(ctx, page.GetID(), request.Revision)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	return page, pageRevision.HTML, pageRevision.Revision, nil
+}
+
+// RenderPage executes the page against the partition, its tenant and the caller's variables.
+// Rendering is bounded by the configured timeout, number of steps and output size.
+func (ab *pageBusiness) RenderPage(ctx context.Context, request *RenderPageRequest) (*RenderedPage, error) {
+	cfg, ok := ab.service.Config().(*config.PartitionConfig)
+	if !ok {
+		return nil, errors.New("invalid configuration type")
+	}
+
+	partition, err := ab.partitionRepo.GetByID(ctx, request.PartitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	tenant, err := ab.tenantRepo.GetByID(ctx, partition.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	page, html, revision, err := ab.pageToRender(ctx, partition, request)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := parsePageTemplate(page.Name, html)
+	if err != nil {
+		return nil, err
+	}
+
+	renderCtx, cancel := context.WithTimeout(ctx, cfg.PageRenderTimeout)
+	defer cancel()
+
+	writer := &renderWriter{ctx: renderCtx, maxBytes: cfg.PageRenderMaxBytes}
+	budget := &renderBudget{ctx: renderCtx, maxSteps: cfg.PageRenderMaxSteps}
+	tmpl.Funcs(template.FuncMap{pageRenderStepFunc: budget.step})
+	data := pageRenderContext(partition, tenant, request.Variables, cfg.PageRenderProperties)
+
+	// Execution runs on its own so that a single slow step can not hold the caller past the timeout,
+	// it stops at its next step or write once the render is cancelled.
+	done := make(chan error, 1)
+	go func() {
+		done <- tmpl.Execute(writer, data)
+	}()
+
+	select {
+	case <-renderCtx.Done():
+		return nil, status.Errorf(codes.DeadlineExceeded, "page %s took longer than %s to render",
+			page.GetID(), cfg.PageRenderTimeout)
+	case err = <-done:
+	}
+
+	if err != nil {
+		// Errors of the writer reach here unwrapped.
+		if _, isStatus := status.FromError(err); isStatus {
+			return nil, err
+		}
+		if budget.exhausted {
+			return nil, status.Errorf(codes.ResourceExhausted, "page %s took more than %d steps to render",
+				page.GetID(), cfg.PageRenderMaxSteps)
+		}
+		if renderCtx.Err() != nil {
+			return nil, status.Errorf(codes.DeadlineExceeded, "page %s took longer than %s to render",
+				page.GetID(), cfg.PageRenderTimeout)
+		}
+		return nil, status.Errorf(codes.FailedPrecondition, "page %s could not be rendered: %v", page.GetID(), err)
+	}
+
+	rendered := writer.buf.String()
+	sanitiser, err := newPageSanitiser(ab.service, partition.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if sanitiser != nil {
+		rendered, err = sanitiser.SanitiseRendered(rendered)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &RenderedPage{
+		PageID:   page.GetID(),
+		Revision: revision,
+		HTML:     rendered,
+	}, nil
+}
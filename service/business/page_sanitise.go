@@ -0,0 +1,257 @@
+package business
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/antinvestor/service-partition/config"
+	"github.com/antinvestor/service-partition/service/models"
+	"golang.org/x/net/html"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+const (
+	strippedElement   = "element"
+	strippedAttribute = "attribute"
+	strippedURL       = "url"
+	strippedComment   = "comment"
+)
+
+func defaultPageAllowedTags() []string {
+	return []string{
+		"html", "head", "body", "title", "meta", "main", "header", "footer", "nav", "section", "article",
+		"aside", "div", "span", "p", "br", "hr", "h1", "h2", "h3", "h4", "h5", "h6", "strong", "em", "b",
+		"i", "u", "small", "code", "pre", "blockquote", "ul", "ol", "li", "dl", "dt", "dd", "table",
+		"thead", "tbody", "tfoot", "tr", "th", "td", "caption", "a", "img", "picture", "source", "figure",
+		"figcaption", "form", "fieldset", "legend", "label", "input", "button", "select", "option", "textarea",
+	}
+}
+
+func defaultPageAllowedAttributes() []string {
+	return []string{
+		"id", "class", "title", "lang", "dir", "role", "alt", "width", "height", "href", "src", "rel",
+		"target", "charset", "name", "content", "type", "value", "placeholder", "for", "action", "method",
+		"autocomplete", "required", "disabled", "checked", "selected", "readonly", "maxlength", "minlength",
+		"pattern", "colspan", "rowspan", "aria-label", "aria-hidden", "aria-describedby",
+	}
+}
+
+func defaultPageAllowedURLSchemes() []string {
+	return []string{"https", "http", "mailto", "tel"}
+}
+
+// pageURLAttributes are the attributes whose values are checked against the allowed URL schemes.
+func pageURLAttributes() []string {
+	return []string{"href", "src", "action", "formaction", "cite", "poster", "background", "xlink:href"}
+}
+
+// pageRawTextTags hold text that is not parsed as HTML, it can not be kept once the tag around it is removed.
+func pageRawTextTags() []string {
+	return []string{
+		"script", "style", "textarea", "title", "xmp", "iframe", "noembed", "noframes", "noscript", "plaintext",
+	}
+}
+
+// pageContentDroppingTags are removed together with everything inside them when they are not allowed.
+func pageContentDroppingTags() []string {
+	return append(pageRawTextTags(), "frame", "frameset", "object", "embed", "applet", "template", "svg", "math")
+}
+
+// pageSanitiser removes the elements, attributes and URLs a sanitisation policy does not allow.
+type pageSanitiser struct {
+	tags       []string
+	attributes []string
+	schemes    []string
+	// rendered is set for template output, where nothing is a template action any more.
+	rendered bool
+}
+
+// newPageSanitiser builds the sanitiser for the pages of a tenant, it is nil when the operator trusts the tenant.
+func newPageSanitiser(service *frame.Service, tenantID string) (*pageSanitiser, error) {
+	cfg, ok := service.Config().(*config.PartitionConfig)
+	if !ok {
+		return nil, errors.New("invalid configuration type")
+	}
+
+	if slices.Contains(cfg.TrustedPageTenantIDs, tenantID) {
+		return nil, nil
+	}
+
+	sanitiser := &pageSanitiser{
+		tags:       normaliseNames(cfg.PageAllowedTags),
+		attributes: normaliseNames(cfg.PageAllowedAttributes),
+		schemes:    normaliseNames(cfg.PageAllowedURLSchemes),
+	}
+	if len(sanitiser.tags) == 0 {
+		sanitiser.tags = defaultPageAllowedTags()
+	}
+	if len(sanitiser.attributes) == 0 {
+		sanitiser.attributes = defaultPageAllowedAttributes()
+	}
+	if len(sanitiser.schemes) == 0 {
+		sanitiser.schemes = defaultPageAllowedURLSchemes()
+	}
+
+	return sanitiser, nil
+}
+
+func normaliseNames(names []string) []string {
+	normalised := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			normalised = append(normalised, name)
+		}
+	}
+	return normalised
+}
+
+// Sanitise returns the HTML with everything the policy does not allow removed, together with what was removed.
+// Text is kept as it was written so that template actions survive. Template actions and comments can hide
+// markup from the tokenizer, so rendered pages go through SanitiseRendered as well.
+func (ps *pageSanitiser) Sanitise(source string) (string, []models.StrippedContent, error) {
+	var (
+		out       strings.Builder
+		stripped  []models.StrippedContent
+		dropping  string
+		dropDepth int
+	)
+
+	tokenizer := html.NewTokenizer(strings.NewReader(source))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if errors.Is(tokenizer.Err(), io.EOF) {
+				return out.String(), stripped, nil
+			}
+			return "", nil, status.Errorf(codes.InvalidArgument, "page html can not be read: %v", tokenizer.Err())
+		}
+
+		raw := string(tokenizer.Raw())
+		token := tokenizer.Token()
+
+		if dropping != "" {
+			switch {
+			case tokenType == html.StartTagToken && token.Data == dropping:
+				dropDepth++
+			case tokenType == html.EndTagToken && token.Data == dropping:
+				dropDepth--
+				if dropDepth == 0 {
+					dropping = ""
+				}
+			}
+			continue
+		}
+
+		switch tokenType {
+		case html.TextToken, html.DoctypeToken:
+			out.WriteString(raw)
+		case html.CommentToken:
+			stripped = append(stripped, models.StrippedContent{Kind: strippedComment, Value: token.Data})
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if !slices.Contains(ps.tags, token.Data) {
+				stripped = append(stripped, models.StrippedContent{Kind: strippedElement, Element: token.Data})
+				// Browsers and the tokenizer both read past a self closing raw text tag as if it was left open.
+				if (tokenType == html.StartTagToken && slices.Contains(pageContentDroppingTags(), token.Data)) ||
+					slices.Contains(pageRawTextTags(), token.Data) {
+					dropping, dropDepth = token.Data, 1
+				}
+				continue
+			}
+
+			stripped = append(stripped, ps.writeStartTag(&out, token, tokenType == html.SelfClosingTagToken)...)
+		case html.EndTagToken:
+			if slices.Contains(ps.tags, token.Data) {
+				out.WriteString("</" + token.Data + ">")
+			}
+		}
+	}
+}
+
+// SanitiseRendered applies the policy to the output of a page template.
+func (ps *pageSanitiser) SanitiseRendered(output string) (string, error) {
+	rendered := *ps
+	rendered.rendered = true
+
+	sanitised, _, err := rendered.Sanitise(output)
+	return sanitised, err
+}
+
+func (ps *pageSanitiser) writeStartTag(
+	out *strings.Builder,
+	token html.Token,
+	selfClosing bool,
+) []models.StrippedContent {
+	var stripped []models.StrippedContent
+
+	out.WriteString("<" + token.Data)
+	for _, attr := range token.Attr {
+		name := attr.Key
+		if attr.Namespace != "" {
+			name = attr.Namespace + ":" + attr.Key
+		}
+
+		if !slices.Contains(ps.attributes, name) {
+			stripped = append(stripped, models.StrippedContent{
+				Kind: strippedAttribute, Element: token.Data, Attribute: name, Value: attr.Val,
+			})
+			continue
+		}
+
+		if slices.Contains(pageURLAttributes(), name) && !ps.allowedURL(attr.Val) {
+			stripped = append(stripped, models.StrippedContent{
+				Kind: strippedURL, Element: token.Data, Attribute: name, Value: attr.Val,
+			})
+			continue
+		}
+
+		out.WriteString(" " + name + `="` + escapeAttributeValue(attr.Val) + `"`)
+	}
+
+	if selfClosing {
+		out.WriteString("/>")
+	} else {
+		out.WriteString(">")
+	}
+
+	return stripped
+}
+
+// templateActionPattern matches the template actions in a value.
+func templateActionPattern() *regexp.Regexp {
+	return regexp.MustCompile(`(?s)\{\{.*?\}\}`)
+}
+
+// allowedURL accepts relative URLs and URLs with an allowed scheme. Template actions are checked
+// by html/template when the page is rendered, the text around them has to pass on its own.
+func (ps *pageSanitiser) allowedURL(value string) bool {
+	if !ps.rendered {
+		value = templateActionPattern().ReplaceAllString(value, "")
+	}
+
+	// Browsers ignore control characters and whitespace inside a scheme, so they are not allowed to hide one.
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+
+	colon := strings.IndexByte(value, ':')
+	if colon < 0 || strings.ContainsAny(value[:colon], "/?#") {
+		return true
+	}
+
+	return slices.Contains(ps.schemes, strings.ToLower(value[:colon]))
+}
+
+// escapeAttributeValue escapes only what would end or confuse a double quoted value.
+func escapeAttributeValue(value string) string {
+	return strings.NewReplacer("&", "&amp;", `"`, "&#34;").Replace(value)
+}
@@ -0,0 +1,371 @@
+package business_test
+
+import (
+	"strings"
+	"testing"
+
+	commonv1 "github.com/antinvestor/apis/go/common/v1"
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/config"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type PageBusinessTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (p *PageBusinessTestSuite) TestPageRevisions() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		pageBusiness := business.NewPageBusiness(ctx, svc)
+
+		partition := p.CreatePartition(t, svc, nil)
+
+		saved, err := pageBusiness.CreatePage(ctx, &partitionv1.CreatePageRequest{
+			PartitionId: partition.GetID(),
+			Name:        "login",
+			Html:        "<p>sign in</p>",
+		})
+		require.NoError(t, err)
+		page := saved.Page
+		assert.Equal(t, commonv1.STATE_ACTIVE, page.GetState(), "the first revision is published")
+		assert.Equal(t, 1, saved.Revision.Revision)
+
+		draft, err := pageBusiness.SavePageDraft(ctx, page.GetPageId(), "<p>broken</p>")
+		require.NoError(t, err)
+		assert.Equal(t, 2, draft.Revision)
+
+		live, err := pageBusiness.GetPage(ctx, &partitionv1.GetPageRequest{
+			PartitionId: partition.GetID(),
+			Name:        "login",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "<p>sign in</p>", live.GetHtml(), "drafts are not served")
+
+		preview, err := pageBusiness.GetPageRevision(ctx, page.GetPageId(), draft.Revision)
+		require.NoError(t, err)
+		assert.Equal(t, "<p>broken</p>", preview.HTML)
+
+		published, err := pageBusiness.PublishPageRevision(ctx, page.GetPageId(), draft.Revision)
+		require.NoError(t, err)
+		assert.Equal(t, "<p>broken</p>", published.GetHtml())
+
+		rolledBack, err := pageBusiness.PublishPageRevision(ctx, page.GetPageId(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, "<p>sign in</p>", rolledBack.GetHtml())
+
+		_, err = pageBusiness.PublishPageRevision(ctx, page.GetPageId(), 7)
+		require.Error(t, err)
+
+		revisions, err := pageBusiness.ListPageRevisions(ctx, page.GetPageId())
+		require.NoError(t, err)
+		require.Len(t, revisions, 2)
+		assert.Equal(t, 1, revisions[0].Revision)
+		assert.Equal(t, 2, revisions[1].Revision)
+	})
+}
+
+func (p *PageBusinessTestSuite) TestUpdateAndListPages() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		pageBusiness := business.NewPageBusiness(ctx, svc)
+
+		partition := p.CreatePartition(t, svc, nil)
+
+		for _, name := range []string{"signup", "login"} {
+			_, err := pageBusiness.CreatePage(ctx, &partitionv1.CreatePageRequest{
+				PartitionId: partition.GetID(),
+				Name:        name,
+				Html:        "<p>" + name + "</p>",
+			})
+			require.NoError(t, err)
+		}
+
+		_, err := pageBusiness.CreatePage(ctx, &partitionv1.CreatePageRequest{
+			PartitionId: partition.GetID(),
+			Name:        "login",
+			Html:        "<p>again</p>",
+		})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+		pages, err := pageBusiness.ListPages(ctx, &business.ListPagesRequest{PartitionID: partition.GetID()})
+		require.NoError(t, err)
+		require.Len(t, pages, 2)
+		assert.Equal(t, "login", pages[0].Name)
+		assert.Equal(t, "signup", pages[1].Name)
+		assert.Equal(t, commonv1.STATE_ACTIVE, pages[0].State)
+
+		_, err = pageBusiness.UpdatePage(ctx, &business.UpdatePageRequest{
+			ID:         pages[1].ID,
+			Name:       "login",
+			UpdateMask: []string{"name"},
+		})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+		_, err = pageBusiness.UpdatePage(ctx, &business.UpdatePageRequest{ID: pages[1].ID, Name: "register"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "an update mask is required")
+
+		_, err = pageBusiness.UpdatePage(ctx, &business.UpdatePageRequest{
+			ID:         pages[1].ID,
+			Name:       "register",
+			HTML:       "<p>{{ .partition.name </p>",
+			UpdateMask: []string{"name", "html"},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		_, err = pageBusiness.GetPage(ctx, &partitionv1.GetPageRequest{PartitionId: partition.GetID(), Name: "signup"})
+		require.NoError(t, err, "a rejected update does not rename the page")
+
+		updated, err := pageBusiness.UpdatePage(ctx, &business.UpdatePageRequest{
+			ID:         pages[1].ID,
+			Name:       "register",
+			HTML:       "<p>register</p>",
+			UpdateMask: []string{"name", "html"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "register", updated.Page.GetName())
+		assert.Equal(t, "<p>signup</p>", updated.Page.GetHtml(), "new HTML is a draft until published")
+		assert.Equal(t, 2, updated.Revision.Revision)
+
+		pages, err = pageBusiness.ListPages(ctx, &business.ListPagesRequest{
+			PartitionID: partition.GetID(),
+			Count:       1,
+			Page:        1,
+		})
+		require.NoError(t, err)
+		require.Len(t, pages, 1)
+		assert.Equal(t, "register", pages[0].Name)
+		assert.Equal(t, 1, pages[0].PublishedRevision)
+		assert.Equal(t, 2, pages[0].LatestRevision)
+	})
+}
+
+func (p *PageBusinessTestSuite) TestRenderPage() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		pageBusiness := business.NewPageBusiness(ctx, svc)
+
+		partition := p.CreatePartition(t, svc, nil)
+
+		_, err := pageBusiness.CreatePage(ctx, &partitionv1.CreatePageRequest{
+			PartitionId: partition.GetID(),
+			Name:        "broken",
+			Html:        "<p>{{ .partition.name </p>",
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "template errors are caught on save")
+
+		saved, err := pageBusiness.CreatePage(ctx, &partitionv1.CreatePageRequest{
+			PartitionId: partition.GetID(),
+			Name:        "login",
+			Html:        "<h1>{{ .partition.name }}</h1><p>{{ .tenant.name }}</p><p>{{ .vars.greeting }}</p>",
+		})
+		require.NoError(t, err)
+		page := saved.Page
+
+		rendered, err := pageBusiness.RenderPage(ctx, &business.RenderPageRequest{
+			PartitionID: partition.GetID(),
+			Name:        "login",
+			Variables:   map[string]any{"greeting": "<script>hi</script>"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, rendered.Revision)
+		assert.Equal(t,
+			"<h1>page partition</h1><p>page tenant</p><p>&lt;script&gt;hi&lt;/script&gt;</p>", rendered.HTML)
+
+		_, err = pageBusiness.SavePageDraft(ctx, page.GetPageId(), "{{ range .vars.items }}{{ . }}{{ end }}")
+		require.NoError(t, err)
+
+		_, err = pageBusiness.RenderPage(ctx, &business.RenderPageRequest{
+			PartitionID: partition.GetID(),
+			Name:        "login",
+			Revision:    2,
+			Variables:   map[string]any{"items": []string{strings.Repeat("a", 1<<20), strings.Repeat("b", 1<<20)}},
+		})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err), "output is limited in size")
+
+		cfg, ok := svc.Config().(*config.PartitionConfig)
+		require.True(t, ok)
+		cfg.PageRenderMaxSteps = 1000
+
+		for _, html := range []string{
+			"{{ range 100000000000 }}{{ end }}",
+			`{{ define "again" }}{{ template "again" }}{{ end }}{{ template "again" }}`,
+		} {
+			draft, draftErr := pageBusiness.SavePageDraft(ctx, page.GetPageId(), html)
+			require.NoError(t, draftErr)
+
+			_, err = pageBusiness.RenderPage(ctx, &business.RenderPageRequest{
+				PartitionID: partition.GetID(),
+				Name:        "login",
+				Revision:    draft.Revision,
+			})
+			assert.Equal(t, codes.ResourceExhausted, status.Code(err), "template work is limited in steps")
+		}
+
+		partition.Properties = frame.JSONMap{"logo_uri": "https://logo", "client_secret": "secret"}
+		require.NoError(t, repository.NewPartitionRepository(svc).Save(ctx, partition))
+
+		_, err = pageBusiness.SavePageDraft(ctx, page.GetPageId(),
+			"<p>{{ .partition.properties.logo_uri }}{{ .partition.properties.client_secret }}</p>")
+		require.NoError(t, err)
+
+		rendered, err = pageBusiness.RenderPage(ctx, &business.RenderPageRequest{
+			PartitionID: partition.GetID(),
+			Name:        "login",
+			Revision:    5,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "<p>https://logo</p>", rendered.HTML, "only allowed properties reach pages")
+	})
+}
+
+func (p *PageBusinessTestSuite) TestPageSanitisation() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		pageBusiness := business.NewPageBusiness(ctx, svc)
+		tenantRepo := repository.NewTenantRepository(svc)
+
+		partition := p.CreatePartition(t, svc, nil)
+		source := `<p onclick="steal()">Hi {{ .partition.name }}</p><script>steal()</script>` +
+			`<a href="javascript:steal()">help</a><a href="/help">help</a>`
+
+		saved, err := pageBusiness.CreatePage(ctx, &partitionv1.CreatePageRequest{
+			PartitionId: partition.GetID(),
+			Name:        "login",
+			Html:        source,
+		})
+		require.NoError(t, err)
+		page := saved.Page
+		assert.Equal(t, `<p>Hi {{ .partition.name }}</p><a>help</a><a href="/help">help</a>`, page.GetHtml())
+
+		stripped := []models.StrippedContent{
+			{Kind: "attribute", Element: "p", Attribute: "onclick", Value: "steal()"},
+			{Kind: "element", Element: "script"},
+			{Kind: "url", Element: "a", Attribute: "href", Value: "javascript:steal()"},
+		}
+		assert.Equal(t, stripped, saved.Revision.Stripped, "the report is returned with the created page")
+
+		revision, err := pageBusiness.GetPageRevision(ctx, page.GetPageId(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, stripped, revision.Stripped)
+
+		updated, err := pageBusiness.UpdatePage(ctx, &business.UpdatePageRequest{
+			ID:         page.GetPageId(),
+			HTML:       source,
+			UpdateMask: []string{"html"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, stripped, updated.Revision.Stripped, "the report is returned with the updated page")
+
+		tenant, err := tenantRepo.GetByID(ctx, partition.TenantID)
+		require.NoError(t, err)
+		tenant.Properties = frame.JSONMap{"trusted_pages": "true"}
+		require.NoError(t, tenantRepo.Save(ctx, tenant))
+
+		draft, err := pageBusiness.SavePageDraft(ctx, page.GetPageId(), source)
+		require.NoError(t, err)
+		assert.NotEqual(t, source, draft.HTML, "tenants can not trust themselves")
+
+		hidden := `{{/* <p title=" */}}<script>alert(1)</script>{{/* "> */}}`
+		draft, err = pageBusiness.SavePageDraft(ctx, page.GetPageId(), hidden)
+		require.NoError(t, err)
+
+		rendered, err := pageBusiness.RenderPage(ctx, &business.RenderPageRequest{
+			PartitionID: partition.GetID(),
+			Name:        "login",
+			Revision:    draft.Revision,
+		})
+		require.NoError(t, err)
+		assert.NotContains(t, rendered.HTML, "<script", "markup hidden by template comments is removed on render")
+
+		cfg, ok := svc.Config().(*config.PartitionConfig)
+		require.True(t, ok)
+		cfg.TrustedPageTenantIDs = []string{partition.TenantID}
+
+		draft, err = pageBusiness.SavePageDraft(ctx, page.GetPageId(), source)
+		require.NoError(t, err)
+		assert.Equal(t, source, draft.HTML, "pages of tenants trusted by the operator are kept as they are")
+		assert.Empty(t, draft.Stripped)
+	})
+}
+
+func (p *PageBusinessTestSuite) TestLocalisedPages() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		pageBusiness := business.NewPageBusiness(ctx, svc)
+
+		partition := p.CreatePartition(t, svc, nil)
+
+		for locale, greeting := range map[string]string{"en": "Sign in", "fr": "Connexion", "sw": "Ingia"} {
+			_, err := pageBusiness.CreateLocalisedPage(ctx, &business.CreateLocalisedPageRequest{
+				PartitionID: partition.GetID(),
+				Name:        "login",
+				Locale:      locale,
+				HTML:        "<p>" + greeting + "</p>",
+			})
+			require.NoError(t, err)
+		}
+
+		_, err := pageBusiness.CreateLocalisedPage(ctx, &business.CreateLocalisedPageRequest{
+			PartitionID: partition.GetID(),
+			Name:        "login",
+			Locale:      "FR",
+			HTML:        "<p>encore</p>",
+		})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err), "locales are compared in canonical form")
+
+		_, err = pageBusiness.CreateLocalisedPage(ctx, &business.CreateLocalisedPageRequest{
+			PartitionID: partition.GetID(),
+			Name:        "login",
+			Locale:      "not a locale",
+			HTML:        "<p>?</p>",
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		request := &partitionv1.GetPageRequest{PartitionId: partition.GetID(), Name: "login"}
+		testCases := []struct {
+			name    string
+			locales []string
+			html    string
+		}{
+			{name: "accept language list", locales: business.ParseAcceptLanguage("fr-CA,fr;q=0.9"), html: "<p>Connexion</p>"},
+			{name: "falls back to the language", locales: []string{"sw-KE"}, html: "<p>Ingia</p>"},
+			{name: "falls back to the default locale", locales: []string{"de"}, html: "<p>Sign in</p>"},
+			{name: "no locale requested", html: "<p>Sign in</p>"},
+		}
+		for _, tc := range testCases {
+			page, getErr := pageBusiness.GetLocalisedPage(ctx, request, tc.locales)
+			require.NoError(t, getErr, tc.name)
+			assert.Equal(t, tc.html, page.GetHtml(), tc.name)
+		}
+
+		rendered, err := pageBusiness.RenderPage(ctx, &business.RenderPageRequest{
+			PartitionID: partition.GetID(),
+			Name:        "login",
+			Locales:     []string{"fr"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "<p>Connexion</p>", rendered.HTML)
+
+		pages, err := pageBusiness.ListPages(ctx, &business.ListPagesRequest{PartitionID: partition.GetID()})
+		require.NoError(t, err)
+		require.Len(t, pages, 3)
+		assert.Equal(t, []string{"en", "fr", "sw"}, []string{pages[0].Locale, pages[1].Locale, pages[2].Locale})
+	})
+}
+
+// TestPageBusiness runs the page business test suite.
+func TestPageBusiness(t *testing.T) {
+	suite.Run(t, new(PageBusinessTestSuite))
+}
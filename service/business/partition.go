@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	commonv1 "github.com/antinvestor/apis/go/common/v1"
@@ -14,6 +15,8 @@ import (
 	"github.com/antinvestor/service-partition/config"
 	"github.com/antinvestor/service-partition/service/models"
 	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/pitabwire/frame"
 )
@@ -38,16 +41,45 @@ type PartitionBusiness interface {
 	CreatePartitionRole(
 		ctx context.Context,
 		request *partitionv1.CreatePartitionRoleRequest) (*partitionv1.PartitionRoleObject, error)
+
+	AddPartitionPublicKey(
+		ctx context.Context,
+		partitionID string,
+		key map[string]any) (*partitionv1.PartitionObject, error)
+	RotatePartitionPublicKeys(
+		ctx context.Context,
+		partitionID string,
+		keys []map[string]any) (*partitionv1.PartitionObject, error)
+	RemovePartitionPublicKey(
+		ctx context.Context,
+		partitionID string,
+		keyID string) (*partitionv1.PartitionObject, error)
+
+	SetPartitionRolePermissions(
+		ctx context.Context,
+		partitionRoleID string,
+		permissions []string) (*partitionv1.PartitionRoleObject, error)
+
+	RemovePartitionRoleWithOptions(ctx context.Context, partitionRoleID string, cascade bool) (int, error)
+	UpdatePartitionRole(ctx context.Context, request *UpdatePartitionRoleRequest) (*partitionv1.PartitionRoleObject, error)
 }
 
 func NewPartitionBusiness(service *frame.Service) PartitionBusiness {
+	return newPartitionBusiness(service)
+}
+
+func newPartitionBusiness(service *frame.Service) *partitionBusiness {
 	tenantRepository := repository.NewTenantRepository(service)
 	partitionRepository := repository.NewPartitionRepository(service)
+	accessRepository := repository.NewAccessRepository(service)
+	templateRepository := repository.NewRoleTemplateRepository(service)
 
 	return &partitionBusiness{
 		service:       service,
 		partitionRepo: partitionRepository,
 		tenantRepo:    tenantRepository,
+		accessRepo:    accessRepository,
+		templateRepo:  templateRepository,
 	}
 }
 
@@ -55,6 +87,8 @@ type partitionBusiness struct {
 	service       *frame.Service
 	tenantRepo    repository.TenantRepository
 	partitionRepo repository.PartitionRepository
+	accessRepo    repository.AccessRepository
+	templateRepo  repository.RoleTemplateRepository
 }
 
 func toAPIPartition(partitionModel *models.Partition) *partitionv1.PartitionObject {
@@ -73,6 +107,24 @@ func toAPIPartition(partitionModel *models.Partition) *partitionv1.PartitionObje
 
 func toAPIPartitionRole(partitionModel *models.PartitionRole) *partitionv1.PartitionRoleObject {
 	properties := frame.DBPropertiesToMap(partitionModel.Properties)
+	if len(partitionModel.Permissions) > 0 {
+		properties[rolePropertyPermissions] = strings.Join(partitionModel.Permissions, ",")
+	}
+	if partitionModel.Inheritable {
+		properties[rolePropertyInheritable] = strconv.FormatBool(partitionModel.Inheritable)
+	}
+	if partitionModel.GuestEligible {
+		properties[rolePropertyGuestEligible] = strconv.FormatBool(partitionModel.GuestEligible)
+	}
+	if len(partitionModel.IncludedRoleIDs) > 0 {
+		properties[rolePropertyIncludes] = strings.Join(partitionModel.IncludedRoleIDs, ",")
+	}
+	if partitionModel.DisplayName != "" {
+		properties[rolePropertyDisplayName] = partitionModel.DisplayName
+	}
+	if partitionModel.Description != "" {
+		properties[rolePropertyDescription] = partitionModel.Description
+	}
 
 	return &partitionv1.PartitionRoleObject{
 		PartitionId: partitionModel.PartitionID,
@@ -174,19 +226,24 @@ func (pb *partitionBusiness) CreatePartition(
 		},
 	}
 
+	if IsServiceAccount(partition) {
+		err = prepareServiceAccount(partition)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	err = pb.partitionRepo.Save(ctx, partition)
 	if err != nil {
 		return nil, err
 	}
 
-	var partitionConfig *config.PartitionConfig
-	if c, ok := pb.service.Config().(*config.PartitionConfig); ok {
-		partitionConfig = c
-	} else {
-		return nil, errors.New("invalid configuration type")
+	err = pb.seedPartitionRoles(ctx, partition)
+	if err != nil {
+		return nil, err
 	}
 
-	err = pb.service.Publish(ctx, partitionConfig.PartitionSyncName, partition)
+	err = pb.queuePartitionSync(ctx, partition)
 	if err != nil {
 		return nil, err
 	}
@@ -194,6 +251,17 @@ func (pb *partitionBusiness) CreatePartition(
 	return toAPIPartition(partition), nil
 }
 
+func (pb *partitionBusiness) queuePartitionSync(ctx context.Context, partition *models.Partition) error {
+	var partitionConfig *config.PartitionConfig
+	if c, ok := pb.service.Config().(*config.PartitionConfig); ok {
+		partitionConfig = c
+	} else {
+		return errors.New("invalid configuration type")
+	}
+
+	return pb.service.Publish(ctx, partitionConfig.PartitionSyncName, partition)
+}
+
 func (pb *partitionBusiness) UpdatePartition(
 	ctx context.Context,
 	request *partitionv1.UpdatePartitionRequest) (*partitionv1.PartitionObject, error) {
@@ -211,11 +279,24 @@ func (pb *partitionBusiness) UpdatePartition(
 	partition.Description = request.GetDescription()
 	partition.Properties = jsonMap
 
+	// Updates go through the same key validation as creation, a service account never keeps private material.
+	if IsServiceAccount(partition) {
+		err = prepareServiceAccount(partition)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	err = pb.partitionRepo.Save(ctx, partition)
 	if err != nil {
 		return nil, err
 	}
 
+	err = pb.queuePartitionSync(ctx, partition)
+	if err != nil {
+		return nil, err
+	}
+
 	return toAPIPartition(partition), nil
 }
 
@@ -243,12 +324,8 @@ func (pb *partitionBusiness) RemovePartitionRole(
 	ctx context.Context,
 	request *partitionv1.RemovePartitionRoleRequest,
 ) error {
-	err := pb.partitionRepo.RemoveRole(ctx, request.GetId())
-	if err != nil {
-		return err
-	}
-
-	return nil
+	_, err := pb.RemovePartitionRoleWithOptions(ctx, request.GetId(), false)
+	return err
 }
 
 func (pb *partitionBusiness) CreatePartitionRole(
@@ -260,20 +337,90 @@ func (pb *partitionBusiness) CreatePartitionRole(
 		return nil, err
 	}
 
+	name, err := validateRoleName(request.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	err = pb.ensureUniqueRoleName(ctx, partition.GetID(), name, "")
+	if err != nil {
+		return nil, err
+	}
+
 	jsonMap := make(frame.JSONMap)
 	for k, v := range request.GetProperties() {
 		jsonMap[k] = v
 	}
 
+	displayName := stringFromProperties(jsonMap, rolePropertyDisplayName)
+	description := stringFromProperties(jsonMap, rolePropertyDescription)
+
+	permissions, err := permissionsFromProperties(jsonMap)
+	if err != nil {
+		return nil, err
+	}
+	delete(jsonMap, rolePropertyPermissions)
+
+	inheritable, err := flagFromProperties(jsonMap, rolePropertyInheritable)
+	if err != nil {
+		return nil, err
+	}
+	delete(jsonMap, rolePropertyInheritable)
+
+	guestEligible, err := flagFromProperties(jsonMap, rolePropertyGuestEligible)
+	if err != nil {
+		return nil, err
+	}
+	delete(jsonMap, rolePropertyGuestEligible)
+
 	partitionRole := &models.PartitionRole{
-		Name:       request.GetName(),
-		Properties: jsonMap,
+		Name:          name,
+		DisplayName:   displayName,
+		Description:   description,
+		Properties:    jsonMap,
+		Permissions:   permissions,
+		Inheritable:   inheritable,
+		GuestEligible: guestEligible,
 		BaseModel: frame.BaseModel{
-			PartitionID: partition.PartitionID,
+			PartitionID: partition.GetID(),
 			TenantID:    partition.TenantID,
 		},
 	}
 
+	err = pb.partitionRepo.SaveRole(ctx, partitionRole)
+	if err != nil {
+		if repository.ErrorIsUniqueViolation(err) {
+			return nil, status.Errorf(codes.AlreadyExists, "partition %s already has a role named %s",
+				partition.GetID(), name)
+		}
+		return nil, err
+	}
+
+	return toAPIPartitionRole(partitionRole), nil
+}
+
+func (pb *partitionBusiness) SetPartitionRolePermissions(
+	ctx context.Context,
+	partitionRoleID string,
+	permissions []string,
+) (*partitionv1.PartitionRoleObject, error) {
+	permissions, err := normalisePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	partitionRoles, err := pb.partitionRepo.GetRolesByID(ctx, partitionRoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(partitionRoles) == 0 {
+		return nil, status.Errorf(codes.NotFound, "partition role %s does not exist", partitionRoleID)
+	}
+
+	partitionRole := partitionRoles[0]
+	partitionRole.Permissions = permissions
+
 	err = pb.partitionRepo.SaveRole(ctx, partitionRole)
 	if err != nil {
 		return nil, err
@@ -337,12 +484,12 @@ func SyncPartitionOnHydra(ctx context.Context, service *frame.Service, partition
 		}
 
 		// Check if client exists and update HTTP method/URL accordingly
-		status, _, err := service.InvokeRestService(ctx, http.MethodGet, hydraIDURL, nil, nil)
+		respStatus, _, err := service.InvokeRestService(ctx, http.MethodGet, hydraIDURL, nil, nil)
 		if err != nil {
 			return err
 		}
 
-		if status == http.StatusOK {
+		if respStatus == http.StatusOK {
 			httpMethod = http.MethodPut
 			hydraURL = hydraIDURL
 		}
@@ -355,13 +502,13 @@ func SyncPartitionOnHydra(ctx context.Context, service *frame.Service, partition
 	}
 
 	// Invoke the Hydra service
-	status, result, err := service.InvokeRestService(ctx, httpMethod, hydraURL, payload, nil)
+	respStatus, result, err := service.InvokeRestService(ctx, httpMethod, hydraURL, payload, nil)
 	if err != nil {
 		return err
 	}
 
-	if status < 200 || status > 299 {
-		return fmt.Errorf("invalid response status %d: %s", status, string(result))
+	if respStatus < 200 || respStatus > 299 {
+		return fmt.Errorf("invalid response status %d: %s", respStatus, string(result))
 	}
 
 	// Update partition with response data
@@ -374,6 +521,10 @@ func deletePartitionOnHydra(ctx context.Context, service *frame.Service, hydraID
 }
 
 func preparePayload(clientID string, partition *models.Partition) (map[string]interface{}, error) {
+	if IsServiceAccount(partition) {
+		return prepareServiceAccountPayload(clientID, partition)
+	}
+
 	logoURI := ""
 	if val, ok := partition.Properties["logo_uri"].(string); ok {
 		logoURI = val
@@ -0,0 +1,234 @@
+package business
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+const (
+	rolePropertyDisplayName = "display_name"
+	rolePropertyDescription = "description"
+
+	roleFieldName        = "name"
+	roleFieldDisplayName = "display_name"
+	roleFieldDescription = "description"
+	roleFieldProperties  = "properties"
+	roleFieldPermissions = "permissions"
+	roleFieldInheritable = "inheritable"
+	roleFieldIncludes    = "included_role_ids"
+
+	roleFieldGuestEligible    = "guest_eligible"
+	rolePropertyGuestEligible = "guest_eligible"
+)
+
+func updatablePartitionRoleFields() []string {
+	return []string{
+		roleFieldName, roleFieldDisplayName, roleFieldDescription,
+		roleFieldProperties, roleFieldPermissions, roleFieldInheritable, roleFieldIncludes,
+		roleFieldGuestEligible,
+	}
+}
+
+// UpdatePartitionRoleRequest changes the fields of a role listed in UpdateMask, other fields are left untouched.
+type UpdatePartitionRoleRequest struct {
+	ID          string
+	Name        string
+	DisplayName string
+	Description string
+	Properties  map[string]any
+	Permissions []string
+	Inheritable bool
+	// GuestEligible lets guests hold the role, guests holding it keep it when it is turned off
+	// but the role no longer grants them anything.
+	GuestEligible bool
+	// IncludedRoleIDs replaces the roles granted along with this one.
+	IncludedRoleIDs []string
+	UpdateMask      []string
+}
+
+// stringFromProperties removes a string property, it is stored in its own column instead.
+func stringFromProperties(properties frame.JSONMap, key string) string {
+	val, ok := properties[key]
+	if !ok {
+		return ""
+	}
+	delete(properties, key)
+
+	str, _ := val.(string)
+	return strings.TrimSpace(str)
+}
+
+func validateRoleName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", status.Error(codes.InvalidArgument, "role name is required")
+	}
+	if len(name) > 100 {
+		return "", status.Error(codes.InvalidArgument, "role name can not be longer than 100 characters")
+	}
+	return name, nil
+}
+
+// ensureUniqueRoleName rejects a name already used by another role of the partition.
+func (pb *partitionBusiness) ensureUniqueRoleName(
+	ctx context.Context,
+	partitionID string,
+	name string,
+	roleID string,
+) error {
+	existing, err := pb.partitionRepo.GetRoleByPartitionAndName(ctx, partitionID, name)
+	if err != nil {
+		if frame.ErrorIsNoRows(err) {
+			return nil
+		}
+		return err
+	}
+
+	if existing.GetID() == roleID {
+		return nil
+	}
+
+	return status.Errorf(codes.AlreadyExists, "partition %s already has a role named %s", partitionID, name)
+}
+
+func (pb *partitionBusiness) UpdatePartitionRole(
+	ctx context.Context,
+	request *UpdatePartitionRoleRequest,
+) (*partitionv1.PartitionRoleObject, error) {
+	if len(request.UpdateMask) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "update mask is required")
+	}
+
+	for _, field := range request.UpdateMask {
+		if !slices.Contains(updatablePartitionRoleFields(), field) {
+			return nil, status.Errorf(codes.InvalidArgument, "field %s can not be updated", field)
+		}
+	}
+
+	partitionRoles, err := pb.partitionRepo.GetRolesByID(ctx, request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(partitionRoles) == 0 {
+		return nil, status.Errorf(codes.NotFound, "partition role %s does not exist", request.ID)
+	}
+
+	partitionRole := partitionRoles[0]
+	original := *partitionRole
+	resync := false
+
+	for _, field := range request.UpdateMask {
+		switch field {
+		case roleFieldName:
+			name, nameErr := validateRoleName(request.Name)
+			if nameErr != nil {
+				return nil, nameErr
+			}
+
+			nameErr = pb.ensureUniqueRoleName(ctx, partitionRole.PartitionID, name, partitionRole.GetID())
+			if nameErr != nil {
+				return nil, nameErr
+			}
+
+			resync = resync || name != partitionRole.Name
+			partitionRole.Name = name
+		case roleFieldDisplayName:
+			partitionRole.DisplayName = strings.TrimSpace(request.DisplayName)
+		case roleFieldDescription:
+			partitionRole.Description = strings.TrimSpace(request.Description)
+		case roleFieldProperties:
+			partitionRole.Properties = frame.JSONMap(request.Properties)
+		case roleFieldPermissions:
+			permissions, permErr := normalisePermissions(request.Permissions)
+			if permErr != nil {
+				return nil, permErr
+			}
+			partitionRole.Permissions = permissions
+		case roleFieldInheritable:
+			partitionRole.Inheritable = request.Inheritable
+		case roleFieldGuestEligible:
+			resync = resync || request.GuestEligible != partitionRole.GuestEligible
+			partitionRole.GuestEligible = request.GuestEligible
+		case roleFieldIncludes:
+			includedRoleIDs, includeErr := pb.validateRoleIncludes(ctx, partitionRole, request.IncludedRoleIDs)
+			if includeErr != nil {
+				return nil, includeErr
+			}
+			resync = resync || !slices.Equal(includedRoleIDs, partitionRole.IncludedRoleIDs)
+			partitionRole.IncludedRoleIDs = includedRoleIDs
+		}
+	}
+
+	// A rename or a narrowing of permissions can take the admin role away just like a removal.
+	if isAdminRole(&original) && !isAdminRole(partitionRole) {
+		err = pb.ensureAnotherAdminRole(ctx, &original)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = pb.partitionRepo.SaveRole(ctx, partitionRole)
+	if err != nil {
+		if repository.ErrorIsUniqueViolation(err) {
+			return nil, status.Errorf(codes.AlreadyExists, "partition %s already has a role named %s",
+				partitionRole.PartitionID, partitionRole.Name)
+		}
+		return nil, err
+	}
+
+	// Relations on keto are named after roles, follow includes and depend on guest eligibility,
+	// so holders have to be synced again.
+	if resync {
+		err = pb.queueRoleHoldersSync(ctx, partitionRole)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return toAPIPartitionRole(partitionRole), nil
+}
+
+// queueRoleHoldersSync queues a relation sync for every access holding the role, either
+// directly or through a role that includes it.
+func (pb *partitionBusiness) queueRoleHoldersSync(ctx context.Context, partitionRole *models.PartitionRole) error {
+	siblings, err := pb.partitionRepo.GetRoles(ctx, partitionRole.PartitionID)
+	if err != nil {
+		return err
+	}
+
+	var accessRoles []*models.AccessRole
+	for _, roleID := range rolesIncluding(includeGraph(siblings), partitionRole.GetID()) {
+		holders, holdersErr := pb.accessRepo.GetRolesByPartitionRoleID(ctx, roleID)
+		if holdersErr != nil {
+			return holdersErr
+		}
+		accessRoles = append(accessRoles, holders...)
+	}
+
+	for _, accessRole := range accessRoles {
+		access, accessErr := pb.accessRepo.GetByID(ctx, accessRole.AccessID)
+		if accessErr != nil {
+			if frame.ErrorIsNoRows(accessErr) {
+				continue
+			}
+			return accessErr
+		}
+
+		accessErr = QueueAccessRelationSync(ctx, pb.service, access)
+		if accessErr != nil {
+			return accessErr
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package business_test
+
+import (
+	"testing"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type PartitionRoleTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (p *PartitionRoleTestSuite) TestUpdatePartitionRole() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		partitionBusiness := business.NewPartitionBusiness(svc)
+		partitionRepo := repository.NewPartitionRepository(svc)
+
+		partition := p.CreatePartition(t, svc, nil)
+
+		_, err := partitionBusiness.CreatePartitionRole(ctx, &partitionv1.CreatePartitionRoleRequest{
+			PartitionId: partition.GetID(),
+			Name:        "cashier",
+			Properties:  map[string]string{"display_name": "Cashier", "till": "1"},
+		})
+		require.NoError(t, err)
+
+		_, err = partitionBusiness.CreatePartitionRole(ctx, &partitionv1.CreatePartitionRoleRequest{
+			PartitionId: partition.GetID(),
+			Name:        "Cashier",
+		})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err), "role names are unique per partition")
+
+		supervisor, err := partitionBusiness.CreatePartitionRole(ctx, &partitionv1.CreatePartitionRoleRequest{
+			PartitionId: partition.GetID(),
+			Name:        "supervisor",
+		})
+		require.NoError(t, err)
+
+		roles, err := partitionRepo.GetRoles(ctx, partition.GetID())
+		require.NoError(t, err)
+		require.Len(t, roles, 2)
+
+		cashierID := roles[0].GetID()
+		if roles[0].Name != "cashier" {
+			cashierID = roles[1].GetID()
+		}
+
+		updated, err := partitionBusiness.UpdatePartitionRole(ctx, &business.UpdatePartitionRoleRequest{
+			ID:          cashierID,
+			Name:        "head cashier",
+			Description: "Runs the tills",
+			UpdateMask:  []string{"name", "description"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "head cashier", updated.GetName())
+		assert.Equal(t, "Cashier", updated.GetProperties()["display_name"], "fields outside the mask are kept")
+		assert.Equal(t, "Runs the tills", updated.GetProperties()["description"])
+
+		_, err = partitionBusiness.UpdatePartitionRole(ctx, &business.UpdatePartitionRoleRequest{
+			ID:         cashierID,
+			Name:       supervisor.GetName(),
+			UpdateMask: []string{"name"},
+		})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+		_, err = partitionBusiness.UpdatePartitionRole(ctx, &business.UpdatePartitionRoleRequest{
+			ID:         cashierID,
+			UpdateMask: []string{"partition_id"},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+// TestPartitionRoles runs the partition role test suite.
+func TestPartitionRoles(t *testing.T) {
+	suite.Run(t, new(PartitionRoleTestSuite))
+}
@@ -0,0 +1,221 @@
+package business_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/pitabwire/frame"
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type PartitionSyncTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (p *PartitionSyncTestSuite) TestSyncCreatesAndUpdatesClient() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		fakeHydra := p.WithFakeHydra(t, svc)
+
+		partition := p.CreatePartition(t, svc, frame.JSONMap{
+			"redirect_uris": []any{"https://example.com/callback"},
+		})
+
+		err := business.SyncPartitionOnHydra(ctx, svc, partition)
+		require.NoError(t, err)
+
+		client, ok := fakeHydra.Client(partition.GetID())
+		require.True(t, ok, "client should be registered on hydra")
+		assert.Equal(t, partition.Name, client["client_name"])
+		assert.Equal(t, partition.GetID(), partition.Properties["client_id"])
+
+		partition.Name = "renamed partition"
+		err = business.SyncPartitionOnHydra(ctx, svc, partition)
+		require.NoError(t, err)
+
+		client, ok = fakeHydra.Client(partition.GetID())
+		require.True(t, ok)
+		assert.Equal(t, "renamed partition", client["client_name"])
+		assert.Equal(t, 1, fakeHydra.ClientCount())
+
+		methods := make([]string, 0)
+		for _, req := range fakeHydra.Requests() {
+			methods = append(methods, req.Method)
+		}
+		assert.Equal(t, []string{http.MethodPost, http.MethodGet, http.MethodPut}, methods)
+	})
+}
+
+func (p *PartitionSyncTestSuite) TestSyncDeletesClient() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		fakeHydra := p.WithFakeHydra(t, svc)
+
+		partition := p.CreatePartition(t, svc, frame.JSONMap{})
+
+		err := business.SyncPartitionOnHydra(ctx, svc, partition)
+		require.NoError(t, err)
+		require.Equal(t, 1, fakeHydra.ClientCount())
+
+		partition.DeletedAt.Time = time.Now()
+		partition.DeletedAt.Valid = true
+
+		err = business.SyncPartitionOnHydra(ctx, svc, partition)
+		require.NoError(t, err)
+		assert.Equal(t, 0, fakeHydra.ClientCount())
+	})
+}
+
+func (p *PartitionSyncTestSuite) TestSyncSurfacesHydraFaults() {
+	testCases := []struct {
+		name   string
+		method string
+		status int
+	}{
+		{
+			name:   "create rejected",
+			method: http.MethodPost,
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "create conflict",
+			method: http.MethodPost,
+			status: http.StatusConflict,
+		},
+	}
+
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		fakeHydra := p.WithFakeHydra(t, svc)
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				partition := p.CreatePartition(t, svc, frame.JSONMap{})
+
+				fakeHydra.FailNext(tc.method, tc.status)
+
+				err := business.SyncPartitionOnHydra(ctx, svc, partition)
+				require.Error(t, err)
+
+				_, ok := fakeHydra.Client(partition.GetID())
+				assert.False(t, ok, "client should not be registered after a failure")
+
+				fakeHydra.ClearFaults()
+
+				err = business.SyncPartitionOnHydra(ctx, svc, partition)
+				require.NoError(t, err, "sync should recover once hydra is healthy")
+			})
+		}
+	})
+}
+
+func (p *PartitionSyncTestSuite) TestSyncReconcilesHydra() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		fakeHydra := p.WithFakeHydra(t, svc)
+
+		partition := p.CreatePartition(t, svc, frame.JSONMap{
+			"redirect_uris": []any{"https://example.com/callback"},
+		})
+
+		err := business.SyncPartitionOnHydra(ctx, svc, partition)
+		require.NoError(t, err)
+
+		methodsSince := func(seen int) []string {
+			methods := make([]string, 0)
+			for _, req := range fakeHydra.Requests()[seen:] {
+				methods = append(methods, req.Method)
+			}
+			return methods
+		}
+
+		t.Run("client changed on hydra is overwritten", func(t *testing.T) {
+			fakeHydra.SetClient(partition.GetID(), map[string]any{"client_name": "tampered"})
+
+			err := business.SyncPartitionOnHydra(ctx, svc, partition)
+			require.NoError(t, err)
+
+			client, ok := fakeHydra.Client(partition.GetID())
+			require.True(t, ok)
+			assert.Equal(t, partition.Name, client["client_name"])
+			assert.NotEmpty(t, client["redirect_uris"])
+		})
+
+		t.Run("client removed from hydra is recreated", func(t *testing.T) {
+			fakeHydra.DeleteClient(partition.GetID())
+			seen := len(fakeHydra.Requests())
+
+			err := business.SyncPartitionOnHydra(ctx, svc, partition)
+			require.NoError(t, err)
+
+			_, ok := fakeHydra.Client(partition.GetID())
+			assert.True(t, ok, "client should be registered again")
+			assert.Equal(t, []string{http.MethodGet, http.MethodPost}, methodsSince(seen))
+		})
+
+		t.Run("failed lookup is retried on the next sync", func(t *testing.T) {
+			fakeHydra.FailNext(http.MethodGet, http.StatusServiceUnavailable)
+
+			err := business.SyncPartitionOnHydra(ctx, svc, partition)
+			require.Error(t, err, "the client exists, so creating it again is rejected")
+
+			fakeHydra.ClearFaults()
+			seen := len(fakeHydra.Requests())
+
+			err = business.SyncPartitionOnHydra(ctx, svc, partition)
+			require.NoError(t, err)
+			assert.Equal(t, []string{http.MethodGet, http.MethodPut}, methodsSince(seen))
+			assert.Equal(t, 1, fakeHydra.ClientCount())
+		})
+
+		t.Run("deleting a client already gone from hydra succeeds", func(t *testing.T) {
+			fakeHydra.DeleteClient(partition.GetID())
+
+			partition.DeletedAt.Time = time.Now()
+			partition.DeletedAt.Valid = true
+
+			err := business.SyncPartitionOnHydra(ctx, svc, partition)
+			require.NoError(t, err)
+			assert.Equal(t, 0, fakeHydra.ClientCount())
+		})
+	})
+}
+
+func (p *PartitionSyncTestSuite) TestSyncServiceAccountClient() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		fakeHydra := p.WithFakeHydra(t, svc)
+
+		partition := p.CreatePartition(t, svc, frame.JSONMap{
+			business.PropertyClientType: business.ClientTypeServiceAccount,
+			"jwks": map[string]any{"keys": []any{
+				map[string]any{"kty": "RSA", "kid": "key-1", "e": "AQAB", "n": "sXch"},
+			}},
+		})
+
+		err := business.SyncPartitionOnHydra(ctx, svc, partition)
+		require.NoError(t, err)
+
+		client, ok := fakeHydra.Client(partition.GetID())
+		require.True(t, ok)
+		assert.Equal(t, []any{"client_credentials"}, client["grant_types"])
+		assert.Equal(t, "private_key_jwt", client["token_endpoint_auth_method"])
+		assert.NotContains(t, client, "redirect_uris")
+
+		jwks, ok := client["jwks"].(map[string]any)
+		require.True(t, ok, "inline jwks should be pushed to hydra")
+		assert.Len(t, jwks["keys"], 1)
+	})
+}
+
+// TestPartitionSync runs the hydra synchronisation test suite against the fake hydra.
+func TestPartitionSync(t *testing.T) {
+	suite.Run(t, new(PartitionSyncTestSuite))
+}
@@ -0,0 +1,333 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/antinvestor/service-partition/config"
+	"github.com/antinvestor/service-partition/service/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+const (
+	permissionSeparator = ":"
+	permissionWildcard  = "*"
+
+	rolePropertyPermissions = "permissions"
+)
+
+// CheckPermissionRequest asks whether a profile holds a permission within a partition.
+type CheckPermissionRequest struct {
+	ProfileID   string
+	PartitionID string
+	Permission  string
+	// Context is what conditional role assignments are evaluated against.
+	Context *PermissionContext
+}
+
+// PermissionGrant explains which role assignment supplied a permission.
+type PermissionGrant struct {
+	AccessID          string
+	AccessRoleID      string
+	RoleID            string
+	RoleName          string
+	MatchedPermission string
+	// InheritedFromPartitionID is set when the role was inherited from an ancestor partition.
+	InheritedFromPartitionID string
+	// IncludedByRoleID is set when the role was included by the assigned role rather than assigned itself.
+	IncludedByRoleID string
+}
+
+// PermissionDecision is the outcome of a permission check with the reasoning behind it.
+type PermissionDecision struct {
+	Allowed    bool
+	Permission string
+	Reason     string
+	Grants     []*PermissionGrant
+	// ConditionsNotMet lists the roles left out because their assignment condition did not hold.
+	ConditionsNotMet []string
+}
+
+func permissionSegmentPattern() *regexp.Regexp {
+	return regexp.MustCompile(`^([a-z0-9][a-z0-9_.-]*|\*)$`)
+}
+
+// normalisePermissions validates permission strings such as `invoices:read` or `invoices:*`
+// and returns them lower cased, sorted and without duplicates.
+func normalisePermissions(permissions []string) ([]string, error) {
+	pattern := permissionSegmentPattern()
+
+	normalised := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		permission = strings.ToLower(strings.TrimSpace(permission))
+		if permission == "" {
+			continue
+		}
+
+		for _, segment := range strings.Split(permission, permissionSeparator) {
+			if !pattern.MatchString(segment) {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid permission %s", permission)
+			}
+		}
+
+		normalised = append(normalised, permission)
+	}
+
+	slices.Sort(normalised)
+	return slices.Compact(normalised), nil
+}
+
+// permissionsFromProperties reads the permissions supplied through role properties,
+// either as a comma separated string or as a list.
+func permissionsFromProperties(properties frame.JSONMap) ([]string, error) {
+	val, ok := properties[rolePropertyPermissions]
+	if !ok {
+		return nil, nil
+	}
+
+	var permissions []string
+	switch v := val.(type) {
+	case string:
+		permissions = strings.Split(v, ",")
+	case []any:
+		for _, item := range v {
+			if str, okStr := item.(string); okStr {
+				permissions = append(permissions, str)
+			}
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid permissions format: %v", val)
+	}
+
+	return normalisePermissions(permissions)
+}
+
+// PermissionMatches reports whether a granted permission covers the requested one.
+// A `*` segment matches any single segment, a trailing `*` also matches everything below it.
+func PermissionMatches(granted string, requested string) bool {
+	if granted == permissionWildcard || granted == requested {
+		return true
+	}
+
+	grantedSegments := strings.Split(granted, permissionSeparator)
+	requestedSegments := strings.Split(requested, permissionSeparator)
+
+	for i, segment := range grantedSegments {
+		if i >= len(requestedSegments) {
+			return false
+		}
+
+		if segment == permissionWildcard {
+			if i == len(grantedSegments)-1 {
+				return true
+			}
+			continue
+		}
+
+		if segment != requestedSegments[i] {
+			return false
+		}
+	}
+
+	return len(grantedSegments) == len(requestedSegments)
+}
+
+// resolvedRole is a partition role in force for an access, with the assignment that granted it.
+// includedBy is set when the role is not assigned itself but included by the assigned role.
+type resolvedRole struct {
+	accessRole *models.AccessRole
+	role       *models.PartitionRole
+	includedBy *models.PartitionRole
+	// inheritedFrom is the ancestor partition the role is inherited from, nil for a direct role.
+	inheritedFrom *models.Partition
+}
+
+// assignedRole is the role named by the assignment, which is where inheritance is decided.
+func (rr *resolvedRole) assignedRole() *models.PartitionRole {
+	if rr.includedBy != nil {
+		return rr.includedBy
+	}
+	return rr.role
+}
+
+// resolveAccessRoles loads the role assignments of an access that are in force right now
+// together with every role they include.
+func (ab *accessBusiness) resolveAccessRoles(ctx context.Context, accessID string) ([]*resolvedRole, error) {
+	accessRoles, err := ab.accessRepo.GetRoles(ctx, accessID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ab.resolveAssignments(ctx, accessRoles)
+}
+
+// resolveAssignments keeps the role assignments of an access that are in force right now, skipping removed roles,
+// and adds every role they include.
+func (ab *accessBusiness) resolveAssignments(
+	ctx context.Context,
+	accessRoles []*models.AccessRole,
+) ([]*resolvedRole, error) {
+	now := time.Now()
+	accessRoles = slices.DeleteFunc(accessRoles, func(accessRole *models.AccessRole) bool {
+		return !accessRole.IsActiveAt(now)
+	})
+
+	if len(accessRoles) == 0 {
+		return nil, nil
+	}
+
+	roleIDs := make([]string, 0, len(accessRoles))
+	for _, accessRole := range accessRoles {
+		roleIDs = append(roleIDs, accessRole.PartitionRoleID)
+	}
+
+	partitionRoles, err := ab.partitionRepo.GetRolesByID(ctx, roleIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	roleMap := make(map[string]*models.PartitionRole, len(partitionRoles))
+	for _, partitionRole := range partitionRoles {
+		roleMap[partitionRole.GetID()] = partitionRole
+	}
+
+	resolved := make([]*resolvedRole, 0, len(accessRoles))
+	assignments := make(map[string]*models.AccessRole, len(accessRoles))
+	assignedRoles := make([]*models.PartitionRole, 0, len(accessRoles))
+	for _, accessRole := range accessRoles {
+		role, ok := roleMap[accessRole.PartitionRoleID]
+		if !ok {
+			continue
+		}
+		if _, duplicate := assignments[role.GetID()]; duplicate {
+			continue
+		}
+		assignments[role.GetID()] = accessRole
+		assignedRoles = append(assignedRoles, role)
+		resolved = append(resolved, &resolvedRole{accessRole: accessRole, role: role})
+	}
+
+	includedRoles, err := expandRoleIncludes(ctx, ab.partitionRepo, assignedRoles)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, included := range includedRoles {
+		resolved = append(resolved, &resolvedRole{
+			accessRole: assignments[included.assigned.GetID()],
+			role:       included.role,
+			includedBy: included.assigned,
+		})
+	}
+
+	return resolved, nil
+}
+
+// CheckPermission resolves access, access roles, partition roles and finally
+// permissions to decide whether the profile may perform the action.
+func (ab *accessBusiness) CheckPermission(
+	ctx context.Context,
+	request *CheckPermissionRequest,
+) (*PermissionDecision, error) {
+	permissions, err := normalisePermissions([]string{request.Permission})
+	if err != nil {
+		return nil, err
+	}
+	if len(permissions) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "permission is required")
+	}
+
+	decision := &PermissionDecision{Permission: permissions[0]}
+
+	partition, err := ab.partitionRepo.GetByID(ctx, request.PartitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	effective, err := ab.resolveEffectiveAccess(ctx, partition, request.ProfileID)
+	if err != nil {
+		if frame.ErrorIsNoRows(err) {
+			decision.Reason = fmt.Sprintf("profile %s has no access to partition %s",
+				request.ProfileID, request.PartitionID)
+			return decision, nil
+		}
+		return nil, err
+	}
+
+	access := effective.access
+	if !access.IsActive() {
+		decision.Reason = fmt.Sprintf("access %s is %s", access.GetID(), access.EffectiveState(time.Now()))
+		return decision, nil
+	}
+
+	cfg, ok := ab.service.Config().(*config.PartitionConfig)
+	if !ok {
+		return nil, errors.New("invalid configuration type")
+	}
+
+	effective.roles, decision.ConditionsNotMet, err = applyConditions(effective.roles, request.Context,
+		cfg.AccessConditionMaxCost)
+	if err != nil {
+		return nil, err
+	}
+
+	return explainPermission(decision, effective), nil
+}
+
+func explainPermission(decision *PermissionDecision, effective *effectiveAccess) *PermissionDecision {
+	roleNames := make([]string, 0, len(effective.roles))
+	grantedBy := make([]string, 0, len(effective.roles))
+	for _, resolved := range effective.roles {
+		roleNames = append(roleNames, resolved.role.Name)
+
+		for _, granted := range resolved.role.Permissions {
+			if !PermissionMatches(granted, decision.Permission) {
+				continue
+			}
+
+			grant := &PermissionGrant{
+				AccessID:          resolved.accessRole.AccessID,
+				AccessRoleID:      resolved.accessRole.GetID(),
+				RoleID:            resolved.role.GetID(),
+				RoleName:          resolved.role.Name,
+				MatchedPermission: granted,
+			}
+
+			explanation := fmt.Sprintf("%s via %s", resolved.role.Name, granted)
+			if resolved.includedBy != nil {
+				grant.IncludedByRoleID = resolved.includedBy.GetID()
+				explanation += fmt.Sprintf(" (included by %s)", resolved.includedBy.Name)
+			}
+			if resolved.inheritedFrom != nil {
+				grant.InheritedFromPartitionID = resolved.inheritedFrom.GetID()
+				explanation += fmt.Sprintf(" inherited from ancestor partition %s (%s)",
+					resolved.inheritedFrom.GetID(), resolved.inheritedFrom.Name)
+			}
+
+			decision.Grants = append(decision.Grants, grant)
+			grantedBy = append(grantedBy, explanation)
+			break
+		}
+	}
+
+	if len(decision.Grants) == 0 {
+		decision.Reason = fmt.Sprintf("none of the roles [%s] grant %s",
+			strings.Join(roleNames, ", "), decision.Permission)
+		if len(decision.ConditionsNotMet) > 0 {
+			decision.Reason += fmt.Sprintf(", not applied: %s", strings.Join(decision.ConditionsNotMet, ", "))
+		}
+		return decision
+	}
+
+	decision.Allowed = true
+	decision.Reason = "granted by " + strings.Join(grantedBy, ", ")
+	return decision
+}
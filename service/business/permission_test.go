@@ -0,0 +1,101 @@
+package business_test
+
+import (
+	"testing"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+func TestPermissionMatches(t *testing.T) {
+	testCases := []struct {
+		name      string
+		granted   string
+		requested string
+		want      bool
+	}{
+		{name: "exact", granted: "invoices:read", requested: "invoices:read", want: true},
+		{name: "different action", granted: "invoices:read", requested: "invoices:write", want: false},
+		{name: "global wildcard", granted: "*", requested: "invoices:write", want: true},
+		{name: "trailing wildcard", granted: "invoices:*", requested: "invoices:write", want: true},
+		{name: "trailing wildcard nested", granted: "invoices:*", requested: "invoices:lines:write", want: true},
+		{name: "inner wildcard", granted: "*:read", requested: "invoices:read", want: true},
+		{name: "inner wildcard mismatch", granted: "*:read", requested: "invoices:write", want: false},
+		{name: "broader request", granted: "invoices:read", requested: "invoices", want: false},
+		{name: "narrower request", granted: "invoices", requested: "invoices:read", want: false},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, business.PermissionMatches(tt.granted, tt.requested))
+		})
+	}
+}
+
+type PermissionTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (p *PermissionTestSuite) TestCheckPermission() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+
+		role := &models.PartitionRole{
+			Name:        "accountant",
+			Permissions: []string{"invoices:*", "reports:read"},
+		}
+		partition := p.CreatePartition(t, svc, nil, role)
+
+		access, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "accountant-profile",
+		})
+		require.NoError(t, err)
+
+		_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+			AccessId:        access.GetAccessId(),
+			PartitionRoleId: role.GetID(),
+		})
+		require.NoError(t, err)
+
+		decision, err := accessBusiness.CheckPermission(ctx, &business.CheckPermissionRequest{
+			ProfileID:   "accountant-profile",
+			PartitionID: partition.GetID(),
+			Permission:  "invoices:approve",
+		})
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed)
+		require.Len(t, decision.Grants, 1)
+		assert.Equal(t, "invoices:*", decision.Grants[0].MatchedPermission)
+		assert.Contains(t, decision.Reason, "accountant")
+
+		decision, err = accessBusiness.CheckPermission(ctx, &business.CheckPermissionRequest{
+			ProfileID:   "accountant-profile",
+			PartitionID: partition.GetID(),
+			Permission:  "reports:write",
+		})
+		require.NoError(t, err)
+		assert.False(t, decision.Allowed)
+
+		decision, err = accessBusiness.CheckPermission(ctx, &business.CheckPermissionRequest{
+			ProfileID:   "stranger-profile",
+			PartitionID: partition.GetID(),
+			Permission:  "reports:read",
+		})
+		require.NoError(t, err)
+		assert.False(t, decision.Allowed)
+		assert.Contains(t, decision.Reason, "no access")
+	})
+}
+
+// TestPermissions runs the permission check test suite.
+func TestPermissions(t *testing.T) {
+	suite.Run(t, new(PermissionTestSuite))
+}
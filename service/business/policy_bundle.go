@@ -0,0 +1,390 @@
+package business
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+const (
+	policyBundleRoot = "partition"
+
+	policyBundleAccessPageSize = 500
+)
+
+// PolicyBundleRequest selects what goes into a policy bundle, either a whole tenant or,
+// when PartitionID is set, a partition and its descendants.
+type PolicyBundleRequest struct {
+	TenantID    string
+	PartitionID string
+}
+
+// PolicyBundle is an Open Policy Agent bundle. The revision is derived from the data,
+// so an unchanged bundle keeps its revision between builds.
+type PolicyBundle struct {
+	Revision string
+	Roots    []string
+	Data     []byte
+	BuiltAt  time.Time
+}
+
+type policyRole struct {
+	Name          string   `json:"name"`
+	Permissions   []string `json:"permissions"`
+	Inheritable   bool     `json:"inheritable"`
+	GuestEligible bool     `json:"guest_eligible"`
+	Includes      []string `json:"includes"`
+}
+
+type policyAccessRole struct {
+	RoleID     string     `json:"role_id"`
+	Name       string     `json:"name"`
+	Condition  string     `json:"condition,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+}
+
+// policyAccess lists the assigned roles as well as the permissions they add up to, conditional
+// assignments are left out of the permissions as OPA can not evaluate their conditions.
+// Guests only hold their guest eligible roles.
+type policyAccess struct {
+	AccessID    string              `json:"access_id"`
+	Guest       bool                `json:"guest"`
+	ValidUntil  *time.Time          `json:"valid_until,omitempty"`
+	Roles       []*policyAccessRole `json:"roles"`
+	Permissions []string            `json:"permissions"`
+}
+
+type policyPartition struct {
+	Name      string                   `json:"name"`
+	ParentID  string                   `json:"parent_id"`
+	Ancestors []string                 `json:"ancestors"`
+	Roles     map[string]*policyRole   `json:"roles"`
+	Access    map[string]*policyAccess `json:"access"`
+}
+
+type policyTenant struct {
+	Partitions map[string]*policyPartition `json:"partitions"`
+}
+
+type policyData struct {
+	Tenants map[string]*policyTenant `json:"tenants"`
+}
+
+// policyAncestors lists the ancestors of a partition closest first, stopping at a missing parent or a cycle.
+func policyAncestors(partitions map[string]*models.Partition, partition *models.Partition) []string {
+	ancestorIDs := make([]string, 0)
+	visited := map[string]bool{partition.GetID(): true}
+
+	parentID := partition.ParentID
+	for depth := 0; parentID != "" && depth < maxPartitionDepth && !visited[parentID]; depth++ {
+		parent, ok := partitions[parentID]
+		if !ok {
+			break
+		}
+		visited[parentID] = true
+		ancestorIDs = append(ancestorIDs, parentID)
+		parentID = parent.ParentID
+	}
+
+	return ancestorIDs
+}
+
+// policyPermissions adds up the permissions of the assigned roles and every role they include,
+// for a guest only those of guest eligible roles.
+func policyPermissions(roles map[string]*models.PartitionRole, assignedRoleIDs []string, guest bool) []string {
+	var permissions []string
+	seen := make(map[string]bool)
+	pending := slices.Clone(assignedRoleIDs)
+
+	for len(pending) > 0 {
+		roleID := pending[0]
+		pending = pending[1:]
+		if seen[roleID] {
+			continue
+		}
+		seen[roleID] = true
+
+		role, ok := roles[roleID]
+		if !ok {
+			continue
+		}
+
+		if !guest || role.GuestEligible {
+			permissions = append(permissions, role.Permissions...)
+		}
+		pending = append(pending, role.IncludedRoleIDs...)
+	}
+
+	slices.Sort(permissions)
+	return slices.Compact(permissions)
+}
+
+func bundlePartitions(
+	ctx context.Context,
+	partitionRepo repository.PartitionRepository,
+	request *PolicyBundleRequest,
+) (string, map[string]*models.Partition, []*models.Partition, error) {
+	tenantID := request.TenantID
+	if request.PartitionID != "" {
+		partition, err := partitionRepo.GetByID(ctx, request.PartitionID)
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		if tenantID != "" && tenantID != partition.TenantID {
+			return "", nil, nil, status.Errorf(codes.InvalidArgument,
+				"partition %s does not belong to tenant %s", partition.GetID(), tenantID)
+		}
+		tenantID = partition.TenantID
+	}
+
+	if tenantID == "" {
+		return "", nil, nil, status.Error(codes.InvalidArgument, "a tenant or partition is required")
+	}
+
+	tenantPartitions, err := partitionRepo.GetByTenant(ctx, tenantID)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	partitionMap := make(map[string]*models.Partition, len(tenantPartitions))
+	for _, partition := range tenantPartitions {
+		partitionMap[partition.GetID()] = partition
+	}
+
+	if request.PartitionID == "" {
+		return tenantID, partitionMap, tenantPartitions, nil
+	}
+
+	selected := make([]*models.Partition, 0)
+	for _, partition := range tenantPartitions {
+		if partition.GetID() == request.PartitionID ||
+			slices.Contains(policyAncestors(partitionMap, partition), request.PartitionID) {
+			selected = append(selected, partition)
+		}
+	}
+
+	return tenantID, partitionMap, selected, nil
+}
+
+func bundlePartitionAccess(
+	ctx context.Context,
+	accessRepo repository.AccessRepository,
+	partitionID string,
+	roles map[string]*models.PartitionRole,
+	now time.Time,
+) (map[string]*policyAccess, error) {
+	accessMap := make(map[string]*policyAccess)
+	filter := &repository.AccessFilter{ActiveAt: &now}
+
+	for page := uint32(0); ; page++ {
+		accessList, err := accessRepo.ListByPartition(ctx, partitionID, filter, policyBundleAccessPageSize, page)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(accessList) == 0 {
+			return accessMap, nil
+		}
+
+		accessIDs := make([]string, 0, len(accessList))
+		for _, access := range accessList {
+			accessIDs = append(accessIDs, access.GetID())
+		}
+
+		accessRoles, err := accessRepo.GetRolesByAccessIDs(ctx, accessIDs...)
+		if err != nil {
+			return nil, err
+		}
+
+		rolesByAccess := make(map[string][]*models.AccessRole, len(accessList))
+		for _, accessRole := range accessRoles {
+			rolesByAccess[accessRole.AccessID] = append(rolesByAccess[accessRole.AccessID], accessRole)
+		}
+
+		for _, access := range accessList {
+			entry := &policyAccess{
+				AccessID:   access.GetID(),
+				Guest:      access.IsGuest(),
+				ValidUntil: access.ValidUntil,
+				Roles:      make([]*policyAccessRole, 0),
+			}
+
+			var unconditional []string
+			for _, accessRole := range rolesByAccess[access.GetID()] {
+				role, ok := roles[accessRole.PartitionRoleID]
+				if !ok || !accessRole.IsActiveAt(now) {
+					continue
+				}
+
+				if !isConditional(accessRole) {
+					unconditional = append(unconditional, role.GetID())
+				}
+
+				// An assignment whose role was closed to guests is left out, the eligible roles it includes still count.
+				if entry.Guest && !role.GuestEligible {
+					continue
+				}
+
+				entry.Roles = append(entry.Roles, &policyAccessRole{
+					RoleID:     role.GetID(),
+					Name:       role.Name,
+					Condition:  accessRole.Condition,
+					ValidUntil: accessRole.ValidUntil,
+				})
+			}
+
+			slices.SortFunc(entry.Roles, func(a, b *policyAccessRole) int {
+				return strings.Compare(a.RoleID, b.RoleID)
+			})
+			entry.Permissions = policyPermissions(roles, unconditional, entry.Guest)
+			if entry.Permissions == nil {
+				entry.Permissions = make([]string, 0)
+			}
+
+			accessMap[access.ProfileID] = entry
+		}
+
+		if len(accessList) < policyBundleAccessPageSize {
+			return accessMap, nil
+		}
+	}
+}
+
+// BuildPolicyBundle gathers the partitions, their hierarchy, roles, permissions and active
+// access assignments of a tenant, or of a partition subtree, into an OPA bundle.
+func BuildPolicyBundle(
+	ctx context.Context,
+	service *frame.Service,
+	request *PolicyBundleRequest,
+) (*PolicyBundle, error) {
+	partitionRepo := repository.NewPartitionRepository(service)
+	accessRepo := repository.NewAccessRepository(service)
+
+	tenantID, partitionMap, selected, err := bundlePartitions(ctx, partitionRepo, request)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tenant := &policyTenant{Partitions: make(map[string]*policyPartition, len(selected))}
+	for _, partition := range selected {
+		partitionRoles, roleErr := partitionRepo.GetRoles(ctx, partition.GetID())
+		if roleErr != nil {
+			return nil, roleErr
+		}
+
+		roles := make(map[string]*models.PartitionRole, len(partitionRoles))
+		entry := &policyPartition{
+			Name:      partition.Name,
+			ParentID:  partition.ParentID,
+			Ancestors: policyAncestors(partitionMap, partition),
+			Roles:     make(map[string]*policyRole, len(partitionRoles)),
+		}
+
+		for _, role := range partitionRoles {
+			roles[role.GetID()] = role
+			entry.Roles[role.GetID()] = &policyRole{
+				Name:          role.Name,
+				Permissions:   append(make([]string, 0, len(role.Permissions)), role.Permissions...),
+				Inheritable:   role.Inheritable,
+				GuestEligible: role.GuestEligible,
+				Includes:      append(make([]string, 0, len(role.IncludedRoleIDs)), role.IncludedRoleIDs...),
+			}
+		}
+
+		entry.Access, err = bundlePartitionAccess(ctx, accessRepo, partition.GetID(), roles, now)
+		if err != nil {
+			return nil, err
+		}
+
+		tenant.Partitions[partition.GetID()] = entry
+	}
+
+	data, err := json.Marshal(map[string]any{
+		policyBundleRoot: &policyData{Tenants: map[string]*policyTenant{tenantID: tenant}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(data)
+	bundle := &PolicyBundle{
+		Revision: hex.EncodeToString(digest[:]),
+		Data:     data,
+		BuiltAt:  now,
+	}
+
+	tenantRoot := fmt.Sprintf("%s/tenants/%s", policyBundleRoot, tenantID)
+	if request.PartitionID == "" {
+		bundle.Roots = []string{tenantRoot}
+	} else {
+		for partitionID := range tenant.Partitions {
+			bundle.Roots = append(bundle.Roots, fmt.Sprintf("%s/partitions/%s", tenantRoot, partitionID))
+		}
+		slices.Sort(bundle.Roots)
+	}
+
+	return bundle, nil
+}
+
+// Write streams the bundle as the gzipped tarball OPA expects, holding `data.json` and `.manifest`.
+func (pb *PolicyBundle) Write(w io.Writer) error {
+	manifest, err := json.Marshal(map[string]any{
+		"revision": pb.Revision,
+		"roots":    pb.Roots,
+	})
+	if err != nil {
+		return err
+	}
+
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{name: "/data.json", content: pb.Data},
+		{name: "/.manifest", content: manifest},
+	}
+
+	for _, file := range files {
+		err = tarWriter.WriteHeader(&tar.Header{
+			Name:    file.name,
+			Mode:    0o644,
+			Size:    int64(len(file.content)),
+			ModTime: pb.BuiltAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = tarWriter.Write(file.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	return gzipWriter.Close()
+}
@@ -0,0 +1,146 @@
+package business_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"testing"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+func readBundle(t *testing.T, bundle *business.PolicyBundle) map[string][]byte {
+	var buf bytes.Buffer
+	require.NoError(t, bundle.Write(&buf))
+
+	gzipReader, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+
+	files := make(map[string][]byte)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, nextErr := tarReader.Next()
+		if nextErr == io.EOF {
+			break
+		}
+		require.NoError(t, nextErr)
+
+		content, readErr := io.ReadAll(tarReader)
+		require.NoError(t, readErr)
+		files[header.Name] = content
+	}
+
+	return files
+}
+
+type PolicyBundleTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (p *PolicyBundleTestSuite) TestBuildPolicyBundle() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+		partitionRepo := repository.NewPartitionRepository(svc)
+
+		viewer := &models.PartitionRole{
+			Name:        "viewer",
+			Permissions: []string{"reports:read"},
+		}
+		parent := p.CreatePartition(t, svc, nil, viewer)
+		child := &models.Partition{
+			Name:      "branch",
+			ParentID:  parent.GetID(),
+			BaseModel: frame.BaseModel{TenantID: parent.TenantID},
+		}
+		require.NoError(t, partitionRepo.Save(ctx, child))
+
+		manager := models.PartitionRole{
+			Name:            "manager",
+			Permissions:     []string{"reports:write"},
+			Inheritable:     true,
+			IncludedRoleIDs: []string{viewer.GetID()},
+			BaseModel:       frame.BaseModel{TenantID: parent.TenantID, PartitionID: parent.GetID()},
+		}
+		require.NoError(t, partitionRepo.SaveRole(ctx, &manager))
+
+		access, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+			PartitionId: parent.GetID(),
+			ProfileId:   "bundle-profile",
+		})
+		require.NoError(t, err)
+
+		_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+			AccessId:        access.GetAccessId(),
+			PartitionRoleId: manager.GetID(),
+		})
+		require.NoError(t, err)
+
+		bundle, err := business.BuildPolicyBundle(ctx, svc, &business.PolicyBundleRequest{TenantID: parent.TenantID})
+		require.NoError(t, err)
+		assert.NotEmpty(t, bundle.Revision)
+		assert.Equal(t, []string{"partition/tenants/" + parent.TenantID}, bundle.Roots)
+
+		files := readBundle(t, bundle)
+		require.Contains(t, files, "/data.json")
+		require.Contains(t, files, "/.manifest")
+
+		var manifest map[string]any
+		require.NoError(t, json.Unmarshal(files["/.manifest"], &manifest))
+		assert.Equal(t, bundle.Revision, manifest["revision"])
+
+		var data struct {
+			Partition struct {
+				Tenants map[string]struct {
+					Partitions map[string]struct {
+						ParentID  string   `json:"parent_id"`
+						Ancestors []string `json:"ancestors"`
+						Access    map[string]struct {
+							Permissions []string `json:"permissions"`
+						} `json:"access"`
+					} `json:"partitions"`
+				} `json:"tenants"`
+			} `json:"partition"`
+		}
+		require.NoError(t, json.Unmarshal(files["/data.json"], &data))
+
+		partitions := data.Partition.Tenants[parent.TenantID].Partitions
+		require.Len(t, partitions, 2)
+		assert.Equal(t, []string{parent.GetID()}, partitions[child.GetID()].Ancestors)
+		assert.Equal(t, []string{"reports:read", "reports:write"},
+			partitions[parent.GetID()].Access["bundle-profile"].Permissions)
+
+		rebuilt, err := business.BuildPolicyBundle(ctx, svc, &business.PolicyBundleRequest{TenantID: parent.TenantID})
+		require.NoError(t, err)
+		assert.Equal(t, bundle.Revision, rebuilt.Revision, "unchanged data keeps its revision")
+
+		partitionBundle, err := business.BuildPolicyBundle(ctx, svc, &business.PolicyBundleRequest{
+			PartitionID: child.GetID(),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"partition/tenants/" + parent.TenantID + "/partitions/" + child.GetID()},
+			partitionBundle.Roots)
+
+		_, err = business.BuildPolicyBundle(ctx, svc, &business.PolicyBundleRequest{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+// TestPolicyBundles runs the policy bundle test suite.
+func TestPolicyBundles(t *testing.T) {
+	suite.Run(t, new(PolicyBundleTestSuite))
+}
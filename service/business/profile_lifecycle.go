@@ -0,0 +1,292 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+const (
+	ProfileEventDeleted     = "profile.deleted"
+	ProfileEventMerged      = "profile.merged"
+	ProfileEventDeactivated = "profile.deactivated"
+
+	// maxProfileAccessBatches bounds the batches a single profile event works through.
+	maxProfileAccessBatches = 1000
+)
+
+// ProfileEvent is a lifecycle change published by the profile service. For a merge
+// ProfileID is the profile merged away and TargetProfileID the one that survives.
+type ProfileEvent struct {
+	Type            string `json:"type"`
+	ProfileID       string `json:"profile_id"`
+	TargetProfileID string `json:"target_profile_id,omitempty"`
+}
+
+// HandleProfileEvent brings the accesses, access requests and sponsored guests of a profile in line
+// with its lifecycle. Handling an event again finds nothing left to do, so redelivered events are harmless.
+func HandleProfileEvent(ctx context.Context, service *frame.Service, event *ProfileEvent) error {
+	if event.ProfileID == "" {
+		return fmt.Errorf("profile event %s has no profile id", event.Type)
+	}
+
+	handler := &profileLifecycle{
+		service:     service,
+		accessRepo:  repository.NewAccessRepository(service),
+		requestRepo: repository.NewAccessRequestRepository(service),
+		requests:    newAccessRequestBusiness(ctx, service),
+	}
+
+	switch event.Type {
+	case ProfileEventDeleted:
+		err := handler.eachAccess(ctx, event.ProfileID, nil, handler.removeAccess)
+		if err != nil {
+			return err
+		}
+		return handler.replaceProfile(ctx, event.ProfileID, "")
+	case ProfileEventDeactivated:
+		filter := &repository.AccessFilter{States: []models.AccessState{models.AccessStateActive}}
+		return handler.eachAccess(ctx, event.ProfileID, filter, handler.suspendAccess)
+	case ProfileEventMerged:
+		if event.TargetProfileID == "" || event.TargetProfileID == event.ProfileID {
+			return fmt.Errorf("profile merge of %s has no distinct surviving profile", event.ProfileID)
+		}
+		err := handler.eachAccess(ctx, event.ProfileID, nil, func(ctx context.Context, access *models.Access) error {
+			return handler.mergeAccess(ctx, access, event.TargetProfileID)
+		})
+		if err != nil {
+			return err
+		}
+		return handler.replaceProfile(ctx, event.ProfileID, event.TargetProfileID)
+	default:
+		service.Log(ctx).WithField("type", event.Type).Debug(" ignoring unknown profile event")
+		return nil
+	}
+}
+
+type profileLifecycle struct {
+	service     *frame.Service
+	accessRepo  repository.AccessRepository
+	requestRepo repository.AccessRequestRepository
+	requests    *accessRequestBusiness
+}
+
+// eachAccess applies the action to the accesses of a profile batch by batch. Every action moves the
+// access out of the listing, so the first page is read until it comes back empty.
+func (pl *profileLifecycle) eachAccess(
+	ctx context.Context,
+	profileID string,
+	filter *repository.AccessFilter,
+	action func(ctx context.Context, access *models.Access) error,
+) error {
+	for batch := 0; batch < maxProfileAccessBatches; batch++ {
+		accessList, err := pl.accessRepo.ListByProfile(ctx, profileID, filter, maxAccessPageSize, 0)
+		if err != nil {
+			return err
+		}
+
+		if len(accessList) == 0 {
+			return nil
+		}
+
+		for _, access := range accessList {
+			err = action(ctx, access)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return fmt.Errorf("profile %s still has accesses after %d batches", profileID, maxProfileAccessBatches)
+}
+
+// removeAccess deletes the access and its roles, the deleted row no longer names the profile.
+func (pl *profileLifecycle) removeAccess(ctx context.Context, access *models.Access) error {
+	removed := *access
+	access.ProfileID = ""
+	access.State = models.AccessStateRevoked
+	access.StateReason = "profile deleted"
+
+	err := pl.accessRepo.ApplyChanges(ctx, &repository.AccessChange{
+		Access:        access,
+		ExpectedState: removed.State,
+		Remove:        true,
+	})
+	if err != nil {
+		return err
+	}
+
+	return pl.announce(ctx, &removed, EventAccessRemoved, map[string]string{"reason": "profile deleted"})
+}
+
+// suspendAccess suspends an access that is still active, one revoked or suspended in the meantime is left as it is.
+func (pl *profileLifecycle) suspendAccess(ctx context.Context, access *models.Access) error {
+	expected := access.State
+	access.State = models.AccessStateSuspended
+	access.StateReason = "profile deactivated"
+
+	err := pl.accessRepo.ApplyChanges(ctx, &repository.AccessChange{Access: access, ExpectedState: expected})
+	if errors.Is(err, repository.ErrAccessChanged) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return QueueAccessRelationSync(ctx, pl.service, access)
+}
+
+// mergeAccess moves an access over to the surviving profile. When the survivor already has
+// access to the partition the survivor's access is kept unless it was revoked, and the duplicate
+// is removed. Roles of the duplicate are only carried over while they are in force, a revoked or
+// suspended access never hands its roles to a live one.
+func (pl *profileLifecycle) mergeAccess(ctx context.Context, access *models.Access, survivorID string) error {
+	survivor, err := pl.accessRepo.GetByPartitionAndProfile(ctx, access.PartitionID, survivorID)
+	if err != nil {
+		if !frame.ErrorIsNoRows(err) {
+			return err
+		}
+
+		previous := *access
+		access.ProfileID = survivorID
+		err = pl.accessRepo.ApplyChanges(ctx, &repository.AccessChange{Access: access, ExpectedState: access.State})
+		if err != nil {
+			return err
+		}
+
+		// Clears the relations keto still holds for the merged profile.
+		err = QueueAccessRelationSync(ctx, pl.service, &previous)
+		if err != nil {
+			return err
+		}
+
+		return pl.announce(ctx, access, EventAccessMerged, map[string]string{"merged_access_id": access.GetID()})
+	}
+
+	kept, duplicate := survivor, access
+	if survivor.State == models.AccessStateRevoked && access.State != models.AccessStateRevoked {
+		kept, duplicate = access, survivor
+	}
+
+	keptRoles, err := pl.accessRepo.GetRoles(ctx, kept.GetID())
+	if err != nil {
+		return err
+	}
+
+	duplicateRoles := make([]*models.AccessRole, 0)
+	if duplicate.State == models.AccessStateActive || duplicate.State == kept.State {
+		duplicateRoles, err = pl.accessRepo.GetRoles(ctx, duplicate.GetID())
+		if err != nil {
+			return err
+		}
+	}
+
+	held := make(map[string]bool, len(keptRoles))
+	for _, accessRole := range keptRoles {
+		held[accessRole.PartitionRoleID] = true
+	}
+
+	previous := *kept
+	kept.ProfileID = survivorID
+	keptChange := &repository.AccessChange{Access: kept, ExpectedState: kept.State}
+	for _, accessRole := range duplicateRoles {
+		if held[accessRole.PartitionRoleID] {
+			continue
+		}
+		held[accessRole.PartitionRoleID] = true
+
+		keptChange.AddRoles = append(keptChange.AddRoles, &models.AccessRole{
+			PartitionRoleID: accessRole.PartitionRoleID,
+			ValidFrom:       accessRole.ValidFrom,
+			ValidUntil:      accessRole.ValidUntil,
+			Condition:       accessRole.Condition,
+			ExpiredAt:       accessRole.ExpiredAt,
+		})
+	}
+
+	// The duplicate is removed first so that two live accesses never share the partition and profile.
+	err = pl.accessRepo.ApplyChanges(ctx,
+		&repository.AccessChange{Access: duplicate, ExpectedState: duplicate.State, Remove: true}, keptChange)
+	if err != nil {
+		return err
+	}
+
+	for _, stale := range []*models.Access{duplicate, &previous} {
+		err = QueueAccessRelationSync(ctx, pl.service, stale)
+		if err != nil {
+			return err
+		}
+	}
+
+	return pl.announce(ctx, kept, EventAccessMerged, map[string]string{"merged_access_id": duplicate.GetID()})
+}
+
+// replaceProfile hands what else names the profile over to the surviving profile of a merge, or to no
+// profile once it is deleted. Pending requests the replacement can not take over are cancelled first,
+// guests of a deleted sponsor keep their access unsponsored until it lapses.
+func (pl *profileLifecycle) replaceProfile(ctx context.Context, profileID string, replacementID string) error {
+	reason := "profile deleted"
+	if replacementID != "" {
+		reason = fmt.Sprintf("profile merged into %s", replacementID)
+	}
+
+	pending, err := pl.requestRepo.ListPendingByProfile(ctx, profileID)
+	if err != nil {
+		return err
+	}
+
+	for _, accessRequest := range pending {
+		if replacementID != "" {
+			_, err = pl.requestRepo.GetPending(ctx, accessRequest.PartitionID, replacementID,
+				accessRequest.PartitionRoleID)
+			if frame.ErrorIsNoRows(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = pl.requests.decide(ctx, accessRequest, models.AccessRequestStateCancelled, "", reason, nil)
+		// A request decided in the meantime has nothing left to cancel.
+		if err != nil && status.Code(err) != codes.FailedPrecondition {
+			return err
+		}
+	}
+
+	err = pl.requestRepo.ReplaceProfile(ctx, profileID, replacementID)
+	if err != nil {
+		return err
+	}
+
+	return pl.accessRepo.ReplaceSponsor(ctx, profileID, replacementID)
+}
+
+// announce syncs the access on keto and tells other services what happened to it.
+func (pl *profileLifecycle) announce(
+	ctx context.Context,
+	access *models.Access,
+	eventType string,
+	attributes map[string]string,
+) error {
+	err := QueueAccessRelationSync(ctx, pl.service, access)
+	if err != nil {
+		return err
+	}
+
+	return PublishAccessEvent(ctx, pl.service, &AccessEvent{
+		Type:        eventType,
+		TenantID:    access.TenantID,
+		PartitionID: access.PartitionID,
+		ProfileID:   access.ProfileID,
+		AccessID:    access.GetID(),
+		Attributes:  attributes,
+	})
+}
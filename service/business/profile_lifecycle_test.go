@@ -0,0 +1,253 @@
+package business_test
+
+import (
+	"testing"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type ProfileLifecycleTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (p *ProfileLifecycleTestSuite) TestProfileLifecycleEvents() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+		accessRepo := repository.NewAccessRepository(svc)
+
+		roles := map[string]*models.PartitionRole{"viewer": {Name: "viewer"}, "editor": {Name: "editor"}}
+		partition := p.CreatePartition(t, svc, nil, roles["viewer"], roles["editor"])
+		otherPartition := p.CreatePartition(t, svc, nil)
+
+		grant := func(partitionID string, profileID string, roleIDs ...string) string {
+			access, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+				PartitionId: partitionID,
+				ProfileId:   profileID,
+			})
+			require.NoError(t, err)
+			for _, roleID := range roleIDs {
+				_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+					AccessId:        access.GetAccessId(),
+					PartitionRoleId: roleID,
+				})
+				require.NoError(t, err)
+			}
+			return access.GetAccessId()
+		}
+
+		survivorAccessID := grant(partition.GetID(), "survivor-profile", roles["viewer"].GetID())
+		grant(partition.GetID(), "merged-profile", roles["viewer"].GetID(), roles["editor"].GetID())
+		movedAccessID := grant(otherPartition.GetID(), "merged-profile")
+
+		err := business.HandleProfileEvent(ctx, svc, &business.ProfileEvent{
+			Type:            business.ProfileEventMerged,
+			ProfileID:       "merged-profile",
+			TargetProfileID: "survivor-profile",
+		})
+		require.NoError(t, err)
+
+		merged, err := accessRepo.ListByProfile(ctx, "merged-profile", nil, 10, 0)
+		require.NoError(t, err)
+		assert.Empty(t, merged)
+
+		survivorRoles, err := accessRepo.GetRoles(ctx, survivorAccessID)
+		require.NoError(t, err)
+		assert.Len(t, survivorRoles, 2, "roles of the duplicate are combined without repeats")
+
+		moved, err := accessRepo.GetByID(ctx, movedAccessID)
+		require.NoError(t, err)
+		assert.Equal(t, "survivor-profile", moved.ProfileID, "accesses without a duplicate are re-pointed")
+
+		err = business.HandleProfileEvent(ctx, svc, &business.ProfileEvent{
+			Type:      business.ProfileEventDeactivated,
+			ProfileID: "survivor-profile",
+		})
+		require.NoError(t, err)
+
+		suspended, err := accessRepo.GetByID(ctx, survivorAccessID)
+		require.NoError(t, err)
+		assert.Equal(t, models.AccessStateSuspended, suspended.State)
+
+		err = business.HandleProfileEvent(ctx, svc, &business.ProfileEvent{
+			Type:      business.ProfileEventDeleted,
+			ProfileID: "survivor-profile",
+		})
+		require.NoError(t, err)
+
+		remaining, err := accessRepo.ListByProfile(ctx, "survivor-profile", nil, 10, 0)
+		require.NoError(t, err)
+		assert.Empty(t, remaining)
+
+		survivorRoles, err = accessRepo.GetRoles(ctx, survivorAccessID)
+		require.NoError(t, err)
+		assert.Empty(t, survivorRoles)
+
+		err = business.HandleProfileEvent(ctx, svc, &business.ProfileEvent{
+			Type:      business.ProfileEventDeleted,
+			ProfileID: "survivor-profile",
+		})
+		require.NoError(t, err, "redelivered events are harmless")
+	})
+}
+
+func (p *ProfileLifecycleTestSuite) TestMergeRevokedAccessIntoActive() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+		accessRepo := repository.NewAccessRepository(svc)
+
+		viewer := &models.PartitionRole{Name: "viewer", Permissions: []string{"reports:read"}}
+		admin := &models.PartitionRole{Name: "admin", Permissions: []string{"settings:write"}}
+		partition := p.CreatePartition(t, svc, nil, viewer, admin)
+
+		grant := func(profileID string, role *models.PartitionRole) string {
+			access, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+				PartitionId: partition.GetID(),
+				ProfileId:   profileID,
+			})
+			require.NoError(t, err)
+			_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+				AccessId:        access.GetAccessId(),
+				PartitionRoleId: role.GetID(),
+			})
+			require.NoError(t, err)
+			return access.GetAccessId()
+		}
+
+		survivorAccessID := grant("survivor-profile", viewer)
+		revokedAccessID := grant("merged-profile", admin)
+
+		_, err := accessBusiness.RevokeAccess(ctx, revokedAccessID, "left the team")
+		require.NoError(t, err)
+
+		err = business.HandleProfileEvent(ctx, svc, &business.ProfileEvent{
+			Type:            business.ProfileEventMerged,
+			ProfileID:       "merged-profile",
+			TargetProfileID: "survivor-profile",
+		})
+		require.NoError(t, err)
+
+		survivorRoles, err := accessRepo.GetRoles(ctx, survivorAccessID)
+		require.NoError(t, err)
+		require.Len(t, survivorRoles, 1, "roles of a revoked access are not handed to the survivor")
+		assert.Equal(t, viewer.GetID(), survivorRoles[0].PartitionRoleID)
+
+		decision, err := accessBusiness.CheckPermission(ctx, &business.CheckPermissionRequest{
+			ProfileID:   "survivor-profile",
+			PartitionID: partition.GetID(),
+			Permission:  "settings:write",
+		})
+		require.NoError(t, err)
+		assert.False(t, decision.Allowed, "merging never brings back a revoked permission")
+	})
+}
+
+func (p *ProfileLifecycleTestSuite) TestProfileLifecycleRequestsAndSponsors() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := p.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+		requestBusiness := business.NewAccessRequestBusiness(ctx, svc)
+		requestRepo := repository.NewAccessRequestRepository(svc)
+		accessRepo := repository.NewAccessRepository(svc)
+		tenantRepo := repository.NewTenantRepository(svc)
+
+		roles := map[string]*models.PartitionRole{"viewer": {Name: "viewer"}, "editor": {Name: "editor"}}
+		partition := p.CreatePartition(t, svc, nil, roles["viewer"], roles["editor"])
+
+		partner := models.Tenant{Name: "partner tenant", Description: "Test"}
+		require.NoError(t, tenantRepo.Save(ctx, &partner))
+
+		request := func(profileID string, role *models.PartitionRole) *models.AccessRequest {
+			accessRequest, err := requestBusiness.RequestAccess(asProfile(ctx, profileID), &business.CreateAccessRequestRequest{
+				PartitionID:   partition.GetID(),
+				RoleID:        role.GetID(),
+				Justification: "needed for work",
+			})
+			require.NoError(t, err)
+			return accessRequest
+		}
+
+		duplicateRequest := request("merged-profile", roles["viewer"])
+		movedRequest := request("merged-profile", roles["editor"])
+		request("survivor-profile", roles["viewer"])
+
+		_, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "merged-profile",
+		})
+		require.NoError(t, err)
+
+		guest, err := accessBusiness.CreateGuestAccess(ctx, &business.CreateGuestAccessRequest{
+			PartitionID:      partition.GetID(),
+			ProfileID:        "guest-profile",
+			HomeTenantID:     partner.GetID(),
+			SponsorProfileID: "merged-profile",
+		})
+		require.NoError(t, err)
+
+		err = business.HandleProfileEvent(ctx, svc, &business.ProfileEvent{
+			Type:            business.ProfileEventMerged,
+			ProfileID:       "merged-profile",
+			TargetProfileID: "survivor-profile",
+		})
+		require.NoError(t, err)
+
+		cancelled, err := requestRepo.GetByID(ctx, duplicateRequest.GetID())
+		require.NoError(t, err)
+		assert.Equal(t, models.AccessRequestStateCancelled, cancelled.State,
+			"a request the survivor already made is cancelled")
+		assert.Contains(t, cancelled.DecisionReason, "survivor-profile")
+
+		moved, err := requestRepo.GetByID(ctx, movedRequest.GetID())
+		require.NoError(t, err)
+		assert.Equal(t, models.AccessRequestStatePending, moved.State)
+		assert.Equal(t, "survivor-profile", moved.ProfileID, "pending requests follow the merge")
+
+		pending, err := requestRepo.ListPendingByProfile(ctx, "merged-profile")
+		require.NoError(t, err)
+		assert.Empty(t, pending)
+
+		sponsored, err := accessRepo.GetByID(ctx, guest.Access.GetAccessId())
+		require.NoError(t, err)
+		assert.Equal(t, "survivor-profile", sponsored.SponsorProfileID, "guests follow their sponsor")
+
+		err = business.HandleProfileEvent(ctx, svc, &business.ProfileEvent{
+			Type:      business.ProfileEventDeleted,
+			ProfileID: "survivor-profile",
+		})
+		require.NoError(t, err)
+
+		forgotten, err := requestRepo.GetByID(ctx, movedRequest.GetID())
+		require.NoError(t, err)
+		assert.Equal(t, models.AccessRequestStateCancelled, forgotten.State)
+		assert.Empty(t, forgotten.ProfileID, "requests no longer name a deleted profile")
+
+		events, err := requestRepo.GetEvents(ctx, movedRequest.GetID())
+		require.NoError(t, err)
+		require.NotEmpty(t, events)
+		for _, event := range events {
+			assert.NotEqual(t, "survivor-profile", event.ActorProfileID)
+			assert.NotEqual(t, "merged-profile", event.ActorProfileID)
+		}
+
+		unsponsored, err := accessRepo.GetByID(ctx, guest.Access.GetAccessId())
+		require.NoError(t, err)
+		assert.Empty(t, unsponsored.SponsorProfileID)
+		assert.Equal(t, models.AccessStateActive, unsponsored.State, "guests keep their access until it lapses")
+	})
+}
+
+// TestProfileLifecycle runs the profile lifecycle test suite.
+func TestProfileLifecycle(t *testing.T) {
+	suite.Run(t, new(ProfileLifecycleTestSuite))
+}
@@ -0,0 +1,207 @@
+package business
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	rolePropertyIncludes   = "includes"
+	rolePropertyIncludedBy = "included_by"
+
+	// maxRoleIncludeDepth bounds include expansion, it is far deeper than any sensible role hierarchy.
+	maxRoleIncludeDepth = 16
+)
+
+// includedRole is a role reached through the includes of the role that was actually assigned.
+type includedRole struct {
+	role     *models.PartitionRole
+	assigned *models.PartitionRole
+}
+
+// expandRoleIncludes follows the includes of the assigned roles transitively. Every role is
+// returned at most once, so includes that loop back on themselves end the walk instead of repeating it.
+func expandRoleIncludes(
+	ctx context.Context,
+	partitionRepo repository.PartitionRepository,
+	assigned []*models.PartitionRole,
+) ([]*includedRole, error) {
+	seen := make(map[string]bool, len(assigned))
+	current := make([]*includedRole, 0, len(assigned))
+	for _, role := range assigned {
+		seen[role.GetID()] = true
+		current = append(current, &includedRole{role: role, assigned: role})
+	}
+
+	var included []*includedRole
+	for depth := 0; len(current) > 0 && depth < maxRoleIncludeDepth; depth++ {
+		reachedFrom := make(map[string]*models.PartitionRole)
+		var roleIDs []string
+		for _, item := range current {
+			for _, roleID := range item.role.IncludedRoleIDs {
+				if seen[roleID] {
+					continue
+				}
+				seen[roleID] = true
+				reachedFrom[roleID] = item.assigned
+				roleIDs = append(roleIDs, roleID)
+			}
+		}
+
+		if len(roleIDs) == 0 {
+			break
+		}
+
+		roles, err := partitionRepo.GetRolesByID(ctx, roleIDs...)
+		if err != nil {
+			return nil, err
+		}
+
+		current = make([]*includedRole, 0, len(roles))
+		for _, role := range roles {
+			item := &includedRole{role: role, assigned: reachedFrom[role.GetID()]}
+			included = append(included, item)
+			current = append(current, item)
+		}
+	}
+
+	return included, nil
+}
+
+// findIncludeCycle returns the chain of role ids leading from start back to itself, if any.
+func findIncludeCycle(graph map[string][]string, start string) []string {
+	visited := make(map[string]bool)
+
+	var walk func(roleID string, path []string) []string
+	walk = func(roleID string, path []string) []string {
+		for _, next := range graph[roleID] {
+			if next == start {
+				return append(path, next)
+			}
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+
+			cycle := walk(next, append(path, next))
+			if cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+
+	return walk(start, []string{start})
+}
+
+// rolesIncluding lists the role and every role that includes it, directly or transitively.
+func rolesIncluding(graph map[string][]string, roleID string) []string {
+	includers := []string{roleID}
+	found := map[string]bool{roleID: true}
+
+	for i := 0; i < len(includers); i++ {
+		for candidate, includes := range graph {
+			if !found[candidate] && slices.Contains(includes, includers[i]) {
+				found[candidate] = true
+				includers = append(includers, candidate)
+			}
+		}
+	}
+
+	return includers
+}
+
+func includeGraph(roles []*models.PartitionRole) map[string][]string {
+	graph := make(map[string][]string, len(roles))
+	for _, role := range roles {
+		graph[role.GetID()] = role.IncludedRoleIDs
+	}
+	return graph
+}
+
+// validateRoleIncludes checks that the included roles exist in the same partition and that
+// including them does not make the role include itself.
+func (pb *partitionBusiness) validateRoleIncludes(
+	ctx context.Context,
+	partitionRole *models.PartitionRole,
+	includedRoleIDs []string,
+) ([]string, error) {
+	normalised := slices.DeleteFunc(slices.Clone(includedRoleIDs), func(roleID string) bool {
+		return strings.TrimSpace(roleID) == ""
+	})
+	slices.Sort(normalised)
+	normalised = slices.Compact(normalised)
+
+	if slices.Contains(normalised, partitionRole.GetID()) {
+		return nil, status.Errorf(codes.InvalidArgument, "partition role %s can not include itself",
+			partitionRole.GetID())
+	}
+
+	siblings, err := pb.partitionRepo.GetRoles(ctx, partitionRole.PartitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(siblings))
+	for _, sibling := range siblings {
+		names[sibling.GetID()] = sibling.Name
+	}
+
+	for _, roleID := range normalised {
+		if _, ok := names[roleID]; !ok {
+			return nil, status.Errorf(codes.NotFound, "partition role %s does not exist in partition %s",
+				roleID, partitionRole.PartitionID)
+		}
+	}
+
+	graph := includeGraph(siblings)
+	graph[partitionRole.GetID()] = normalised
+
+	cycle := findIncludeCycle(graph, partitionRole.GetID())
+	if cycle != nil {
+		cycleNames := make([]string, 0, len(cycle))
+		for _, roleID := range cycle {
+			cycleNames = append(cycleNames, names[roleID])
+		}
+		return nil, status.Errorf(codes.FailedPrecondition, "role includes would form a cycle: %s",
+			strings.Join(cycleNames, " -> "))
+	}
+
+	return normalised, nil
+}
+
+// removeRoleFromIncludes drops a removed role from the includes of the roles that referenced it.
+func (pb *partitionBusiness) removeRoleFromIncludes(ctx context.Context, partitionRole *models.PartitionRole) error {
+	siblings, err := pb.partitionRepo.GetRoles(ctx, partitionRole.PartitionID)
+	if err != nil {
+		return err
+	}
+
+	for _, sibling := range siblings {
+		if !slices.Contains(sibling.IncludedRoleIDs, partitionRole.GetID()) {
+			continue
+		}
+
+		sibling.IncludedRoleIDs = slices.DeleteFunc(sibling.IncludedRoleIDs, func(roleID string) bool {
+			return roleID == partitionRole.GetID()
+		})
+
+		err = pb.partitionRepo.SaveRole(ctx, sibling)
+		if err != nil {
+			return err
+		}
+
+		err = pb.queueRoleHoldersSync(ctx, sibling)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package business_test
+
+import (
+	"testing"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type RoleCompositionTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (r *RoleCompositionTestSuite) TestCompositeRoles() {
+	r.WithTestDependancies(r.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := r.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+		partitionBusiness := business.NewPartitionBusiness(svc)
+
+		roles := map[string]*models.PartitionRole{
+			"admin":   {Name: "admin", Permissions: []string{"settings:write"}},
+			"editor":  {Name: "editor", Permissions: []string{"pages:write"}},
+			"viewer":  {Name: "viewer", Permissions: []string{"pages:read"}},
+			"retired": {Name: "retired", Permissions: []string{"pages:delete"}},
+		}
+		partition := r.CreatePartition(t, svc, nil, roles["admin"], roles["editor"], roles["viewer"], roles["retired"])
+
+		for _, include := range [][2]string{{"admin", "editor"}, {"editor", "viewer"}} {
+			_, err := partitionBusiness.UpdatePartitionRole(ctx, &business.UpdatePartitionRoleRequest{
+				ID:              roles[include[0]].GetID(),
+				IncludedRoleIDs: []string{roles[include[1]].GetID()},
+				UpdateMask:      []string{"included_role_ids"},
+			})
+			require.NoError(t, err)
+		}
+
+		_, err := partitionBusiness.UpdatePartitionRole(ctx, &business.UpdatePartitionRoleRequest{
+			ID:              roles["viewer"].GetID(),
+			IncludedRoleIDs: []string{roles["admin"].GetID()},
+			UpdateMask:      []string{"included_role_ids"},
+		})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err), "includes must not form a cycle")
+
+		access, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "admin-profile",
+		})
+		require.NoError(t, err)
+
+		_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+			AccessId:        access.GetAccessId(),
+			PartitionRoleId: roles["admin"].GetID(),
+		})
+		require.NoError(t, err)
+
+		listed, err := accessBusiness.ListAccessRoles(ctx, &partitionv1.ListAccessRoleRequest{
+			AccessId: access.GetAccessId(),
+		})
+		require.NoError(t, err)
+		assert.Len(t, listed.GetRole(), 3, "one assignment should expand to admin, editor and viewer")
+
+		// A role removed while still assigned is left out of listings instead of being listed empty.
+		_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+			AccessId:        access.GetAccessId(),
+			PartitionRoleId: roles["retired"].GetID(),
+		})
+		require.NoError(t, err)
+		require.NoError(t, repository.NewPartitionRepository(svc).RemoveRole(ctx, roles["retired"].GetID()))
+
+		entries, err := accessBusiness.ListPartitionAccess(ctx, &business.ListPartitionAccessRequest{
+			PartitionID: partition.GetID(),
+			ExpandRoles: true,
+		})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Len(t, entries[0].Roles, 3, "the listing should expand the assignment like ListAccessRoles")
+		for _, role := range entries[0].Roles {
+			require.NotNil(t, role.GetRole())
+			assert.NotEqual(t, "retired", role.GetRole().GetName())
+		}
+
+		decision, err := accessBusiness.CheckPermission(ctx, &business.CheckPermissionRequest{
+			ProfileID:   "admin-profile",
+			PartitionID: partition.GetID(),
+			Permission:  "pages:read",
+		})
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed)
+		require.Len(t, decision.Grants, 1)
+		assert.Equal(t, roles["admin"].GetID(), decision.Grants[0].IncludedByRoleID)
+		assert.Contains(t, decision.Reason, "included by admin")
+	})
+}
+
+// TestRoleComposition runs the composite role test suite.
+func TestRoleComposition(t *testing.T) {
+	suite.Run(t, new(RoleCompositionTestSuite))
+}
@@ -0,0 +1,143 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+func adminRoleNames() []string {
+	return []string{"admin", "administrator", "owner"}
+}
+
+// isAdminRole reports whether a role administers its partition, either by its
+// conventional name or because it grants every permission.
+func isAdminRole(role *models.PartitionRole) bool {
+	return slices.Contains(adminRoleNames(), strings.ToLower(role.Name)) ||
+		slices.Contains(role.Permissions, permissionWildcard)
+}
+
+// RemovePartitionRoleWithOptions removes a partition role. A role that is still assigned
+// is only removed when cascade is set, in which case its assignments are revoked with it.
+// The number of revoked assignments is returned.
+func (pb *partitionBusiness) RemovePartitionRoleWithOptions(
+	ctx context.Context,
+	partitionRoleID string,
+	cascade bool,
+) (int, error) {
+	partitionRoles, err := pb.partitionRepo.GetRolesByID(ctx, partitionRoleID)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(partitionRoles) == 0 {
+		return 0, status.Errorf(codes.NotFound, "partition role %s does not exist", partitionRoleID)
+	}
+
+	partitionRole := partitionRoles[0]
+
+	err = pb.ensureAnotherAdminRole(ctx, partitionRole)
+	if err != nil {
+		return 0, err
+	}
+
+	accessRoles, err := pb.partitionRepo.RemoveRoleWithAssignments(ctx, partitionRole.GetID(), cascade)
+	if err != nil {
+		if errors.Is(err, repository.ErrRoleAssigned) {
+			return 0, status.Errorf(codes.FailedPrecondition,
+				"partition role %s is still assigned to %d accesses", partitionRole.GetID(), len(accessRoles))
+		}
+		return 0, err
+	}
+
+	err = pb.removeRoleFromIncludes(ctx, partitionRole)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, accessRole := range accessRoles {
+		err = pb.revokedAccessRole(ctx, partitionRole, accessRole)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = PublishAccessEvent(ctx, pb.service, &AccessEvent{
+		Type:        EventPartitionRoleRemoved,
+		TenantID:    partitionRole.TenantID,
+		PartitionID: partitionRole.PartitionID,
+		Attributes: map[string]string{
+			"partition_role_id": partitionRole.GetID(),
+			"name":              partitionRole.Name,
+			"revoked":           strconv.Itoa(len(accessRoles)),
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(accessRoles), nil
+}
+
+// ensureAnotherAdminRole refuses to remove the last admin role, which would leave a partition unmanageable.
+func (pb *partitionBusiness) ensureAnotherAdminRole(ctx context.Context, partitionRole *models.PartitionRole) error {
+	if !isAdminRole(partitionRole) {
+		return nil
+	}
+
+	siblings, err := pb.partitionRepo.GetRoles(ctx, partitionRole.PartitionID)
+	if err != nil {
+		return err
+	}
+
+	for _, sibling := range siblings {
+		if sibling.GetID() != partitionRole.GetID() && isAdminRole(sibling) {
+			return nil
+		}
+	}
+
+	return status.Errorf(codes.FailedPrecondition,
+		"partition role %s is the last admin role of partition %s", partitionRole.GetID(), partitionRole.PartitionID)
+}
+
+// revokedAccessRole syncs the access that lost a role and announces the revocation.
+func (pb *partitionBusiness) revokedAccessRole(
+	ctx context.Context,
+	partitionRole *models.PartitionRole,
+	accessRole *models.AccessRole,
+) error {
+	access, err := pb.accessRepo.GetByID(ctx, accessRole.AccessID)
+	if err != nil {
+		if frame.ErrorIsNoRows(err) {
+			return nil
+		}
+		return err
+	}
+
+	err = QueueAccessRelationSync(ctx, pb.service, access)
+	if err != nil {
+		return err
+	}
+
+	return PublishAccessEvent(ctx, pb.service, &AccessEvent{
+		Type:         EventAccessRoleRevoked,
+		TenantID:     access.TenantID,
+		PartitionID:  access.PartitionID,
+		ProfileID:    access.ProfileID,
+		AccessID:     access.GetID(),
+		AccessRoleID: accessRole.GetID(),
+		Attributes: map[string]string{
+			"partition_role_id": partitionRole.GetID(),
+			"reason":            "partition role removed",
+		},
+	})
+}
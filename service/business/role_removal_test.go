@@ -0,0 +1,104 @@
+package business_test
+
+import (
+	"testing"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type RoleRemovalTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (r *RoleRemovalTestSuite) TestRemovePartitionRole() {
+	r.WithTestDependancies(r.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := r.CreateService(t, dep)
+		accessBusiness := business.NewAccessBusiness(ctx, svc)
+		partitionBusiness := business.NewPartitionBusiness(svc)
+
+		admin := &models.PartitionRole{Name: "admin"}
+		clerk := &models.PartitionRole{Name: "clerk"}
+		partition := r.CreatePartition(t, svc, nil, admin, clerk)
+
+		access, err := accessBusiness.CreateAccess(ctx, &partitionv1.CreateAccessRequest{
+			PartitionId: partition.GetID(),
+			ProfileId:   "clerk-profile",
+		})
+		require.NoError(t, err)
+
+		_, err = accessBusiness.CreateAccessRole(ctx, &partitionv1.CreateAccessRoleRequest{
+			AccessId:        access.GetAccessId(),
+			PartitionRoleId: clerk.GetID(),
+		})
+		require.NoError(t, err)
+
+		err = partitionBusiness.RemovePartitionRole(ctx, &partitionv1.RemovePartitionRoleRequest{Id: clerk.GetID()})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err), "an assigned role is blocked by default")
+
+		roles, err := accessBusiness.ListAccessRoles(ctx, &partitionv1.ListAccessRoleRequest{
+			AccessId: access.GetAccessId(),
+		})
+		require.NoError(t, err)
+		assert.Len(t, roles.GetRole(), 1, "a blocked removal keeps the assignment")
+
+		revoked, err := partitionBusiness.RemovePartitionRoleWithOptions(ctx, clerk.GetID(), true)
+		require.NoError(t, err)
+		assert.Equal(t, 1, revoked)
+
+		roles, err = accessBusiness.ListAccessRoles(ctx, &partitionv1.ListAccessRoleRequest{
+			AccessId: access.GetAccessId(),
+		})
+		require.NoError(t, err)
+		assert.Empty(t, roles.GetRole())
+
+		_, err = partitionBusiness.RemovePartitionRoleWithOptions(ctx, admin.GetID(), true)
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err), "the last admin role is kept")
+	})
+}
+
+func (r *RoleRemovalTestSuite) TestUpdateKeepsLastAdminRole() {
+	r.WithTestDependancies(r.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := r.CreateService(t, dep)
+		partitionBusiness := business.NewPartitionBusiness(svc)
+
+		owner := &models.PartitionRole{Name: "owner"}
+		superuser := &models.PartitionRole{Name: "superuser", Permissions: []string{"*"}}
+		r.CreatePartition(t, svc, nil, owner, superuser)
+
+		_, err := partitionBusiness.UpdatePartitionRole(ctx, &business.UpdatePartitionRoleRequest{
+			ID:         owner.GetID(),
+			Name:       "member",
+			UpdateMask: []string{"name"},
+		})
+		require.NoError(t, err, "another admin role is left")
+
+		_, err = partitionBusiness.UpdatePartitionRole(ctx, &business.UpdatePartitionRoleRequest{
+			ID:          superuser.GetID(),
+			Permissions: []string{"reports:read"},
+			UpdateMask:  []string{"permissions"},
+		})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err), "the last admin role keeps its wildcard")
+
+		_, err = partitionBusiness.UpdatePartitionRole(ctx, &business.UpdatePartitionRoleRequest{
+			ID:          superuser.GetID(),
+			DisplayName: "Super user",
+			UpdateMask:  []string{"display_name"},
+		})
+		require.NoError(t, err, "other fields of the last admin role can still change")
+	})
+}
+
+// TestRoleRemoval runs the role removal test suite.
+func TestRoleRemoval(t *testing.T) {
+	suite.Run(t, new(RoleRemovalTestSuite))
+}
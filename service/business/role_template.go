@@ -0,0 +1,387 @@
+package business
+
+import (
+	"context"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+const (
+	TemplateChangeUpdated   = "updated"
+	TemplateChangeUnchanged = "unchanged"
+	TemplateChangeSkipped   = "skipped"
+)
+
+func updatableRoleTemplateFields() []string {
+	return []string{
+		roleFieldName, roleFieldDisplayName, roleFieldDescription,
+		roleFieldProperties, roleFieldPermissions, roleFieldInheritable,
+	}
+}
+
+// CreateRoleTemplateRequest defines a role that new partitions of the tenant are seeded with.
+type CreateRoleTemplateRequest struct {
+	TenantID    string
+	Name        string
+	DisplayName string
+	Description string
+	Properties  map[string]any
+	Permissions []string
+	Inheritable bool
+}
+
+// UpdateRoleTemplateRequest changes the template fields listed in UpdateMask. With Propagate set
+// the same fields are also changed on every partition role seeded from the template.
+type UpdateRoleTemplateRequest struct {
+	ID          string
+	Name        string
+	DisplayName string
+	Description string
+	Properties  map[string]any
+	Permissions []string
+	Inheritable bool
+	UpdateMask  []string
+	Propagate   bool
+}
+
+// TemplateRoleChange records what propagating a template did to one seeded partition role.
+type TemplateRoleChange struct {
+	PartitionID     string
+	PartitionRoleID string
+	Action          string
+	Fields          []string
+	Reason          string
+}
+
+type TemplatePropagationReport struct {
+	TemplateID string
+	Changes    []*TemplateRoleChange
+	Updated    int
+	Unchanged  int
+	Skipped    int
+}
+
+type RoleTemplateBusiness interface {
+	CreateRoleTemplate(ctx context.Context, request *CreateRoleTemplateRequest) (*models.RoleTemplate, error)
+	UpdateRoleTemplate(
+		ctx context.Context,
+		request *UpdateRoleTemplateRequest) (*models.RoleTemplate, *TemplatePropagationReport, error)
+	ListRoleTemplates(ctx context.Context, tenantID string) ([]*models.RoleTemplate, error)
+	RemoveRoleTemplate(ctx context.Context, templateID string) error
+}
+
+func NewRoleTemplateBusiness(_ context.Context, service *frame.Service) RoleTemplateBusiness {
+	return &roleTemplateBusiness{
+		partitions:   newPartitionBusiness(service),
+		tenantRepo:   repository.NewTenantRepository(service),
+		templateRepo: repository.NewRoleTemplateRepository(service),
+	}
+}
+
+type roleTemplateBusiness struct {
+	partitions   *partitionBusiness
+	tenantRepo   repository.TenantRepository
+	templateRepo repository.RoleTemplateRepository
+}
+
+func (rb *roleTemplateBusiness) ensureUniqueTemplateName(
+	ctx context.Context,
+	tenantID string,
+	name string,
+	templateID string,
+) error {
+	existing, err := rb.templateRepo.GetByTenantAndName(ctx, tenantID, name)
+	if err != nil {
+		if frame.ErrorIsNoRows(err) {
+			return nil
+		}
+		return err
+	}
+
+	if existing.GetID() == templateID {
+		return nil
+	}
+
+	return status.Errorf(codes.AlreadyExists, "tenant %s already has a role template named %s", tenantID, name)
+}
+
+func (rb *roleTemplateBusiness) CreateRoleTemplate(
+	ctx context.Context,
+	request *CreateRoleTemplateRequest,
+) (*models.RoleTemplate, error) {
+	tenant, err := rb.tenantRepo.GetByID(ctx, request.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := validateRoleName(request.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = rb.ensureUniqueTemplateName(ctx, tenant.GetID(), name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := normalisePermissions(request.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &models.RoleTemplate{
+		Name:        name,
+		DisplayName: strings.TrimSpace(request.DisplayName),
+		Description: strings.TrimSpace(request.Description),
+		Properties:  frame.JSONMap(request.Properties),
+		Permissions: permissions,
+		Inheritable: request.Inheritable,
+		BaseModel: frame.BaseModel{
+			TenantID: tenant.GetID(),
+		},
+	}
+
+	err = rb.templateRepo.Save(ctx, template)
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (rb *roleTemplateBusiness) ListRoleTemplates(
+	ctx context.Context,
+	tenantID string,
+) ([]*models.RoleTemplate, error) {
+	return rb.templateRepo.GetByTenant(ctx, tenantID)
+}
+
+// RemoveRoleTemplate stops seeding new partitions from the template, roles already seeded are kept.
+func (rb *roleTemplateBusiness) RemoveRoleTemplate(ctx context.Context, templateID string) error {
+	template, err := rb.templateRepo.GetByID(ctx, templateID)
+	if err != nil {
+		return err
+	}
+
+	partitionRoles, err := rb.partitions.partitionRepo.GetRolesByTemplateID(ctx, template.GetID())
+	if err != nil {
+		return err
+	}
+
+	for _, partitionRole := range partitionRoles {
+		partitionRole.TemplateID = ""
+		err = rb.partitions.partitionRepo.SaveRole(ctx, partitionRole)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rb.templateRepo.Delete(ctx, template.GetID())
+}
+
+func (rb *roleTemplateBusiness) UpdateRoleTemplate(
+	ctx context.Context,
+	request *UpdateRoleTemplateRequest,
+) (*models.RoleTemplate, *TemplatePropagationReport, error) {
+	if len(request.UpdateMask) == 0 {
+		return nil, nil, status.Error(codes.InvalidArgument, "update mask is required")
+	}
+
+	for _, field := range request.UpdateMask {
+		if !slices.Contains(updatableRoleTemplateFields(), field) {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "field %s can not be updated", field)
+		}
+	}
+
+	template, err := rb.templateRepo.GetByID(ctx, request.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, field := range request.UpdateMask {
+		switch field {
+		case roleFieldName:
+			name, nameErr := validateRoleName(request.Name)
+			if nameErr != nil {
+				return nil, nil, nameErr
+			}
+
+			nameErr = rb.ensureUniqueTemplateName(ctx, template.TenantID, name, template.GetID())
+			if nameErr != nil {
+				return nil, nil, nameErr
+			}
+
+			template.Name = name
+		case roleFieldDisplayName:
+			template.DisplayName = strings.TrimSpace(request.DisplayName)
+		case roleFieldDescription:
+			template.Description = strings.TrimSpace(request.Description)
+		case roleFieldProperties:
+			template.Properties = frame.JSONMap(request.Properties)
+		case roleFieldPermissions:
+			permissions, permErr := normalisePermissions(request.Permissions)
+			if permErr != nil {
+				return nil, nil, permErr
+			}
+			template.Permissions = permissions
+		case roleFieldInheritable:
+			template.Inheritable = request.Inheritable
+		}
+	}
+
+	err = rb.templateRepo.Save(ctx, template)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &TemplatePropagationReport{TemplateID: template.GetID()}
+	if !request.Propagate {
+		return template, report, nil
+	}
+
+	partitionRoles, err := rb.partitions.partitionRepo.GetRolesByTemplateID(ctx, template.GetID())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, partitionRole := range partitionRoles {
+		change, propagateErr := rb.propagateToRole(ctx, template, partitionRole, request.UpdateMask)
+		if propagateErr != nil {
+			return nil, nil, propagateErr
+		}
+
+		report.Changes = append(report.Changes, change)
+		switch change.Action {
+		case TemplateChangeUpdated:
+			report.Updated++
+		case TemplateChangeSkipped:
+			report.Skipped++
+		default:
+			report.Unchanged++
+		}
+	}
+
+	return template, report, nil
+}
+
+func propertiesEqual(a frame.JSONMap, b frame.JSONMap) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// propagateToRole copies the masked template fields onto a seeded role. A role whose new
+// name is already taken in its partition is skipped rather than failing the whole update.
+func (rb *roleTemplateBusiness) propagateToRole(
+	ctx context.Context,
+	template *models.RoleTemplate,
+	partitionRole *models.PartitionRole,
+	updateMask []string,
+) (*TemplateRoleChange, error) {
+	change := &TemplateRoleChange{
+		PartitionID:     partitionRole.PartitionID,
+		PartitionRoleID: partitionRole.GetID(),
+		Action:          TemplateChangeUnchanged,
+	}
+
+	for _, field := range updateMask {
+		changed := false
+		switch field {
+		case roleFieldName:
+			changed = partitionRole.Name != template.Name
+			if changed {
+				err := rb.partitions.ensureUniqueRoleName(
+					ctx, partitionRole.PartitionID, template.Name, partitionRole.GetID())
+				if err != nil {
+					if status.Code(err) != codes.AlreadyExists {
+						return nil, err
+					}
+					change.Action = TemplateChangeSkipped
+					change.Reason = err.Error()
+					change.Fields = nil
+					return change, nil
+				}
+			}
+			partitionRole.Name = template.Name
+		case roleFieldDisplayName:
+			changed = partitionRole.DisplayName != template.DisplayName
+			partitionRole.DisplayName = template.DisplayName
+		case roleFieldDescription:
+			changed = partitionRole.Description != template.Description
+			partitionRole.Description = template.Description
+		case roleFieldProperties:
+			changed = !propertiesEqual(partitionRole.Properties, template.Properties)
+			partitionRole.Properties = maps.Clone(template.Properties)
+		case roleFieldPermissions:
+			changed = !slices.Equal(partitionRole.Permissions, template.Permissions)
+			partitionRole.Permissions = slices.Clone(template.Permissions)
+		case roleFieldInheritable:
+			changed = partitionRole.Inheritable != template.Inheritable
+			partitionRole.Inheritable = template.Inheritable
+		}
+
+		if changed {
+			change.Fields = append(change.Fields, field)
+		}
+	}
+
+	if len(change.Fields) == 0 {
+		return change, nil
+	}
+
+	err := rb.partitions.partitionRepo.SaveRole(ctx, partitionRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(change.Fields, roleFieldName) {
+		err = rb.partitions.queueRoleHoldersSync(ctx, partitionRole)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	change.Action = TemplateChangeUpdated
+	return change, nil
+}
+
+// seedPartitionRoles creates a partition role for every role template of the partition's tenant.
+func (pb *partitionBusiness) seedPartitionRoles(ctx context.Context, partition *models.Partition) error {
+	templates, err := pb.templateRepo.GetByTenant(ctx, partition.TenantID)
+	if err != nil {
+		return err
+	}
+
+	for _, template := range templates {
+		partitionRole := &models.PartitionRole{
+			Name:        template.Name,
+			DisplayName: template.DisplayName,
+			Description: template.Description,
+			Properties:  maps.Clone(template.Properties),
+			Permissions: slices.Clone(template.Permissions),
+			Inheritable: template.Inheritable,
+			TemplateID:  template.GetID(),
+			BaseModel: frame.BaseModel{
+				TenantID:    partition.TenantID,
+				PartitionID: partition.GetID(),
+			},
+		}
+
+		err = pb.partitionRepo.SaveRole(ctx, partitionRole)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package business_test
+
+import (
+	"testing"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type RoleTemplateTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (r *RoleTemplateTestSuite) TestRoleTemplatesSeedAndPropagate() {
+	r.WithTestDependancies(r.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := r.CreateService(t, dep)
+		templateBusiness := business.NewRoleTemplateBusiness(ctx, svc)
+		partitionBusiness := business.NewPartitionBusiness(svc)
+		partitionRepo := repository.NewPartitionRepository(svc)
+
+		tenantID := r.CreatePartition(t, svc, nil).TenantID
+
+		template, err := templateBusiness.CreateRoleTemplate(ctx, &business.CreateRoleTemplateRequest{
+			TenantID:    tenantID,
+			Name:        "auditor",
+			Permissions: []string{"reports:read"},
+		})
+		require.NoError(t, err)
+
+		_, err = templateBusiness.CreateRoleTemplate(ctx, &business.CreateRoleTemplateRequest{
+			TenantID: tenantID,
+			Name:     "Auditor",
+		})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+		partitionIDs := make([]string, 0, 2)
+		for _, name := range []string{"north branch", "south branch"} {
+			partition, createErr := partitionBusiness.CreatePartition(ctx, &partitionv1.CreatePartitionRequest{
+				TenantId: tenantID,
+				Name:     name,
+			})
+			require.NoError(t, createErr)
+			partitionIDs = append(partitionIDs, partition.GetId())
+
+			roles, rolesErr := partitionRepo.GetRoles(ctx, partition.GetId())
+			require.NoError(t, rolesErr)
+			require.Len(t, roles, 1, "a new partition is seeded from the tenant templates")
+			assert.Equal(t, template.GetID(), roles[0].TemplateID)
+		}
+
+		require.NoError(t, partitionRepo.SaveRole(ctx, &models.PartitionRole{
+			Name:      "senior auditor",
+			BaseModel: frame.BaseModel{TenantID: tenantID, PartitionID: partitionIDs[1]},
+		}))
+
+		_, report, err := templateBusiness.UpdateRoleTemplate(ctx, &business.UpdateRoleTemplateRequest{
+			ID:          template.GetID(),
+			Name:        "senior auditor",
+			Permissions: []string{"reports:*"},
+			UpdateMask:  []string{"name", "permissions"},
+			Propagate:   true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Updated)
+		assert.Equal(t, 1, report.Skipped, "a name already taken in the partition is reported, not overwritten")
+
+		for _, change := range report.Changes {
+			if change.PartitionID == partitionIDs[0] {
+				assert.Equal(t, business.TemplateChangeUpdated, change.Action)
+				assert.ElementsMatch(t, []string{"name", "permissions"}, change.Fields)
+			}
+		}
+	})
+}
+
+// TestRoleTemplates runs the role template test suite.
+func TestRoleTemplates(t *testing.T) {
+	suite.Run(t, new(RoleTemplateTestSuite))
+}
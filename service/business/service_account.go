@@ -0,0 +1,328 @@
+package business
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/service/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+const (
+	// PropertyClientType is the partition property that identifies the kind of oauth2 client.
+	PropertyClientType = "client_type"
+	// ClientTypeServiceAccount marks a partition as a machine client using client_credentials.
+	ClientTypeServiceAccount = "service_account"
+
+	propertyJWKS                = "jwks"
+	propertyJWKSURI             = "jwks_uri"
+	propertyTokenAuthMethod     = "token_endpoint_auth_method"
+	propertyTokenAuthSigningAlg = "token_endpoint_auth_signing_alg"
+	authMethodPrivateKeyJWT     = "private_key_jwt"
+	defaultServiceAccountScope  = "openid offline_access"
+	defaultTokenAuthSigningAlg  = "RS256"
+)
+
+// privateJWKMembers are the members that only appear in private or symmetric keys,
+// a service account must never hand these over to us.
+func privateJWKMembers() []string {
+	return []string{"d", "p", "q", "dp", "dq", "qi", "k", "oth"}
+}
+
+// publicJWKMembers are the members a public key of each supported key type needs to be verifiable.
+func publicJWKMembers() map[string][]string {
+	return map[string][]string{
+		"RSA": {"n", "e"},
+		"EC":  {"crv", "x", "y"},
+		"OKP": {"crv", "x"},
+	}
+}
+
+// IsServiceAccount reports whether a partition represents a machine client.
+func IsServiceAccount(partition *models.Partition) bool {
+	clientType, _ := partition.Properties[PropertyClientType].(string)
+	return clientType == ClientTypeServiceAccount
+}
+
+// validatePublicJWK ensures a key is a usable public json web key with an identifier.
+func validatePublicJWK(key map[string]any) (string, error) {
+	kty, _ := key["kty"].(string)
+	if kty == "" {
+		return "", status.Error(codes.InvalidArgument, "public key is missing the kty member")
+	}
+
+	kid, _ := key["kid"].(string)
+	if kid == "" {
+		return "", status.Error(codes.InvalidArgument, "public key is missing the kid member")
+	}
+
+	for _, member := range privateJWKMembers() {
+		if _, ok := key[member]; ok {
+			return "", status.Errorf(codes.InvalidArgument, "key %s contains private material [%s]", kid, member)
+		}
+	}
+
+	requiredMembers, ok := publicJWKMembers()[kty]
+	if !ok {
+		return "", status.Errorf(codes.InvalidArgument, "key %s has the unsupported key type %s", kid, kty)
+	}
+
+	for _, member := range requiredMembers {
+		if val, _ := key[member].(string); val == "" {
+			return "", status.Errorf(codes.InvalidArgument, "key %s is missing the %s member", kid, member)
+		}
+	}
+
+	return kid, nil
+}
+
+// parseJWKS accepts either a serialized key set `{"keys":[...]}` or the already decoded form.
+func parseJWKS(val any) ([]map[string]any, error) {
+	if raw, ok := val.(string); ok {
+		var decoded any
+		if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "jwks is not valid json: %v", err)
+		}
+		val = decoded
+	}
+
+	var keyList []any
+	switch v := val.(type) {
+	case nil:
+		return nil, nil
+	case map[string]any:
+		keyList, _ = v["keys"].([]any)
+	case []any:
+		keyList = v
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid jwks format: %v", val)
+	}
+
+	keys := make([]map[string]any, 0, len(keyList))
+	for _, item := range keyList {
+		key, ok := item.(map[string]any)
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid key in jwks: %v", item)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func partitionJWKS(partition *models.Partition) ([]map[string]any, error) {
+	return parseJWKS(partition.Properties[propertyJWKS])
+}
+
+func setPartitionJWKS(partition *models.Partition, keys []map[string]any) {
+	keyList := make([]any, 0, len(keys))
+	for _, key := range keys {
+		keyList = append(keyList, key)
+	}
+	partition.Properties[propertyJWKS] = map[string]any{"keys": keyList}
+}
+
+// prepareServiceAccount normalises and validates the properties of a service account partition.
+func prepareServiceAccount(partition *models.Partition) error {
+	if partition.Properties == nil {
+		partition.Properties = make(frame.JSONMap)
+	}
+
+	jwksURI, _ := partition.Properties[propertyJWKSURI].(string)
+
+	keys, err := partitionJWKS(partition)
+	if err != nil {
+		return err
+	}
+
+	if jwksURI == "" && len(keys) == 0 {
+		return status.Error(codes.InvalidArgument, "a service account requires either a jwks_uri or inline jwks")
+	}
+
+	if jwksURI != "" && len(keys) > 0 {
+		return status.Error(codes.InvalidArgument, "a service account can not have both a jwks_uri and inline jwks")
+	}
+
+	if len(keys) > 0 {
+		err = validateKeySet(keys)
+		if err != nil {
+			return err
+		}
+		setPartitionJWKS(partition, keys)
+	}
+
+	partition.Properties[propertyTokenAuthMethod] = authMethodPrivateKeyJWT
+	partition.ClientSecret = ""
+	return nil
+}
+
+func validateKeySet(keys []map[string]any) error {
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		kid, err := validatePublicJWK(key)
+		if err != nil {
+			return err
+		}
+		if seen[kid] {
+			return status.Errorf(codes.InvalidArgument, "duplicate key id %s in jwks", kid)
+		}
+		seen[kid] = true
+	}
+	return nil
+}
+
+// prepareServiceAccountPayload builds the hydra client for a machine partition,
+// it only allows the client_credentials grant authenticated with a signed jwt.
+func prepareServiceAccountPayload(clientID string, partition *models.Partition) (map[string]any, error) {
+	scope := defaultServiceAccountScope
+	if val, ok := partition.Properties["scope"].(string); ok && val != "" {
+		scope = val
+	}
+
+	signingAlg := defaultTokenAuthSigningAlg
+	if val, ok := partition.Properties[propertyTokenAuthSigningAlg].(string); ok && val != "" {
+		signingAlg = val
+	}
+
+	payload := map[string]any{
+		"client_name":                     partition.Name,
+		"client_id":                       clientID,
+		"grant_types":                     []string{"client_credentials"},
+		"response_types":                  []string{"token"},
+		"scope":                           scope,
+		"audience":                        extractStringList(partition.Properties, "audience"),
+		"token_endpoint_auth_method":      authMethodPrivateKeyJWT,
+		"token_endpoint_auth_signing_alg": signingAlg,
+	}
+
+	if jwksURI, ok := partition.Properties[propertyJWKSURI].(string); ok && jwksURI != "" {
+		payload[propertyJWKSURI] = jwksURI
+		return payload, nil
+	}
+
+	keys, err := partitionJWKS(partition)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("service account partition %s has no public keys", partition.GetID())
+	}
+
+	payload[propertyJWKS] = map[string]any{"keys": keys}
+	return payload, nil
+}
+
+// ensureServiceAccount rejects partitions whose keys can not be managed here.
+func ensureServiceAccount(partition *models.Partition) error {
+	if !IsServiceAccount(partition) {
+		return status.Errorf(codes.FailedPrecondition, "partition %s is not a service account", partition.GetID())
+	}
+
+	if jwksURI, _ := partition.Properties[propertyJWKSURI].(string); jwksURI != "" {
+		return status.Errorf(codes.FailedPrecondition,
+			"partition %s keys are served from its jwks_uri", partition.GetID())
+	}
+
+	return nil
+}
+
+// updateKeys changes the key set of a service account while its partition is locked, so that concurrent
+// key changes are applied one after the other, and queues the partition for synchronisation to hydra.
+func (pb *partitionBusiness) updateKeys(
+	ctx context.Context,
+	partitionID string,
+	update func(keys []map[string]any) ([]map[string]any, error),
+) (*partitionv1.PartitionObject, error) {
+	partition, err := pb.partitionRepo.UpdateProperties(ctx, partitionID, func(partition *models.Partition) error {
+		err := ensureServiceAccount(partition)
+		if err != nil {
+			return err
+		}
+
+		keys, err := partitionJWKS(partition)
+		if err != nil {
+			return err
+		}
+
+		keys, err = update(keys)
+		if err != nil {
+			return err
+		}
+
+		setPartitionJWKS(partition, keys)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = pb.queuePartitionSync(ctx, partition)
+	if err != nil {
+		return nil, err
+	}
+
+	return toAPIPartition(partition), nil
+}
+
+func (pb *partitionBusiness) AddPartitionPublicKey(
+	ctx context.Context,
+	partitionID string,
+	key map[string]any,
+) (*partitionv1.PartitionObject, error) {
+	kid, err := validatePublicJWK(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pb.updateKeys(ctx, partitionID, func(keys []map[string]any) ([]map[string]any, error) {
+		if slices.ContainsFunc(keys, func(k map[string]any) bool { return k["kid"] == kid }) {
+			return nil, status.Errorf(codes.AlreadyExists, "key %s is already registered", kid)
+		}
+
+		return append(keys, key), nil
+	})
+}
+
+func (pb *partitionBusiness) RotatePartitionPublicKeys(
+	ctx context.Context,
+	partitionID string,
+	keys []map[string]any,
+) (*partitionv1.PartitionObject, error) {
+	if len(keys) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "at least one public key is required")
+	}
+
+	err := validateKeySet(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return pb.updateKeys(ctx, partitionID, func(_ []map[string]any) ([]map[string]any, error) {
+		return keys, nil
+	})
+}
+
+func (pb *partitionBusiness) RemovePartitionPublicKey(
+	ctx context.Context,
+	partitionID string,
+	keyID string,
+) (*partitionv1.PartitionObject, error) {
+	return pb.updateKeys(ctx, partitionID, func(keys []map[string]any) ([]map[string]any, error) {
+		remaining := slices.DeleteFunc(slices.Clone(keys), func(k map[string]any) bool { return k["kid"] == keyID })
+		if len(remaining) == len(keys) {
+			return nil, status.Errorf(codes.NotFound, "key %s is not registered", keyID)
+		}
+
+		if len(remaining) == 0 {
+			return nil, status.Error(codes.FailedPrecondition, "a service account must keep at least one public key")
+		}
+
+		return remaining, nil
+	})
+}
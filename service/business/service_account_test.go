@@ -0,0 +1,224 @@
+package business_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type ServiceAccountTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func publicKey(kid string) map[string]any {
+	return map[string]any{"kty": "RSA", "kid": kid, "e": "AQAB", "n": "sXch"}
+}
+
+func (s *ServiceAccountTestSuite) createServiceAccount(
+	ctx context.Context,
+	t *testing.T,
+	svc *frame.Service,
+) *partitionv1.PartitionObject {
+	tenant := models.Tenant{Name: "machines", Description: "Test"}
+	require.NoError(t, repository.NewTenantRepository(svc).Save(ctx, &tenant))
+
+	partition, err := business.NewPartitionBusiness(svc).CreatePartition(ctx, &partitionv1.CreatePartitionRequest{
+		TenantId: tenant.GetID(),
+		Name:     "ledger exporter",
+		Properties: map[string]string{
+			business.PropertyClientType: business.ClientTypeServiceAccount,
+			"jwks":                      `{"keys":[{"kty":"RSA","kid":"key-1","e":"AQAB","n":"sXch"}]}`,
+		},
+	})
+	require.NoError(t, err)
+	return partition
+}
+
+// syncStored does what the partition sync queue does with the partition as it was saved.
+func syncStored(ctx context.Context, t *testing.T, svc *frame.Service, partitionID string) {
+	partition, err := repository.NewPartitionRepository(svc).GetByID(ctx, partitionID)
+	require.NoError(t, err)
+	require.NoError(t, business.SyncPartitionOnHydra(ctx, svc, partition))
+}
+
+func hydraKeyIDs(t *testing.T, fakeHydra *tests.FakeHydra, clientID string) []string {
+	client, ok := fakeHydra.Client(clientID)
+	require.True(t, ok, "client should be registered on hydra")
+
+	jwks, ok := client["jwks"].(map[string]any)
+	require.True(t, ok, "inline jwks should be pushed to hydra")
+
+	keys, _ := jwks["keys"].([]any)
+	kids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		kid, _ := key.(map[string]any)["kid"].(string)
+		kids = append(kids, kid)
+	}
+	return kids
+}
+
+func (s *ServiceAccountTestSuite) TestPublicKeysReachHydra() {
+	s.WithTestDependancies(s.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := s.CreateService(t, dep)
+		fakeHydra := s.WithFakeHydra(t, svc)
+		partitionBusiness := business.NewPartitionBusiness(svc)
+
+		partition := s.createServiceAccount(ctx, t, svc)
+		syncStored(ctx, t, svc, partition.GetId())
+		assert.Equal(t, []string{"key-1"}, hydraKeyIDs(t, fakeHydra, partition.GetId()))
+
+		_, err := partitionBusiness.AddPartitionPublicKey(ctx, partition.GetId(), publicKey("key-2"))
+		require.NoError(t, err)
+		syncStored(ctx, t, svc, partition.GetId())
+		assert.Equal(t, []string{"key-1", "key-2"}, hydraKeyIDs(t, fakeHydra, partition.GetId()))
+
+		_, err = partitionBusiness.AddPartitionPublicKey(ctx, partition.GetId(), publicKey("key-2"))
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+		privateKey := publicKey("key-3")
+		privateKey["d"] = "secret"
+		_, err = partitionBusiness.AddPartitionPublicKey(ctx, partition.GetId(), privateKey)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "private material is never accepted")
+
+		for _, incompleteKey := range []map[string]any{
+			{"kty": "RSA", "kid": "key-3", "e": "AQAB"},
+			{"kty": "EC", "kid": "key-3", "crv": "P-256", "x": "f83O"},
+			{"kty": "oct", "kid": "key-3"},
+		} {
+			_, err = partitionBusiness.AddPartitionPublicKey(ctx, partition.GetId(), incompleteKey)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err), "keys must carry their public members")
+		}
+
+		_, err = partitionBusiness.RotatePartitionPublicKeys(ctx, partition.GetId(),
+			[]map[string]any{publicKey("key-3"), publicKey("key-3")})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "key ids are unique within a key set")
+
+		_, err = partitionBusiness.RotatePartitionPublicKeys(ctx, partition.GetId(),
+			[]map[string]any{publicKey("key-3")})
+		require.NoError(t, err)
+		syncStored(ctx, t, svc, partition.GetId())
+		assert.Equal(t, []string{"key-3"}, hydraKeyIDs(t, fakeHydra, partition.GetId()),
+			"rotated out keys are removed from hydra")
+
+		_, err = partitionBusiness.RemovePartitionPublicKey(ctx, partition.GetId(), "key-3")
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err), "the last key can not be removed")
+
+		_, err = partitionBusiness.RemovePartitionPublicKey(ctx, partition.GetId(), "key-1")
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		_, err = partitionBusiness.AddPartitionPublicKey(ctx, partition.GetId(), publicKey("key-4"))
+		require.NoError(t, err)
+		_, err = partitionBusiness.RemovePartitionPublicKey(ctx, partition.GetId(), "key-3")
+		require.NoError(t, err)
+		syncStored(ctx, t, svc, partition.GetId())
+		assert.Equal(t, []string{"key-4"}, hydraKeyIDs(t, fakeHydra, partition.GetId()))
+	})
+}
+
+func (s *ServiceAccountTestSuite) TestConcurrentKeyChangesAreKept() {
+	s.WithTestDependancies(s.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := s.CreateService(t, dep)
+		partitionBusiness := business.NewPartitionBusiness(svc)
+
+		partition := s.createServiceAccount(ctx, t, svc)
+
+		kids := []string{"key-2", "key-3", "key-4", "key-5"}
+		var wg sync.WaitGroup
+		errs := make([]error, len(kids))
+		for i, kid := range kids {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[i] = partitionBusiness.AddPartitionPublicKey(ctx, partition.GetId(), publicKey(kid))
+			}()
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+
+		stored, err := repository.NewPartitionRepository(svc).GetByID(ctx, partition.GetId())
+		require.NoError(t, err)
+		jwks, err := json.Marshal(stored.Properties["jwks"])
+		require.NoError(t, err)
+		for _, kid := range append(kids, "key-1") {
+			assert.Contains(t, string(jwks), `"kid":"`+kid+`"`, "no added key is lost")
+		}
+	})
+}
+
+func (s *ServiceAccountTestSuite) TestUpdatePartitionValidatesKeys() {
+	s.WithTestDependancies(s.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := s.CreateService(t, dep)
+		partitionBusiness := business.NewPartitionBusiness(svc)
+
+		partition := s.createServiceAccount(ctx, t, svc)
+
+		_, err := partitionBusiness.UpdatePartition(ctx, &partitionv1.UpdatePartitionRequest{
+			Id:   partition.GetId(),
+			Name: partition.GetName(),
+			Properties: map[string]string{
+				"jwks": `{"keys":[{"kty":"RSA","kid":"key-1","e":"AQAB","n":"sXch","d":"secret"}]}`,
+			},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "private material is never accepted")
+
+		for _, incompleteKey := range []map[string]any{
+			{"kty": "RSA", "kid": "key-3", "e": "AQAB"},
+			{"kty": "EC", "kid": "key-3", "crv": "P-256", "x": "f83O"},
+			{"kty": "oct", "kid": "key-3"},
+		} {
+			_, err = partitionBusiness.AddPartitionPublicKey(ctx, partition.GetId(), incompleteKey)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err), "keys must carry their public members")
+		}
+
+		_, err = partitionBusiness.UpdatePartition(ctx, &partitionv1.UpdatePartitionRequest{
+			Id:         partition.GetId(),
+			Name:       partition.GetName(),
+			Properties: map[string]string{"jwks_uri": "https://keys.example.com/jwks.json"},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "inline keys and a jwks_uri are exclusive")
+
+		stored, err := repository.NewPartitionRepository(svc).GetByID(ctx, partition.GetId())
+		require.NoError(t, err)
+		assert.NotContains(t, stored.Properties, "jwks_uri")
+
+		_, err = partitionBusiness.UpdatePartition(ctx, &partitionv1.UpdatePartitionRequest{
+			Id:   partition.GetId(),
+			Name: partition.GetName(),
+			Properties: map[string]string{
+				"jwks": `{"keys":[{"kty":"RSA","kid":"key-2","e":"AQAB","n":"sXch"}]}`,
+			},
+		})
+		require.NoError(t, err)
+
+		stored, err = repository.NewPartitionRepository(svc).GetByID(ctx, partition.GetId())
+		require.NoError(t, err)
+		assert.Empty(t, stored.ClientSecret)
+		assert.Equal(t, "private_key_jwt", stored.Properties["token_endpoint_auth_method"])
+		jwks, ok := stored.Properties["jwks"].(map[string]any)
+		require.True(t, ok, "inline keys are stored decoded")
+		assert.Len(t, jwks["keys"], 1)
+	})
+}
+
+// TestServiceAccounts runs the service account key management suite against the fake hydra.
+func TestServiceAccounts(t *testing.T) {
+	suite.Run(t, new(ServiceAccountTestSuite))
+}
@@ -5,6 +5,7 @@ import (
 
 	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
 	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/repository"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
@@ -22,6 +23,14 @@ func (prtSrv *PartitionServer) toAPIError(err error) error {
 		return status.Error(codes.NotFound, err.Error())
 	}
 
+	if repository.ErrorIsUniqueViolation(err) {
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+
+	if repository.ErrorIsForeignKeyViolation(err) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
 	return grpcError.Err()
 }
 
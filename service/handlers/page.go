@@ -2,9 +2,14 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 
 	partitionv1 "github.com/antinvestor/apis/go/partition/v1"
 	"github.com/antinvestor/service-partition/service/business"
+	"github.com/antinvestor/service-partition/service/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 func (prtSrv *PartitionServer) CreatePage(
@@ -13,12 +18,50 @@ func (prtSrv *PartitionServer) CreatePage(
 ) (*partitionv1.CreatePageResponse, error) {
 	logger := prtSrv.Service.Log(ctx)
 	pageBusiness := business.NewPageBusiness(ctx, prtSrv.Service)
-	page, err := pageBusiness.CreatePage(ctx, req)
+	saved, err := pageBusiness.CreatePage(ctx, req)
 	if err != nil {
 		logger.WithError(err).Debug(" CreatePage -- could not create a new page")
 		return nil, prtSrv.toAPIError(err)
 	}
-	return &partitionv1.CreatePageResponse{Data: page}, nil
+
+	err = reportStrippedContent(ctx, saved.Revision.Stripped)
+	if err != nil {
+		logger.WithError(err).Debug(" CreatePage -- could not report the stripped content")
+	}
+	return &partitionv1.CreatePageResponse{Data: saved.Page}, nil
+}
+
+// strippedContentHeader carries what the sanitisation policy removed from a saved page,
+// the page response has no field for it.
+const strippedContentHeader = "x-page-stripped-content"
+
+// reportStrippedContent sends the sanitisation report as JSON in the response header.
+func reportStrippedContent(ctx context.Context, stripped []models.StrippedContent) error {
+	if len(stripped) == 0 {
+		return nil
+	}
+
+	report, err := json.Marshal(stripped)
+	if err != nil {
+		return err
+	}
+
+	return grpc.SetHeader(ctx, metadata.Pairs(strippedContentHeader, string(report)))
+}
+
+// requestedLocales reads the Accept-Language header of the call, as sent directly or through the gateway.
+func requestedLocales(ctx context.Context) []string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	for _, key := range []string{"accept-language", "grpcgateway-accept-language"} {
+		if values := md.Get(key); len(values) > 0 {
+			return business.ParseAcceptLanguage(strings.Join(values, ","))
+		}
+	}
+	return nil
 }
 
 func (prtSrv *PartitionServer) GetPage(
@@ -27,7 +70,7 @@ func (prtSrv *PartitionServer) GetPage(
 ) (*partitionv1.GetPageResponse, error) {
 	logger := prtSrv.Service.Log(ctx)
 	pageBusiness := business.NewPageBusiness(ctx, prtSrv.Service)
-	page, err := pageBusiness.GetPage(ctx, req)
+	page, err := pageBusiness.GetLocalisedPage(ctx, req, requestedLocales(ctx))
 	if err != nil {
 		logger.WithError(err).Debug(" GetPage -- could not get page")
 		return nil, prtSrv.toAPIError(err)
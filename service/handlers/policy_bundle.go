@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/antinvestor/service-partition/service/business"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pitabwire/frame"
+)
+
+const PolicyBundlePath = "/v1/policy/bundle"
+
+// PolicyBundleHandler serves OPA bundles to API gateway sidecars, which poll it with
+// `tenant_id` or `partition_id` and a bearer token. A token of TenantTokens, keyed by tenant id,
+// only reads the bundles of that tenant, the operator Token reads every tenant's.
+// The endpoint is off while there are no tokens.
+type PolicyBundleHandler struct {
+	Service      *frame.Service
+	Token        string
+	TenantTokens map[string]string
+}
+
+func (ph *PolicyBundleHandler) enabled() bool {
+	return ph.Token != "" || len(ph.TenantTokens) > 0
+}
+
+// authorise returns the tenant the bearer token is scoped to, empty for the operator token.
+func (ph *PolicyBundleHandler) authorise(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+
+	if ph.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(ph.Token)) == 1 {
+		return "", true
+	}
+
+	for tenantID, tenantToken := range ph.TenantTokens {
+		if tenantToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(tenantToken)) == 1 {
+			return tenantID, true
+		}
+	}
+
+	return "", false
+}
+
+func (ph *PolicyBundleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := ph.Service.Log(ctx)
+
+	if !ph.enabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	scopedTenantID, ok := ph.authorise(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	request := &business.PolicyBundleRequest{
+		TenantID:    r.URL.Query().Get("tenant_id"),
+		PartitionID: r.URL.Query().Get("partition_id"),
+	}
+	if scopedTenantID != "" {
+		if request.TenantID != "" && request.TenantID != scopedTenantID {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		// Partitions of other tenants are rejected when the bundle is built.
+		request.TenantID = scopedTenantID
+	}
+
+	bundle, err := business.BuildPolicyBundle(ctx, ph.Service, request)
+	if err != nil {
+		code := httpStatusFromError(err)
+		if code == http.StatusInternalServerError {
+			logger.WithError(err).Error(" PolicyBundle -- could not build policy bundle")
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+
+		logger.WithError(err).Debug(" PolicyBundle -- could not build policy bundle")
+		http.Error(w, status.Convert(err).Message(), code)
+		return
+	}
+
+	etag := fmt.Sprintf("%q", bundle.Revision)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	err = bundle.Write(w)
+	if err != nil {
+		logger.WithError(err).Error(" PolicyBundle -- could not write policy bundle")
+	}
+}
+
+func httpStatusFromError(err error) int {
+	if frame.ErrorIsNoRows(err) {
+		return http.StatusNotFound
+	}
+
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
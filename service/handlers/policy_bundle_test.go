@@ -0,0 +1,121 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type PolicyBundleHandlerTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (p *PolicyBundleHandlerTestSuite) TestTokensAreScopedToTenants() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, _ := p.CreateService(t, dep)
+
+		north := p.CreatePartition(t, svc, nil)
+		south := p.CreatePartition(t, svc, nil)
+
+		handler := &handlers.PolicyBundleHandler{
+			Service:      svc,
+			Token:        "operator-token",
+			TenantTokens: map[string]string{north.TenantID: "north-token", south.TenantID: "south-token"},
+		}
+
+		testCases := []struct {
+			name   string
+			token  string
+			query  url.Values
+			status int
+		}{
+			{
+				name:   "missing token",
+				query:  url.Values{"tenant_id": {north.TenantID}},
+				status: http.StatusUnauthorized,
+			},
+			{
+				name:   "unknown token",
+				token:  "guessed-token",
+				query:  url.Values{"tenant_id": {north.TenantID}},
+				status: http.StatusUnauthorized,
+			},
+			{
+				name:   "own tenant",
+				token:  "north-token",
+				query:  url.Values{"tenant_id": {north.TenantID}},
+				status: http.StatusOK,
+			},
+			{
+				name:   "tenant of the token by default",
+				token:  "north-token",
+				status: http.StatusOK,
+			},
+			{
+				name:   "own partition",
+				token:  "north-token",
+				query:  url.Values{"partition_id": {north.GetID()}},
+				status: http.StatusOK,
+			},
+			{
+				name:   "other tenant",
+				token:  "north-token",
+				query:  url.Values{"tenant_id": {south.TenantID}},
+				status: http.StatusForbidden,
+			},
+			{
+				name:   "partition of another tenant",
+				token:  "north-token",
+				query:  url.Values{"partition_id": {south.GetID()}},
+				status: http.StatusBadRequest,
+			},
+			{
+				name:   "operator reads any tenant",
+				token:  "operator-token",
+				query:  url.Values{"tenant_id": {south.TenantID}},
+				status: http.StatusOK,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, handlers.PolicyBundlePath+"?"+tc.query.Encode(), nil)
+				if tc.token != "" {
+					req.Header.Set("Authorization", "Bearer "+tc.token)
+				}
+
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				assert.Equal(t, tc.status, rec.Code, rec.Body.String())
+			})
+		}
+	})
+}
+
+func (p *PolicyBundleHandlerTestSuite) TestDisabledWithoutTokens() {
+	p.WithTestDependancies(p.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, _ := p.CreateService(t, dep)
+
+		handler := &handlers.PolicyBundleHandler{Service: svc}
+
+		req := httptest.NewRequest(http.MethodGet, handlers.PolicyBundlePath, nil)
+		req.Header.Set("Authorization", "Bearer ")
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+// TestPolicyBundleHandler runs the policy bundle endpoint test suite.
+func TestPolicyBundleHandler(t *testing.T) {
+	suite.Run(t, new(PolicyBundleHandlerTestSuite))
+}
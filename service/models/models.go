@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/pitabwire/frame"
 )
 
@@ -23,25 +25,278 @@ type Partition struct {
 
 type PartitionRole struct {
 	frame.BaseModel
-	Name       string `gorm:"type:varchar(100);"`
-	Properties frame.JSONMap
+	Name        string `gorm:"type:varchar(100);"`
+	DisplayName string `gorm:"type:varchar(250);"`
+	Description string `gorm:"type:text;"`
+	Properties  frame.JSONMap
+	Permissions []string `gorm:"type:jsonb;serializer:json"`
+	// Inheritable roles also apply in every descendant of the partition they belong to.
+	Inheritable bool
+	// IncludedRoleIDs are roles of the same partition granted along with this one.
+	IncludedRoleIDs []string `gorm:"type:jsonb;serializer:json"`
+	// TemplateID links a role seeded from a tenant role template back to it.
+	TemplateID string `gorm:"type:varchar(50);index"`
+	// GuestEligible roles may be held by guests from other tenants.
+	GuestEligible bool
+}
+
+// RoleTemplate describes a role every partition of the tenant is seeded with.
+type RoleTemplate struct {
+	frame.BaseModel
+	Name        string `gorm:"type:varchar(100);"`
+	DisplayName string `gorm:"type:varchar(250);"`
+	Description string `gorm:"type:text;"`
+	Properties  frame.JSONMap
+	Permissions []string `gorm:"type:jsonb;serializer:json"`
+	Inheritable bool
 }
 
+// Page is a partition page as served to users, its HTML is that of the published revision.
 type Page struct {
 	frame.BaseModel
 	Name  string `gorm:"type:varchar(50);"`
 	HTML  string `gorm:"type:text;"`
 	State int32
+	// Locale is the language tag of this variant of the page, empty for the variant used when none matches.
+	Locale string `gorm:"type:varchar(20);not null;default:''"`
+	// PublishedRevision is the revision being served, zero while only drafts exist.
+	PublishedRevision int
+	// LatestRevision is the most recently saved revision, published or not.
+	LatestRevision int
+}
+
+// IsPublished reports whether the page has content to serve, pages saved before
+// revisions were tracked are served as they are.
+func (p *Page) IsPublished() bool {
+	return p.PublishedRevision > 0 || p.LatestRevision == 0
+}
+
+// PageRevision is an immutable copy of the page HTML as it was saved.
+type PageRevision struct {
+	frame.BaseModel
+	PageID   string `gorm:"type:varchar(50);uniqueIndex:idx_page_revision"`
+	Revision int    `gorm:"uniqueIndex:idx_page_revision"`
+	HTML     string `gorm:"type:text;"`
+	// Stripped lists what the sanitisation policy removed from the HTML that was submitted.
+	Stripped []StrippedContent `gorm:"type:jsonb;serializer:json"`
+}
+
+// StrippedContent is an element, attribute or comment removed from submitted page HTML.
+type StrippedContent struct {
+	Kind      string `json:"kind"`
+	Element   string `json:"element,omitempty"`
+	Attribute string `json:"attribute,omitempty"`
+	Value     string `json:"value,omitempty"`
+}
+
+// AccessState is the lifecycle state of an access, the zero value is active
+// so that accesses created before states were tracked keep working.
+type AccessState int32
+
+const (
+	AccessStateActive AccessState = iota
+	AccessStatePending
+	AccessStateSuspended
+	AccessStateRevoked
+	AccessStateExpired
+)
+
+func (s AccessState) String() string {
+	switch s {
+	case AccessStateActive:
+		return "active"
+	case AccessStatePending:
+		return "pending"
+	case AccessStateSuspended:
+		return "suspended"
+	case AccessStateRevoked:
+		return "revoked"
+	case AccessStateExpired:
+		return "expired"
+	default:
+		return "unknown"
+	}
+}
+
+// CanTransitionTo reports whether an access in this state may be moved to the target state.
+func (s AccessState) CanTransitionTo(target AccessState) bool {
+	switch s {
+	case AccessStatePending:
+		return target == AccessStateActive || target == AccessStateRevoked || target == AccessStateExpired
+	case AccessStateActive:
+		return target == AccessStateSuspended || target == AccessStateRevoked || target == AccessStateExpired
+	case AccessStateSuspended:
+		return target == AccessStateActive || target == AccessStateRevoked || target == AccessStateExpired
+	case AccessStateExpired:
+		// Extending the validity restores the state the access expired in.
+		return target == AccessStateActive || target == AccessStatePending || target == AccessStateSuspended ||
+			target == AccessStateRevoked
+	case AccessStateRevoked:
+		return false
+	default:
+		return false
+	}
+}
+
+// withinValidity reports whether at falls inside an optional validity window.
+func withinValidity(validFrom *time.Time, validUntil *time.Time, at time.Time) bool {
+	if validFrom != nil && at.Before(*validFrom) {
+		return false
+	}
+	return validUntil == nil || at.Before(*validUntil)
 }
 
 type Access struct {
 	frame.BaseModel
-	ProfileID string `gorm:"type:varchar(50);"`
-	State     int32
+	ProfileID   string `gorm:"type:varchar(50);"`
+	State       AccessState
+	StateReason string `gorm:"type:text;"`
+	ValidFrom   *time.Time
+	ValidUntil  *time.Time
+	// StateBeforeExpiry is the state extending the validity of an expired access brings back.
+	StateBeforeExpiry AccessState
+	// HomeTenantID is the tenant a guest from another tenant belongs to, empty for members.
+	HomeTenantID string `gorm:"type:varchar(50);"`
+	// SponsorProfileID is the member who invited the guest in and answers for them.
+	SponsorProfileID string `gorm:"type:varchar(50);"`
+}
+
+// IsGuest reports whether the access was granted to a profile of another tenant.
+func (a *Access) IsGuest() bool {
+	return a.HomeTenantID != "" && a.HomeTenantID != a.TenantID
+}
+
+// EffectiveState is the state of the access at a point in time, an active access
+// outside of its validity window is reported as pending or expired.
+func (a *Access) EffectiveState(at time.Time) AccessState {
+	if a.State != AccessStateActive {
+		return a.State
+	}
+
+	if a.ValidFrom != nil && at.Before(*a.ValidFrom) {
+		return AccessStatePending
+	}
+
+	if a.ValidUntil != nil && !at.Before(*a.ValidUntil) {
+		return AccessStateExpired
+	}
+
+	return a.State
+}
+
+// IsActive reports whether the access currently grants entry to its partition.
+func (a *Access) IsActive() bool {
+	return a.EffectiveState(time.Now()) == AccessStateActive
 }
 
 type AccessRole struct {
 	frame.BaseModel
 	AccessID        string `gorm:"type:varchar(50);"`
 	PartitionRoleID string `gorm:"type:varchar(50);"`
+	ValidFrom       *time.Time
+	ValidUntil      *time.Time
+	// Condition is a CEL expression limiting the requests the assignment applies to.
+	Condition string `gorm:"type:text;"`
+	// ExpiredAt is when the lapse of the assignment was processed, extending its validity clears it.
+	ExpiredAt *time.Time
+}
+
+// IsActiveAt reports whether the role assignment is in force at the given time.
+func (ar *AccessRole) IsActiveAt(at time.Time) bool {
+	return withinValidity(ar.ValidFrom, ar.ValidUntil, at)
+}
+
+type InvitationState int32
+
+const (
+	InvitationStatePending InvitationState = iota
+	InvitationStateAccepted
+	InvitationStateRevoked
+	InvitationStateExpired
+)
+
+// Invitation is an offer for a contact to join a partition with a preset list of roles,
+// only a hash of the token that was delivered to the contact is kept.
+type Invitation struct {
+	frame.BaseModel
+	Contact          string `gorm:"type:varchar(250);"`
+	InviterProfileID string `gorm:"type:varchar(50);"`
+	TokenHash        string `gorm:"type:varchar(100);"`
+	Properties       frame.JSONMap
+	State            InvitationState
+	ExpiresAt        time.Time
+	AcceptedAt       *time.Time
+	ProfileID        string `gorm:"type:varchar(50);"`
+	AccessID         string `gorm:"type:varchar(50);"`
+}
+
+// RoleIDs lists the partition roles granted once the invitation is accepted.
+func (i *Invitation) RoleIDs() []string {
+	var roleIDs []string
+	if val, ok := i.Properties["role_ids"].([]any); ok {
+		for _, v := range val {
+			if str, okStr := v.(string); okStr {
+				roleIDs = append(roleIDs, str)
+			}
+		}
+	}
+	return roleIDs
+}
+
+func (i *Invitation) SetRoleIDs(roleIDs []string) {
+	if i.Properties == nil {
+		i.Properties = make(frame.JSONMap)
+	}
+
+	roleList := make([]any, 0, len(roleIDs))
+	for _, roleID := range roleIDs {
+		roleList = append(roleList, roleID)
+	}
+	i.Properties["role_ids"] = roleList
+}
+
+type AccessRequestState int32
+
+const (
+	AccessRequestStatePending AccessRequestState = iota
+	AccessRequestStateApproved
+	AccessRequestStateDenied
+	AccessRequestStateCancelled
+)
+
+func (s AccessRequestState) String() string {
+	switch s {
+	case AccessRequestStatePending:
+		return "pending"
+	case AccessRequestStateApproved:
+		return "approved"
+	case AccessRequestStateDenied:
+		return "denied"
+	case AccessRequestStateCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// AccessRequest is a profile asking for a role in a partition, it stays pending until an approver decides on it.
+type AccessRequest struct {
+	frame.BaseModel
+	ProfileID       string `gorm:"type:varchar(50);index"`
+	PartitionRoleID string `gorm:"type:varchar(50);"`
+	Justification   string `gorm:"type:text;"`
+	State           AccessRequestState
+	DecidedBy       string `gorm:"type:varchar(50);"`
+	DecisionReason  string `gorm:"type:text;"`
+	DecidedAt       *time.Time
+	AccessID        string `gorm:"type:varchar(50);"`
+}
+
+// AccessRequestEvent records an action taken on an access request and the profile that took it.
+type AccessRequestEvent struct {
+	frame.BaseModel
+	AccessRequestID string `gorm:"type:varchar(50);index"`
+	ActorProfileID  string `gorm:"type:varchar(50);"`
+	Action          string `gorm:"type:varchar(20);"`
+	Reason          string `gorm:"type:text;"`
 }
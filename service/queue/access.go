@@ -0,0 +1,24 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/antinvestor/service-partition/service/business"
+
+	"github.com/pitabwire/frame"
+)
+
+type AccessRelationSyncQueueHandler struct {
+	Service *frame.Service
+}
+
+func (arq *AccessRelationSyncQueueHandler) Handle(ctx context.Context, _ map[string]string, payload []byte) error {
+	accessSync := &business.AccessRelationSync{}
+	err := json.Unmarshal(payload, accessSync)
+	if err != nil {
+		return err
+	}
+
+	return business.SyncAccessOnKeto(ctx, arq.Service, accessSync)
+}
@@ -0,0 +1,25 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/antinvestor/service-partition/service/business"
+
+	"github.com/pitabwire/frame"
+)
+
+// ProfileEventQueueHandler consumes the lifecycle events the profile service publishes.
+type ProfileEventQueueHandler struct {
+	Service *frame.Service
+}
+
+func (peq *ProfileEventQueueHandler) Handle(ctx context.Context, _ map[string]string, payload []byte) error {
+	profileEvent := &business.ProfileEvent{}
+	err := json.Unmarshal(payload, profileEvent)
+	if err != nil {
+		return err
+	}
+
+	return business.HandleProfileEvent(ctx, peq.Service, profileEvent)
+}
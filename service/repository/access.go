@@ -2,8 +2,10 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/antinvestor/service-partition/service/models"
+	"gorm.io/gorm"
 
 	"github.com/pitabwire/frame"
 )
@@ -37,6 +39,69 @@ func (ar *accessRepository) GetByPartitionAndProfile(
 	return access, nil
 }
 
+func applyAccessFilter(db *gorm.DB, filter *AccessFilter) *gorm.DB {
+	if filter == nil {
+		return db
+	}
+
+	if len(filter.RoleIDs) > 0 {
+		db = db.Where("accesses.id IN (?)", db.Session(&gorm.Session{NewDB: true}).
+			Model(&models.AccessRole{}).
+			Select("access_id").
+			Where("partition_role_id IN ?", filter.RoleIDs))
+	}
+
+	if len(filter.States) > 0 {
+		db = db.Where("accesses.state IN ?", filter.States)
+	}
+
+	if filter.ActiveAt != nil {
+		db = db.Where("accesses.state = ?", models.AccessStateActive).
+			Where("(accesses.valid_from IS NULL OR accesses.valid_from <= ?)", *filter.ActiveAt).
+			Where("(accesses.valid_until IS NULL OR accesses.valid_until > ?)", *filter.ActiveAt)
+	}
+
+	if filter.GuestsOnly {
+		db = db.Where("accesses.home_tenant_id <> '' AND accesses.home_tenant_id <> accesses.tenant_id")
+	}
+
+	return db
+}
+
+func (ar *accessRepository) ListByPartition(
+	ctx context.Context,
+	partitionID string,
+	filter *AccessFilter,
+	count uint32,
+	page uint32,
+) ([]*models.Access, error) {
+	accessList := make([]*models.Access, 0)
+	db := ar.service.DB(ctx, true).Where("accesses.partition_id = ?", partitionID)
+	err := applyAccessFilter(db, filter).
+		Order("accesses.created_at, accesses.id").
+		Offset(int(page * count)).
+		Limit(int(count)).
+		Find(&accessList).Error
+	return accessList, err
+}
+
+func (ar *accessRepository) ListByProfile(
+	ctx context.Context,
+	profileID string,
+	filter *AccessFilter,
+	count uint32,
+	page uint32,
+) ([]*models.Access, error) {
+	accessList := make([]*models.Access, 0)
+	db := ar.service.DB(ctx, true).Where("accesses.profile_id = ?", profileID)
+	err := applyAccessFilter(db, filter).
+		Order("accesses.created_at, accesses.id").
+		Offset(int(page * count)).
+		Limit(int(count)).
+		Find(&accessList).Error
+	return accessList, err
+}
+
 func (ar *accessRepository) Save(ctx context.Context, access *models.Access) error {
 	return ar.service.DB(ctx, false).Save(access).Error
 }
@@ -50,6 +115,62 @@ func (ar *accessRepository) Delete(ctx context.Context, id string) error {
 	return ar.service.DB(ctx, false).Where(" id = ?", id).Delete(&models.Access{}).Error
 }
 
+// GetAllIncludingDeleted pages through every access, soft deleted ones included,
+// so that external systems mirroring access can be reconciled.
+func (ar *accessRepository) GetAllIncludingDeleted(
+	ctx context.Context,
+	count uint32,
+	page uint32,
+) ([]*models.Access, error) {
+	accessList := make([]*models.Access, 0)
+	err := ar.service.DB(ctx, true).Unscoped().
+		Order("id").
+		Offset(int(page * count)).
+		Limit(int(count)).
+		Find(&accessList).Error
+	return accessList, err
+}
+
+// GetExpired lists accesses whose validity ended at or before the given time
+// but that have not yet been moved to a terminal state.
+func (ar *accessRepository) GetExpired(ctx context.Context, at time.Time, count uint32) ([]*models.Access, error) {
+	accessList := make([]*models.Access, 0)
+	err := ar.service.DB(ctx, true).
+		Where("valid_until IS NOT NULL AND valid_until <= ?", at).
+		Where("state IN ?", []models.AccessState{
+			models.AccessStateActive, models.AccessStatePending, models.AccessStateSuspended,
+		}).
+		Limit(int(count)).
+		Find(&accessList).Error
+	return accessList, err
+}
+
+// Expire only changes an access still in the state it was read in, so that concurrent expiry runs
+// and state changes are not overwritten and each expiry is reported once.
+func (ar *accessRepository) Expire(ctx context.Context, access *models.Access, at time.Time) (bool, error) {
+	result := ar.service.DB(ctx, false).Model(&models.Access{}).
+		Where("id = ? AND state = ?", access.GetID(), access.State).
+		Where("valid_until IS NOT NULL AND valid_until <= ?", at).
+		Updates(map[string]any{"state": models.AccessStateExpired, "state_before_expiry": access.State})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	access.StateBeforeExpiry = access.State
+	access.State = models.AccessStateExpired
+	return true, nil
+}
+
+func (ar *accessRepository) ReplaceSponsor(ctx context.Context, sponsorProfileID string, replacementID string) error {
+	return ar.service.DB(ctx, false).Unscoped().Model(&models.Access{}).
+		Where("sponsor_profile_id = ?", sponsorProfileID).
+		Update("sponsor_profile_id", replacementID).Error
+}
+
 func (ar *accessRepository) GetRoles(ctx context.Context, accessID string) ([]*models.AccessRole, error) {
 	accessRoles := make([]*models.AccessRole, 0)
 	err := ar.service.DB(ctx, true).
@@ -58,6 +179,71 @@ func (ar *accessRepository) GetRoles(ctx context.Context, accessID string) ([]*m
 	return accessRoles, err
 }
 
+func (ar *accessRepository) GetRolesByAccessIDs(
+	ctx context.Context,
+	accessIDs ...string,
+) ([]*models.AccessRole, error) {
+	accessRoles := make([]*models.AccessRole, 0)
+	if len(accessIDs) == 0 {
+		return accessRoles, nil
+	}
+	err := ar.service.DB(ctx, true).
+		Find(&accessRoles, " access_id IN ?", accessIDs).Error
+
+	return accessRoles, err
+}
+
+func (ar *accessRepository) GetRoleByID(ctx context.Context, accessRoleID string) (*models.AccessRole, error) {
+	accessRole := &models.AccessRole{}
+	err := ar.service.DB(ctx, true).First(accessRole, " id = ?", accessRoleID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return accessRole, nil
+}
+
+func (ar *accessRepository) GetRolesByPartitionRoleID(
+	ctx context.Context,
+	partitionRoleID string,
+) ([]*models.AccessRole, error) {
+	accessRoles := make([]*models.AccessRole, 0)
+	err := ar.service.DB(ctx, true).
+		Find(&accessRoles, " partition_role_id = ?", partitionRoleID).Error
+
+	return accessRoles, err
+}
+
+func (ar *accessRepository) GetExpiredRoles(
+	ctx context.Context,
+	at time.Time,
+	count uint32,
+) ([]*models.AccessRole, error) {
+	accessRoles := make([]*models.AccessRole, 0)
+	err := ar.service.DB(ctx, true).
+		Where("valid_until IS NOT NULL AND valid_until <= ? AND expired_at IS NULL", at).
+		Limit(int(count)).
+		Find(&accessRoles).Error
+	return accessRoles, err
+}
+
+func (ar *accessRepository) ExpireRole(ctx context.Context, accessRole *models.AccessRole, at time.Time) (bool, error) {
+	result := ar.service.DB(ctx, false).Model(&models.AccessRole{}).
+		Where("id = ? AND expired_at IS NULL", accessRole.GetID()).
+		Where("valid_until IS NOT NULL AND valid_until <= ?", at).
+		Update("expired_at", at)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	accessRole.ExpiredAt = &at
+	return true, nil
+}
+
 func (ar *accessRepository) SaveRole(ctx context.Context, role *models.AccessRole) error {
 	return ar.service.DB(ctx, false).Save(role).Error
 }
@@ -66,6 +252,82 @@ func (ar *accessRepository) RemoveRole(ctx context.Context, accessRoleID string)
 	return ar.service.DB(ctx, false).Where(" id = ?", accessRoleID).Delete(&models.AccessRole{}).Error
 }
 
+// ApplyChanges writes all the changes in one transaction so that either all or none of them are kept.
+func (ar *accessRepository) ApplyChanges(ctx context.Context, changes ...*AccessChange) error {
+	return ar.service.DB(ctx, false).Transaction(func(tx *gorm.DB) error {
+		for _, change := range changes {
+			err := writeAccessChange(tx, change)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// writeAccessChange writes a single change within a transaction. An existing access only has the
+// columns changes touch written, and only while it is still in the state it was read in.
+func writeAccessChange(tx *gorm.DB, change *AccessChange) error {
+	access := change.Access
+	if access.GetID() == "" {
+		err := tx.Create(access).Error
+		if err != nil {
+			return err
+		}
+	} else {
+		result := tx.Model(&models.Access{}).
+			Where("id = ? AND state = ?", access.GetID(), change.ExpectedState).
+			Updates(map[string]any{
+				"profile_id":         access.ProfileID,
+				"state":              access.State,
+				"state_reason":       access.StateReason,
+				"valid_from":         access.ValidFrom,
+				"valid_until":        access.ValidUntil,
+				"home_tenant_id":     access.HomeTenantID,
+				"sponsor_profile_id": access.SponsorProfileID,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected != 1 {
+			return ErrAccessChanged
+		}
+	}
+
+	if change.Remove {
+		err := tx.Where("access_id = ?", access.GetID()).Delete(&models.AccessRole{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(access).Error
+	}
+
+	if len(change.RemoveRoleIDs) > 0 {
+		result := tx.Where("id IN ? AND access_id = ?", change.RemoveRoleIDs, access.GetID()).
+			Delete(&models.AccessRole{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected != int64(len(change.RemoveRoleIDs)) {
+			return ErrAccessChanged
+		}
+	}
+
+	for _, accessRole := range change.AddRoles {
+		accessRole.AccessID = access.GetID()
+		err := tx.Save(accessRole).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func NewAccessRepository(service *frame.Service) AccessRepository {
 	partitionRepository := accessRepository{
 		service: service,
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/antinvestor/service-partition/service/models"
+	"gorm.io/gorm"
+
+	"github.com/pitabwire/frame"
+)
+
+type accessRequestRepository struct {
+	service *frame.Service
+}
+
+func (ar *accessRequestRepository) GetByID(ctx context.Context, id string) (*models.AccessRequest, error) {
+	request := &models.AccessRequest{}
+	err := ar.service.DB(ctx, true).First(request, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+func (ar *accessRequestRepository) GetPending(
+	ctx context.Context,
+	partitionID string,
+	profileID string,
+	roleID string,
+) (*models.AccessRequest, error) {
+	request := &models.AccessRequest{}
+	err := ar.service.DB(ctx, true).First(request,
+		"partition_id = ? AND profile_id = ? AND partition_role_id = ? AND state = ?",
+		partitionID, profileID, roleID, models.AccessRequestStatePending).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+func (ar *accessRequestRepository) ListPendingByProfile(
+	ctx context.Context,
+	profileID string,
+) ([]*models.AccessRequest, error) {
+	requests := make([]*models.AccessRequest, 0)
+	err := ar.service.DB(ctx, true).
+		Where("profile_id = ? AND state = ?", profileID, models.AccessRequestStatePending).
+		Order("created_at, id").
+		Find(&requests).Error
+	return requests, err
+}
+
+func (ar *accessRequestRepository) ListByPartition(
+	ctx context.Context,
+	partitionID string,
+	states []models.AccessRequestState,
+) ([]*models.AccessRequest, error) {
+	requests := make([]*models.AccessRequest, 0)
+	db := ar.service.DB(ctx, true).Where("partition_id = ?", partitionID)
+	if len(states) > 0 {
+		db = db.Where("state IN ?", states)
+	}
+	err := db.Order("created_at, id").Find(&requests).Error
+	return requests, err
+}
+
+func (ar *accessRequestRepository) SaveWithEvent(
+	ctx context.Context,
+	request *models.AccessRequest,
+	event *models.AccessRequestEvent,
+) error {
+	return ar.service.DB(ctx, false).Transaction(func(tx *gorm.DB) error {
+		err := tx.Save(request).Error
+		if err != nil {
+			return err
+		}
+
+		event.AccessRequestID = request.GetID()
+		event.TenantID = request.TenantID
+		event.PartitionID = request.PartitionID
+		return tx.Save(event).Error
+	})
+}
+
+func (ar *accessRequestRepository) Decide(
+	ctx context.Context,
+	request *models.AccessRequest,
+	event *models.AccessRequestEvent,
+	grant *AccessChange,
+) (bool, error) {
+	// Returning an error rolls back the grant of a request that was decided concurrently.
+	errNotPending := errors.New("access request is no longer pending")
+
+	err := ar.service.DB(ctx, false).Transaction(func(tx *gorm.DB) error {
+		if grant != nil {
+			err := writeAccessChange(tx, grant)
+			if err != nil {
+				return err
+			}
+
+			request.AccessID = grant.Access.GetID()
+		}
+
+		result := tx.Model(&models.AccessRequest{}).
+			Where("id = ? AND state = ?", request.GetID(), models.AccessRequestStatePending).
+			Updates(map[string]any{
+				"state":           request.State,
+				"decided_by":      request.DecidedBy,
+				"decision_reason": request.DecisionReason,
+				"decided_at":      request.DecidedAt,
+				"access_id":       request.AccessID,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errNotPending
+		}
+
+		event.AccessRequestID = request.GetID()
+		event.TenantID = request.TenantID
+		event.PartitionID = request.PartitionID
+		return tx.Save(event).Error
+	})
+	if errors.Is(err, errNotPending) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (ar *accessRequestRepository) GetEvents(
+	ctx context.Context,
+	accessRequestID string,
+) ([]*models.AccessRequestEvent, error) {
+	events := make([]*models.AccessRequestEvent, 0)
+	err := ar.service.DB(ctx, true).
+		Where("access_request_id = ?", accessRequestID).
+		Order("created_at, id").
+		Find(&events).Error
+	return events, err
+}
+
+func (ar *accessRequestRepository) ReplaceProfile(ctx context.Context, profileID string, replacementID string) error {
+	return ar.service.DB(ctx, false).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&models.AccessRequest{}).
+			Where("profile_id = ?", profileID).
+			Update("profile_id", replacementID).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Unscoped().Model(&models.AccessRequest{}).
+			Where("decided_by = ?", profileID).
+			Update("decided_by", replacementID).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Model(&models.AccessRequestEvent{}).
+			Where("actor_profile_id = ?", profileID).
+			Update("actor_profile_id", replacementID).Error
+	})
+}
+
+func NewAccessRequestRepository(service *frame.Service) AccessRequestRepository {
+	repo := accessRequestRepository{
+		service: service,
+	}
+	return &repo
+}
@@ -0,0 +1,80 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/pitabwire/frame"
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type AccessRequestTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (suite *AccessRequestTestSuite) TestDecideKeepsConcurrentStateChanges() {
+	suite.WithTestDependancies(suite.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := suite.CreateService(t, dep)
+		accessRepo := repository.NewAccessRepository(svc)
+		requestRepo := repository.NewAccessRequestRepository(svc)
+
+		role := &models.PartitionRole{Name: "analyst"}
+		partition := suite.CreatePartition(t, svc, nil, role)
+		baseModel := frame.BaseModel{TenantID: partition.TenantID, PartitionID: partition.GetID()}
+
+		access := &models.Access{ProfileID: "analyst-profile", State: models.AccessStateActive, BaseModel: baseModel}
+		require.NoError(t, accessRepo.Save(ctx, access))
+
+		accessRequest := &models.AccessRequest{
+			ProfileID:       access.ProfileID,
+			PartitionRoleID: role.GetID(),
+			Justification:   "quarterly reporting",
+			State:           models.AccessRequestStatePending,
+			BaseModel:       baseModel,
+		}
+		require.NoError(t, requestRepo.SaveWithEvent(ctx, accessRequest, &models.AccessRequestEvent{
+			ActorProfileID: access.ProfileID,
+			Action:         "requested",
+		}))
+
+		grant := &repository.AccessChange{
+			Access:        access,
+			ExpectedState: access.State,
+			AddRoles:      []*models.AccessRole{{PartitionRoleID: role.GetID()}},
+		}
+
+		suspended := *access
+		suspended.State = models.AccessStateSuspended
+		require.NoError(t, accessRepo.Save(ctx, &suspended))
+
+		accessRequest.State = models.AccessRequestStateApproved
+		_, err := requestRepo.Decide(ctx, accessRequest, &models.AccessRequestEvent{
+			ActorProfileID: "approver-profile",
+			Action:         "approved",
+		}, grant)
+		require.ErrorIs(t, err, repository.ErrAccessChanged)
+
+		stored, err := accessRepo.GetByID(ctx, access.GetID())
+		require.NoError(t, err)
+		assert.Equal(t, models.AccessStateSuspended, stored.State, "a suspension is never written over")
+
+		accessRoles, err := accessRepo.GetRoles(ctx, access.GetID())
+		require.NoError(t, err)
+		assert.Empty(t, accessRoles)
+
+		pending, err := requestRepo.GetByID(ctx, accessRequest.GetID())
+		require.NoError(t, err)
+		assert.Equal(t, models.AccessRequestStatePending, pending.State, "the decision is rolled back")
+	})
+}
+
+// TestAccessRequestRepository runs the access request repository test suite.
+func TestAccessRequestRepository(t *testing.T) {
+	suite.Run(t, new(AccessRequestTestSuite))
+}
@@ -2,6 +2,7 @@ package repository_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/antinvestor/service-partition/internal/tests"
 	"github.com/antinvestor/service-partition/service/models"
@@ -344,6 +345,203 @@ func (suite *AccessTestSuite) TestRemoveRole() {
 	})
 }
 
+func (suite *AccessTestSuite) TestListByPartitionAndProfile() {
+	suite.WithTestDependancies(suite.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := suite.CreateService(t, dep)
+		accessRepo := repository.NewAccessRepository(svc)
+		tenantRepo := repository.NewTenantRepository(svc)
+		partitionRepo := repository.NewPartitionRepository(svc)
+
+		tenant := models.Tenant{
+			Name:        "Access T",
+			Description: "Test",
+		}
+		err := tenantRepo.Save(ctx, &tenant)
+		require.NoError(t, err)
+
+		partitions := make([]*models.Partition, 0)
+		for _, name := range []string{"Partition A", "Partition B"} {
+			partition := &models.Partition{
+				Name: name,
+				BaseModel: frame.BaseModel{
+					TenantID: tenant.GetID(),
+				},
+			}
+			err = partitionRepo.Save(ctx, partition)
+			require.NoError(t, err)
+			partitions = append(partitions, partition)
+		}
+
+		partitionRole := models.PartitionRole{
+			Name: "member",
+			BaseModel: frame.BaseModel{
+				TenantID:    tenant.GetID(),
+				PartitionID: partitions[0].GetID(),
+			},
+		}
+		err = partitionRepo.SaveRole(ctx, &partitionRole)
+		require.NoError(t, err)
+
+		profiles := []string{"profile-1", "profile-2", "profile-3"}
+		for i, profileID := range profiles {
+			access := models.Access{
+				ProfileID: profileID,
+				BaseModel: frame.BaseModel{
+					TenantID:    tenant.GetID(),
+					PartitionID: partitions[0].GetID(),
+				},
+			}
+			if i == 2 {
+				access.State = models.AccessStateSuspended
+			}
+			err = accessRepo.Save(ctx, &access)
+			require.NoError(t, err)
+
+			if i == 0 {
+				err = accessRepo.SaveRole(ctx, &models.AccessRole{
+					AccessID:        access.GetID(),
+					PartitionRoleID: partitionRole.GetID(),
+				})
+				require.NoError(t, err)
+			}
+		}
+
+		err = accessRepo.Save(ctx, &models.Access{
+			ProfileID: "profile-1",
+			BaseModel: frame.BaseModel{
+				TenantID:    tenant.GetID(),
+				PartitionID: partitions[1].GetID(),
+			},
+		})
+		require.NoError(t, err)
+
+		members, err := accessRepo.ListByPartition(ctx, partitions[0].GetID(), nil, 2, 0)
+		require.NoError(t, err)
+		assert.Len(t, members, 2, "first page should be full")
+
+		members, err = accessRepo.ListByPartition(ctx, partitions[0].GetID(), nil, 2, 1)
+		require.NoError(t, err)
+		assert.Len(t, members, 1, "second page should hold the remainder")
+
+		members, err = accessRepo.ListByPartition(ctx, partitions[0].GetID(), &repository.AccessFilter{
+			RoleIDs: []string{partitionRole.GetID()},
+		}, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, members, 1)
+		assert.Equal(t, "profile-1", members[0].ProfileID)
+
+		members, err = accessRepo.ListByPartition(ctx, partitions[0].GetID(), &repository.AccessFilter{
+			States: []models.AccessState{models.AccessStateSuspended},
+		}, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, members, 1)
+		assert.Equal(t, "profile-3", members[0].ProfileID)
+
+		now := time.Now()
+		workspaces, err := accessRepo.ListByProfile(ctx, "profile-1", &repository.AccessFilter{ActiveAt: &now}, 10, 0)
+		require.NoError(t, err)
+		assert.Len(t, workspaces, 2, "profile should be able to enter both partitions")
+
+		workspaces, err = accessRepo.ListByProfile(ctx, "profile-3", &repository.AccessFilter{ActiveAt: &now}, 10, 0)
+		require.NoError(t, err)
+		assert.Empty(t, workspaces, "a suspended access does not grant entry")
+	})
+}
+
+func (suite *AccessTestSuite) TestIntegrityConstraints() {
+	suite.WithTestDependancies(suite.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := suite.CreateService(t, dep)
+		accessRepo := repository.NewAccessRepository(svc)
+		tenantRepo := repository.NewTenantRepository(svc)
+		partitionRepo := repository.NewPartitionRepository(svc)
+
+		tenant := models.Tenant{Name: "Integrity T", Description: "Test"}
+		require.NoError(t, tenantRepo.Save(ctx, &tenant))
+
+		partition := models.Partition{
+			Name:      "Integrity Partition",
+			BaseModel: frame.BaseModel{TenantID: tenant.GetID()},
+		}
+		require.NoError(t, partitionRepo.Save(ctx, &partition))
+
+		access := models.Access{
+			ProfileID: "integrity-profile",
+			BaseModel: frame.BaseModel{TenantID: tenant.GetID(), PartitionID: partition.GetID()},
+		}
+		require.NoError(t, accessRepo.Save(ctx, &access))
+
+		err := accessRepo.Save(ctx, &models.Access{
+			ProfileID: "integrity-profile",
+			BaseModel: frame.BaseModel{TenantID: tenant.GetID(), PartitionID: partition.GetID()},
+		})
+		require.Error(t, err)
+		assert.True(t, repository.ErrorIsUniqueViolation(err), "a profile has one access per partition")
+
+		err = accessRepo.SaveRole(ctx, &models.AccessRole{
+			AccessID:        access.GetID(),
+			PartitionRoleID: "missing-role",
+		})
+		require.Error(t, err)
+		assert.True(t, repository.ErrorIsForeignKeyViolation(err), "an access role must reference a partition role")
+	})
+}
+
+func (suite *AccessTestSuite) TestApplyChangesGuards() {
+	suite.WithTestDependancies(suite.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := suite.CreateService(t, dep)
+		accessRepo := repository.NewAccessRepository(svc)
+
+		role := &models.PartitionRole{Name: "clerk"}
+		partition := suite.CreatePartition(t, svc, nil, role)
+
+		accesses := make([]*models.Access, 0, 2)
+		accessRoles := make([]*models.AccessRole, 0, 2)
+		for _, profileID := range []string{"profile-1", "profile-2"} {
+			access := &models.Access{
+				ProfileID: profileID,
+				State:     models.AccessStateActive,
+				BaseModel: frame.BaseModel{TenantID: partition.TenantID, PartitionID: partition.GetID()},
+			}
+			accessRole := &models.AccessRole{PartitionRoleID: role.GetID()}
+			require.NoError(t, accessRepo.ApplyChanges(ctx, &repository.AccessChange{
+				Access:   access,
+				AddRoles: []*models.AccessRole{accessRole},
+			}))
+			accesses = append(accesses, access)
+			accessRoles = append(accessRoles, accessRole)
+		}
+
+		err := accessRepo.ApplyChanges(ctx, &repository.AccessChange{
+			Access:        accesses[0],
+			ExpectedState: models.AccessStateActive,
+			RemoveRoleIDs: []string{accessRoles[1].GetID()},
+		})
+		require.ErrorIs(t, err, repository.ErrAccessChanged)
+
+		remaining, err := accessRepo.GetRoles(ctx, accesses[1].GetID())
+		require.NoError(t, err)
+		assert.Len(t, remaining, 1, "roles of other accesses are never removed")
+
+		stale := *accesses[0]
+		accesses[0].State = models.AccessStateRevoked
+		require.NoError(t, accessRepo.ApplyChanges(ctx, &repository.AccessChange{
+			Access:        accesses[0],
+			ExpectedState: models.AccessStateActive,
+		}))
+
+		stale.StateReason = "read before the revocation"
+		err = accessRepo.ApplyChanges(ctx, &repository.AccessChange{
+			Access:        &stale,
+			ExpectedState: models.AccessStateActive,
+		})
+		require.ErrorIs(t, err, repository.ErrAccessChanged)
+
+		stored, err := accessRepo.GetByID(ctx, accesses[0].GetID())
+		require.NoError(t, err)
+		assert.Equal(t, models.AccessStateRevoked, stored.State, "a revocation is never written over")
+	})
+}
+
 // TestAccessRepository runs the access repository test suite.
 func TestAccessRepository(t *testing.T) {
 	suite.Run(t, new(AccessTestSuite))
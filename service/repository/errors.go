@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrAccessChanged reports that an access or its roles changed between reading and writing them.
+var ErrAccessChanged = errors.New("access changed since it was read")
+
+// ErrRoleAssigned reports that a partition role can not be removed while accesses still hold it.
+var ErrRoleAssigned = errors.New("partition role is still assigned")
+
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+func hasPgErrorCode(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
+
+// ErrorIsUniqueViolation reports whether a write was rejected by a unique constraint.
+func ErrorIsUniqueViolation(err error) bool {
+	return hasPgErrorCode(err, pgUniqueViolation)
+}
+
+// ErrorIsForeignKeyViolation reports whether a write referenced a row that does not exist.
+func ErrorIsForeignKeyViolation(err error) bool {
+	return hasPgErrorCode(err, pgForeignKeyViolation)
+}
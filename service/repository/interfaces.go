@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/antinvestor/service-partition/service/models"
 )
@@ -15,31 +16,161 @@ type TenantRepository interface {
 
 type PartitionRepository interface {
 	GetByID(ctx context.Context, id string) (*models.Partition, error)
+	GetByIDs(ctx context.Context, id ...string) ([]*models.Partition, error)
 	GetByQuery(ctx context.Context, query string, count uint32, page uint32) ([]*models.Partition, error)
 	GetChildren(ctx context.Context, id string) ([]*models.Partition, error)
+	GetByTenant(ctx context.Context, tenantID string) ([]*models.Partition, error)
 	Save(ctx context.Context, partition *models.Partition) error
 	Delete(ctx context.Context, id string) error
+	// UpdateProperties locks the partition, lets update change its properties and writes them back in the
+	// same transaction, concurrent updates of the properties wait for each other instead of losing changes.
+	UpdateProperties(
+		ctx context.Context,
+		partitionID string,
+		update func(partition *models.Partition) error,
+	) (*models.Partition, error)
 
 	GetRoles(ctx context.Context, partitionID string) ([]*models.PartitionRole, error)
 	GetRolesByID(ctx context.Context, id ...string) ([]*models.PartitionRole, error)
+	GetRoleByPartitionAndName(ctx context.Context, partitionID string, name string) (*models.PartitionRole, error)
+	GetRolesByTemplateID(ctx context.Context, templateID string) ([]*models.PartitionRole, error)
 	SaveRole(ctx context.Context, role *models.PartitionRole) error
 	RemoveRole(ctx context.Context, partitionRoleID string) error
+	// RemoveRoleWithAssignments removes a role and the assignments of it in one transaction and returns them.
+	// Without cascade a role that is still assigned is kept and ErrRoleAssigned returned with its assignments.
+	RemoveRoleWithAssignments(
+		ctx context.Context,
+		partitionRoleID string,
+		cascade bool,
+	) ([]*models.AccessRole, error)
 }
 
 type PageRepository interface {
 	GetByID(ctx context.Context, id string) (*models.Page, error)
+	// GetByPartitionAndName prefers the variant of the page without a locale.
 	GetByPartitionAndName(ctx context.Context, partitionID string, name string) (*models.Page, error)
+	GetByPartitionNameAndLocale(ctx context.Context, partitionID string, name string, locale string) (*models.Page, error)
+	// ListVariants returns every locale variant of a page.
+	ListVariants(ctx context.Context, partitionID string, name string) ([]*models.Page, error)
+	ListByPartition(ctx context.Context, partitionID string, count uint32, page uint32) ([]*models.Page, error)
 	Save(ctx context.Context, partition *models.Page) error
 	Delete(ctx context.Context, id string) error
+
+	// SaveRevision numbers the revision after the latest one of the page and stores both together.
+	SaveRevision(ctx context.Context, page *models.Page, revision *models.PageRevision) error
+	// PublishRevision serves the revision, only the published columns of the page are written.
+	PublishRevision(ctx context.Context, page *models.Page, revision *models.PageRevision) error
+	// Update writes the name and locale of the page and, when one is given, stores the revision as a draft,
+	// both in one transaction. No other column of the page is written.
+	Update(ctx context.Context, page *models.Page, revision *models.PageRevision) error
+	GetRevision(ctx context.Context, pageID string, revision int) (*models.PageRevision, error)
+	ListRevisions(ctx context.Context, pageID string) ([]*models.PageRevision, error)
+}
+
+// AccessFilter narrows down access listings, empty fields do not filter.
+type AccessFilter struct {
+	RoleIDs []string
+	States  []models.AccessState
+	// ActiveAt keeps only accesses that are active and within their validity window at that time.
+	ActiveAt *time.Time
+	// GuestsOnly keeps only accesses of guests from other tenants.
+	GuestsOnly bool
+}
+
+// AccessChange groups the writes made to a single access by a bulk operation.
+type AccessChange struct {
+	Access *models.Access
+	// ExpectedState is the state an existing access was read in, the change is rolled back with
+	// ErrAccessChanged when the access moved on before it was written.
+	ExpectedState models.AccessState
+	AddRoles      []*models.AccessRole
+	// RemoveRoleIDs are role assignments of the access itself, assignments of other accesses are never removed.
+	RemoveRoleIDs []string
+	// Remove writes the access a last time, then deletes it together with all of its roles.
+	Remove bool
 }
 
 type AccessRepository interface {
 	GetByID(ctx context.Context, id string) (*models.Access, error)
 	GetByPartitionAndProfile(ctx context.Context, partitionID string, profile string) (*models.Access, error)
+	ListByPartition(
+		ctx context.Context,
+		partitionID string,
+		filter *AccessFilter,
+		count uint32,
+		page uint32,
+	) ([]*models.Access, error)
+	ListByProfile(
+		ctx context.Context,
+		profileID string,
+		filter *AccessFilter,
+		count uint32,
+		page uint32,
+	) ([]*models.Access, error)
 	Save(ctx context.Context, access *models.Access) error
 	Delete(ctx context.Context, id string) error
+	GetAllIncludingDeleted(ctx context.Context, count uint32, page uint32) ([]*models.Access, error)
+	GetExpired(ctx context.Context, at time.Time, count uint32) ([]*models.Access, error)
+	// Expire moves an access out of force unless it changed since it was read, and reports whether it did.
+	Expire(ctx context.Context, access *models.Access, at time.Time) (bool, error)
+	// ReplaceSponsor hands the guests of a sponsor over to the replacement, an empty one leaves them unsponsored.
+	ReplaceSponsor(ctx context.Context, sponsorProfileID string, replacementID string) error
 
 	GetRoles(ctx context.Context, accessID string) ([]*models.AccessRole, error)
+	GetRolesByAccessIDs(ctx context.Context, accessIDs ...string) ([]*models.AccessRole, error)
+	GetRoleByID(ctx context.Context, accessRoleID string) (*models.AccessRole, error)
+	GetRolesByPartitionRoleID(ctx context.Context, partitionRoleID string) ([]*models.AccessRole, error)
+	GetExpiredRoles(ctx context.Context, at time.Time, count uint32) ([]*models.AccessRole, error)
+	// ExpireRole marks a lapsed role assignment as expired unless that was already done, and reports whether it did.
+	ExpireRole(ctx context.Context, accessRole *models.AccessRole, at time.Time) (bool, error)
 	SaveRole(ctx context.Context, role *models.AccessRole) error
 	RemoveRole(ctx context.Context, accessRoleID string) error
+
+	ApplyChanges(ctx context.Context, changes ...*AccessChange) error
+}
+
+type RoleTemplateRepository interface {
+	GetByID(ctx context.Context, id string) (*models.RoleTemplate, error)
+	GetByTenant(ctx context.Context, tenantID string) ([]*models.RoleTemplate, error)
+	GetByTenantAndName(ctx context.Context, tenantID string, name string) (*models.RoleTemplate, error)
+	Save(ctx context.Context, template *models.RoleTemplate) error
+	Delete(ctx context.Context, id string) error
+}
+
+type AccessRequestRepository interface {
+	GetByID(ctx context.Context, id string) (*models.AccessRequest, error)
+	GetPending(ctx context.Context, partitionID string, profileID string, roleID string) (*models.AccessRequest, error)
+	ListPendingByProfile(ctx context.Context, profileID string) ([]*models.AccessRequest, error)
+	ListByPartition(
+		ctx context.Context,
+		partitionID string,
+		states []models.AccessRequestState,
+	) ([]*models.AccessRequest, error)
+	// SaveWithEvent stores the request together with the event that changed it.
+	SaveWithEvent(ctx context.Context, request *models.AccessRequest, event *models.AccessRequestEvent) error
+	// Decide records the decision on a pending request with its event and the access it grants, if any,
+	// in one transaction. It reports false and writes nothing when the request is no longer pending, and
+	// fails with ErrAccessChanged when the granted access left the state it was read in.
+	Decide(
+		ctx context.Context,
+		request *models.AccessRequest,
+		event *models.AccessRequestEvent,
+		grant *AccessChange,
+	) (bool, error)
+	GetEvents(ctx context.Context, accessRequestID string) ([]*models.AccessRequestEvent, error)
+	// ReplaceProfile rewrites every mention of the profile in requests and their history, deleted ones included,
+	// an empty replacement leaves them naming no profile.
+	ReplaceProfile(ctx context.Context, profileID string, replacementID string) error
+}
+
+type InvitationRepository interface {
+	GetByID(ctx context.Context, id string) (*models.Invitation, error)
+	GetPendingByPartitionAndContact(ctx context.Context, partitionID string, contact string) (*models.Invitation, error)
+	Save(ctx context.Context, invitation *models.Invitation) error
+	// UpdatePending writes the new state of an invitation unless it has left the pending state meanwhile,
+	// reporting whether it was written.
+	UpdatePending(ctx context.Context, invitation *models.Invitation) (bool, error)
+	// Accept applies the access grant and claims the pending invitation in one transaction. An invitation
+	// claimed concurrently is reported as not accepted and the grant is rolled back.
+	Accept(ctx context.Context, invitation *models.Invitation, grant *AccessChange) (bool, error)
 }
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/antinvestor/service-partition/service/models"
+	"gorm.io/gorm"
+
+	"github.com/pitabwire/frame"
+)
+
+type invitationRepository struct {
+	service *frame.Service
+}
+
+func (ir *invitationRepository) GetByID(ctx context.Context, id string) (*models.Invitation, error) {
+	invitation := &models.Invitation{}
+	err := ir.service.DB(ctx, true).First(invitation, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+func (ir *invitationRepository) GetPendingByPartitionAndContact(
+	ctx context.Context,
+	partitionID string,
+	contact string,
+) (*models.Invitation, error) {
+	invitation := &models.Invitation{}
+	err := ir.service.DB(ctx, true).First(invitation, "partition_id = ? AND contact = ? AND state = ?",
+		partitionID, contact, models.InvitationStatePending).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+func (ir *invitationRepository) Save(ctx context.Context, invitation *models.Invitation) error {
+	return ir.service.DB(ctx, false).Save(invitation).Error
+}
+
+func (ir *invitationRepository) UpdatePending(ctx context.Context, invitation *models.Invitation) (bool, error) {
+	return updatePendingInvitation(ir.service.DB(ctx, false), invitation)
+}
+
+func (ir *invitationRepository) Accept(
+	ctx context.Context,
+	invitation *models.Invitation,
+	grant *AccessChange,
+) (bool, error) {
+	// Returning an error rolls back the grant of an invitation that was claimed concurrently.
+	errNotPending := errors.New("invitation is no longer pending")
+
+	err := ir.service.DB(ctx, false).Transaction(func(tx *gorm.DB) error {
+		err := writeAccessChange(tx, grant)
+		if err != nil {
+			return err
+		}
+
+		invitation.AccessID = grant.Access.GetID()
+		updated, err := updatePendingInvitation(tx, invitation)
+		if err != nil {
+			return err
+		}
+
+		if !updated {
+			return errNotPending
+		}
+		return nil
+	})
+	if errors.Is(err, errNotPending) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// updatePendingInvitation writes the outcome of an invitation only while it is still pending.
+func updatePendingInvitation(db *gorm.DB, invitation *models.Invitation) (bool, error) {
+	result := db.Model(&models.Invitation{}).
+		Where("id = ? AND state = ?", invitation.GetID(), models.InvitationStatePending).
+		Updates(map[string]any{
+			"state":       invitation.State,
+			"accepted_at": invitation.AcceptedAt,
+			"profile_id":  invitation.ProfileID,
+			"access_id":   invitation.AccessID,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func NewInvitationRepository(service *frame.Service) InvitationRepository {
+	repo := invitationRepository{
+		service: service,
+	}
+	return &repo
+}
@@ -0,0 +1,67 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/antinvestor/service-partition/internal/tests"
+	"github.com/antinvestor/service-partition/service/models"
+	"github.com/antinvestor/service-partition/service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/pitabwire/frame"
+	"github.com/pitabwire/frame/tests/testdef"
+)
+
+type InvitationTestSuite struct {
+	tests.BaseTestSuite
+}
+
+func (suite *InvitationTestSuite) TestAcceptClaimsPendingInvitationOnce() {
+	suite.WithTestDependancies(suite.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := suite.CreateService(t, dep)
+		accessRepo := repository.NewAccessRepository(svc)
+		invitationRepo := repository.NewInvitationRepository(svc)
+
+		partition := suite.CreatePartition(t, svc, nil)
+		baseModel := frame.BaseModel{TenantID: partition.TenantID, PartitionID: partition.GetID()}
+
+		invitation := &models.Invitation{
+			Contact:   "invited@example.com",
+			State:     models.InvitationStatePending,
+			ExpiresAt: time.Now().Add(time.Hour),
+			BaseModel: baseModel,
+		}
+		require.NoError(t, invitationRepo.Save(ctx, invitation))
+
+		revoked := *invitation
+		revoked.State = models.InvitationStateRevoked
+		require.NoError(t, invitationRepo.Save(ctx, &revoked))
+
+		acceptedAt := time.Now()
+		invitation.State = models.InvitationStateAccepted
+		invitation.AcceptedAt = &acceptedAt
+		invitation.ProfileID = "invited-profile"
+
+		accepted, err := invitationRepo.Accept(ctx, invitation, &repository.AccessChange{
+			Access: &models.Access{ProfileID: "invited-profile", BaseModel: baseModel},
+		})
+		require.NoError(t, err)
+		assert.False(t, accepted, "a revoked invitation can not be claimed")
+
+		_, err = accessRepo.GetByPartitionAndProfile(ctx, partition.GetID(), "invited-profile")
+		require.True(t, frame.ErrorIsNoRows(err), "the access grant is rolled back")
+
+		stored, err := invitationRepo.GetByID(ctx, invitation.GetID())
+		require.NoError(t, err)
+		assert.Equal(t, models.InvitationStateRevoked, stored.State)
+		assert.Empty(t, stored.AccessID)
+	})
+}
+
+// TestInvitationRepository runs the invitation repository test suite.
+func TestInvitationRepository(t *testing.T) {
+	suite.Run(t, new(InvitationTestSuite))
+}
@@ -11,5 +11,6 @@ import (
 func Migrate(ctx context.Context, svc *frame.Service, migrationPath string) error {
 	return svc.MigrateDatastore(ctx, migrationPath,
 		models.Tenant{}, models.Partition{}, models.PartitionRole{},
-		models.Access{}, models.AccessRole{}, models.Page{})
+		models.Access{}, models.AccessRole{}, models.Page{}, models.Invitation{},
+		models.RoleTemplate{}, models.AccessRequest{}, models.AccessRequestEvent{}, models.PageRevision{})
 }
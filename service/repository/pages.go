@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/antinvestor/service-partition/service/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/pitabwire/frame"
 )
@@ -24,10 +26,53 @@ func (pgr *pageRepository) GetByPartitionAndName(
 	name string,
 ) (*models.Page, error) {
 	page := &models.Page{}
-	err := pgr.service.DB(ctx, true).First(page, "partition_id = ? AND name = ?", partitionID, name).Error
+	err := pgr.service.DB(ctx, true).Order("locale").First(page, "partition_id = ? AND name = ?", partitionID, name).Error
 	return page, err
 }
 
+func (pgr *pageRepository) GetByPartitionNameAndLocale(
+	ctx context.Context,
+	partitionID string,
+	name string,
+	locale string,
+) (*models.Page, error) {
+	page := &models.Page{}
+	err := pgr.service.DB(ctx, true).
+		First(page, "partition_id = ? AND name = ? AND locale = ?", partitionID, name, locale).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (pgr *pageRepository) ListVariants(ctx context.Context, partitionID string, name string) ([]*models.Page, error) {
+	pages := make([]*models.Page, 0)
+	err := pgr.service.DB(ctx, true).
+		Where("partition_id = ? AND name = ?", partitionID, name).
+		Order("locale, id").
+		Find(&pages).Error
+	return pages, err
+}
+
+func (pgr *pageRepository) ListByPartition(
+	ctx context.Context,
+	partitionID string,
+	count uint32,
+	page uint32,
+) ([]*models.Page, error) {
+	pages := make([]*models.Page, 0)
+	// Listings leave out the HTML, it is only needed when a page is served.
+	err := pgr.service.DB(ctx, true).
+		Omit("html").
+		Where("partition_id = ?", partitionID).
+		Order("name, locale, id").
+		Offset(int(page * count)).
+		Limit(int(count)).
+		Find(&pages).Error
+	return pages, err
+}
+
 func (pgr *pageRepository) Save(ctx context.Context, page *models.Page) error {
 	return pgr.service.DB(ctx, false).Save(page).Error
 }
@@ -36,6 +81,140 @@ func (pgr *pageRepository) Delete(ctx context.Context, id string) error {
 	return pgr.service.DB(ctx, false).Where("id = ?", id).Delete(&models.Page{}).Error
 }
 
+// lockPage loads the page for update, concurrent writers to the page wait for the transaction.
+func lockPage(tx *gorm.DB, pageID string) (*models.Page, error) {
+	locked := &models.Page{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(locked, "id = ?", pageID).Error
+	if err != nil {
+		return nil, err
+	}
+	return locked, nil
+}
+
+func (pgr *pageRepository) SaveRevision(
+	ctx context.Context,
+	page *models.Page,
+	revision *models.PageRevision,
+) error {
+	return pgr.service.DB(ctx, false).Transaction(func(tx *gorm.DB) error {
+		if page.GetID() == "" {
+			page.LatestRevision = 1
+			err := tx.Create(page).Error
+			if err != nil {
+				return err
+			}
+
+			return createRevision(tx, page, revision)
+		}
+
+		return appendRevision(tx, page, revision)
+	})
+}
+
+// appendRevision stores the revision after the latest one of an existing page with the page locked.
+func appendRevision(tx *gorm.DB, page *models.Page, revision *models.PageRevision) error {
+	locked, err := lockPage(tx, page.GetID())
+	if err != nil {
+		return err
+	}
+
+	updates := make(map[string]any)
+	if locked.LatestRevision == 0 && locked.HTML != "" {
+		// Pages saved before revisions were tracked keep their live HTML as the first revision.
+		locked.LatestRevision, locked.PublishedRevision = 1, 1
+		updates["published_revision"] = locked.PublishedRevision
+
+		err = createRevision(tx, locked, &models.PageRevision{HTML: locked.HTML})
+		if err != nil {
+			return err
+		}
+	}
+
+	locked.LatestRevision++
+	updates["latest_revision"] = locked.LatestRevision
+
+	err = tx.Model(locked).Updates(updates).Error
+	if err != nil {
+		return err
+	}
+
+	*page = *locked
+	return createRevision(tx, page, revision)
+}
+
+// createRevision stores the revision as the latest revision of the page.
+func createRevision(tx *gorm.DB, page *models.Page, revision *models.PageRevision) error {
+	revision.PageID = page.GetID()
+	revision.Revision = page.LatestRevision
+	revision.TenantID = page.TenantID
+	revision.PartitionID = page.PartitionID
+	return tx.Create(revision).Error
+}
+
+func (pgr *pageRepository) PublishRevision(
+	ctx context.Context,
+	page *models.Page,
+	revision *models.PageRevision,
+) error {
+	return pgr.service.DB(ctx, false).Transaction(func(tx *gorm.DB) error {
+		locked, err := lockPage(tx, page.GetID())
+		if err != nil {
+			return err
+		}
+
+		locked.HTML = revision.HTML
+		locked.PublishedRevision = revision.Revision
+		locked.State = page.State
+
+		err = tx.Model(locked).Updates(map[string]any{
+			"html":               locked.HTML,
+			"published_revision": locked.PublishedRevision,
+			"state":              locked.State,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		*page = *locked
+		return nil
+	})
+}
+
+func (pgr *pageRepository) Update(ctx context.Context, page *models.Page, revision *models.PageRevision) error {
+	return pgr.service.DB(ctx, false).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Page{}).Where("id = ?", page.GetID()).
+			Updates(map[string]any{"name": page.Name, "locale": page.Locale}).Error
+		if err != nil {
+			return err
+		}
+
+		if revision == nil {
+			return nil
+		}
+		return appendRevision(tx, page, revision)
+	})
+}
+
+func (pgr *pageRepository) GetRevision(
+	ctx context.Context,
+	pageID string,
+	revision int,
+) (*models.PageRevision, error) {
+	pageRevision := &models.PageRevision{}
+	err := pgr.service.DB(ctx, true).First(pageRevision, "page_id = ? AND revision = ?", pageID, revision).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return pageRevision, nil
+}
+
+func (pgr *pageRepository) ListRevisions(ctx context.Context, pageID string) ([]*models.PageRevision, error) {
+	revisions := make([]*models.PageRevision, 0)
+	err := pgr.service.DB(ctx, true).Where("page_id = ?", pageID).Order("revision").Find(&revisions).Error
+	return revisions, err
+}
+
 func NewPageRepository(service *frame.Service) PageRepository {
 	repo := pageRepository{
 		service: service,
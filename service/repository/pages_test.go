@@ -232,6 +232,73 @@ func (suite *PageTestSuite) TestDelete() {
 	})
 }
 
+func (suite *PageTestSuite) TestPublishRevision() {
+	suite.WithTestDependancies(suite.T(), func(t *testing.T, dep *testdef.DependancyOption) {
+		svc, ctx := suite.CreateService(t, dep)
+		pageRepo := repository.NewPageRepository(svc)
+		tenantRepo := repository.NewTenantRepository(svc)
+		partitionRepo := repository.NewPartitionRepository(svc)
+
+		tenant := models.Tenant{Name: "default", Description: "Test"}
+		err := tenantRepo.Save(ctx, &tenant)
+		require.NoError(t, err)
+
+		partition := models.Partition{
+			Name:        "Test Partition",
+			Description: "Test partition description",
+			BaseModel:   frame.BaseModel{TenantID: tenant.GetID()},
+		}
+		err = partitionRepo.Save(ctx, &partition)
+		require.NoError(t, err)
+
+		// A page saved before revisions were tracked.
+		page := models.Page{
+			Name: "legacy",
+			HTML: "<p>live</p>",
+			BaseModel: frame.BaseModel{
+				TenantID:    tenant.GetID(),
+				PartitionID: partition.GetID(),
+			},
+		}
+		err = pageRepo.Save(ctx, &page)
+		require.NoError(t, err)
+
+		stale, err := pageRepo.GetByID(ctx, page.GetID())
+		require.NoError(t, err)
+
+		draft := &models.PageRevision{HTML: "<p>draft</p>"}
+		err = pageRepo.SaveRevision(ctx, &page, draft)
+		require.NoError(t, err)
+		assert.Equal(t, 2, draft.Revision, "the live HTML becomes the first revision")
+
+		legacy, err := pageRepo.GetRevision(ctx, page.GetID(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, "<p>live</p>", legacy.HTML)
+
+		// Publishing from a page read before the draft was saved keeps the latest revision.
+		err = pageRepo.PublishRevision(ctx, stale, draft)
+		require.NoError(t, err)
+
+		published, err := pageRepo.GetByID(ctx, page.GetID())
+		require.NoError(t, err)
+		assert.Equal(t, 2, published.LatestRevision)
+		assert.Equal(t, 2, published.PublishedRevision)
+		assert.Equal(t, "<p>draft</p>", published.HTML)
+
+		// Saving a draft from a page read before the publish leaves the published revision alone.
+		next := &models.PageRevision{HTML: "<p>next</p>"}
+		err = pageRepo.SaveRevision(ctx, &page, next)
+		require.NoError(t, err)
+		assert.Equal(t, 3, next.Revision)
+
+		saved, err := pageRepo.GetByID(ctx, page.GetID())
+		require.NoError(t, err)
+		assert.Equal(t, 3, saved.LatestRevision)
+		assert.Equal(t, 2, saved.PublishedRevision)
+		assert.Equal(t, "<p>draft</p>", saved.HTML)
+	})
+}
+
 // TestPageRepository runs the page repository test suite.
 func TestPageRepository(t *testing.T) {
 	suite.Run(t, new(PageTestSuite))
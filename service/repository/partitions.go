@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/antinvestor/service-partition/service/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/pitabwire/frame"
 )
@@ -18,6 +20,15 @@ func (pr *partitionRepository) GetByID(ctx context.Context, id string) (*models.
 	return partition, err
 }
 
+func (pr *partitionRepository) GetByIDs(ctx context.Context, idList ...string) ([]*models.Partition, error) {
+	partitionList := make([]*models.Partition, 0)
+	if len(idList) == 0 {
+		return partitionList, nil
+	}
+	err := pr.service.DB(ctx, true).Find(&partitionList, "id IN ?", idList).Error
+	return partitionList, err
+}
+
 func (pr *partitionRepository) GetByQuery(ctx context.Context,
 	query string, count uint32, page uint32) ([]*models.Partition, error) {
 	partitionList := make([]*models.Partition, 0)
@@ -34,6 +45,12 @@ func (pr *partitionRepository) GetChildren(ctx context.Context, id string) ([]*m
 	return childPartition, err
 }
 
+func (pr *partitionRepository) GetByTenant(ctx context.Context, tenantID string) ([]*models.Partition, error) {
+	partitionList := make([]*models.Partition, 0)
+	err := pr.service.DB(ctx, true).Order("created_at, id").Find(&partitionList, "tenant_id = ?", tenantID).Error
+	return partitionList, err
+}
+
 func (pr *partitionRepository) Save(ctx context.Context, partition *models.Partition) error {
 	return pr.service.DB(ctx, false).Save(partition).Error
 }
@@ -46,6 +63,32 @@ func (pr *partitionRepository) Delete(ctx context.Context, id string) error {
 	return pr.service.DB(ctx, false).Delete(partition).Error
 }
 
+func (pr *partitionRepository) UpdateProperties(
+	ctx context.Context,
+	partitionID string,
+	update func(partition *models.Partition) error,
+) (*models.Partition, error) {
+	partition := &models.Partition{}
+	err := pr.service.DB(ctx, false).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(partition, "id = ?", partitionID).Error
+		if err != nil {
+			return err
+		}
+
+		err = update(partition)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(partition).Update("properties", partition.Properties).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return partition, nil
+}
+
 func (pr *partitionRepository) GetRoles(ctx context.Context, partitionID string) ([]*models.PartitionRole, error) {
 	partitionRoles := make([]*models.PartitionRole, 0)
 	err := pr.service.DB(ctx, true).Find(&partitionRoles, "partition_id = ?", partitionID).Error
@@ -58,6 +101,31 @@ func (pr *partitionRepository) GetRolesByID(ctx context.Context, idList ...strin
 	return partitionRoles, err
 }
 
+// GetRoleByPartitionAndName finds a role by name within a partition, names are compared case insensitively.
+func (pr *partitionRepository) GetRoleByPartitionAndName(
+	ctx context.Context,
+	partitionID string,
+	name string,
+) (*models.PartitionRole, error) {
+	partitionRole := &models.PartitionRole{}
+	err := pr.service.DB(ctx, true).
+		First(partitionRole, "partition_id = ? AND LOWER(name) = LOWER(?)", partitionID, name).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return partitionRole, nil
+}
+
+func (pr *partitionRepository) GetRolesByTemplateID(
+	ctx context.Context,
+	templateID string,
+) ([]*models.PartitionRole, error) {
+	partitionRoles := make([]*models.PartitionRole, 0)
+	err := pr.service.DB(ctx, true).Order("partition_id").Find(&partitionRoles, "template_id = ?", templateID).Error
+	return partitionRoles, err
+}
+
 func (pr *partitionRepository) SaveRole(ctx context.Context, role *models.PartitionRole) error {
 	return pr.service.DB(ctx, false).Save(role).Error
 }
@@ -66,6 +134,41 @@ func (pr *partitionRepository) RemoveRole(ctx context.Context, partitionRoleID s
 	return pr.service.DB(ctx, false).Where("id = ?", partitionRoleID).Delete(&models.PartitionRole{}).Error
 }
 
+// RemoveRoleWithAssignments removes a partition role together with every access role assigning it.
+// The role is locked while its assignments are read and removed, so the returned assignments are exactly
+// the ones removed with it.
+func (pr *partitionRepository) RemoveRoleWithAssignments(
+	ctx context.Context,
+	partitionRoleID string,
+	cascade bool,
+) ([]*models.AccessRole, error) {
+	accessRoles := make([]*models.AccessRole, 0)
+	err := pr.service.DB(ctx, false).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&models.PartitionRole{}, "id = ?", partitionRoleID).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("partition_role_id = ?", partitionRoleID).Find(&accessRoles).Error
+		if err != nil {
+			return err
+		}
+
+		if len(accessRoles) > 0 && !cascade {
+			return ErrRoleAssigned
+		}
+
+		err = tx.Where("partition_role_id = ?", partitionRoleID).Delete(&models.AccessRole{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("id = ?", partitionRoleID).Delete(&models.PartitionRole{}).Error
+	})
+	return accessRoles, err
+}
+
 func NewPartitionRepository(service *frame.Service) PartitionRepository {
 	repo := partitionRepository{
 		service: service,
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/antinvestor/service-partition/service/models"
+
+	"github.com/pitabwire/frame"
+)
+
+type roleTemplateRepository struct {
+	service *frame.Service
+}
+
+func (rr *roleTemplateRepository) GetByID(ctx context.Context, id string) (*models.RoleTemplate, error) {
+	template := &models.RoleTemplate{}
+	err := rr.service.DB(ctx, true).First(template, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (rr *roleTemplateRepository) GetByTenant(ctx context.Context, tenantID string) ([]*models.RoleTemplate, error) {
+	templates := make([]*models.RoleTemplate, 0)
+	err := rr.service.DB(ctx, true).Order("name").Find(&templates, "tenant_id = ?", tenantID).Error
+	return templates, err
+}
+
+func (rr *roleTemplateRepository) GetByTenantAndName(
+	ctx context.Context,
+	tenantID string,
+	name string,
+) (*models.RoleTemplate, error) {
+	template := &models.RoleTemplate{}
+	err := rr.service.DB(ctx, true).
+		First(template, "tenant_id = ? AND LOWER(name) = LOWER(?)", tenantID, name).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (rr *roleTemplateRepository) Save(ctx context.Context, template *models.RoleTemplate) error {
+	return rr.service.DB(ctx, false).Save(template).Error
+}
+
+func (rr *roleTemplateRepository) Delete(ctx context.Context, id string) error {
+	return rr.service.DB(ctx, false).Where("id = ?", id).Delete(&models.RoleTemplate{}).Error
+}
+
+func NewRoleTemplateRepository(service *frame.Service) RoleTemplateRepository {
+	repo := roleTemplateRepository{
+		service: service,
+	}
+	return &repo
+}